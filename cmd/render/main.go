@@ -0,0 +1,302 @@
+/*
+render renders Kubernetes components as plain manifests, without requiring access to a live cluster.
+
+It runs an inline Pulumi program using a local backend and a Kubernetes provider configured to
+write manifests to a directory, so that they can be reviewed, diffed in pull requests, committed
+to GitOps repositories or linted offline with schema validation tools such as kubeconform.
+
+Usage:
+
+	render -dir dist/manifests -components gwapicrds,priorityclass,cni,gateway \
+		-lb-pool-cidr fd00::/112 -domain kema.dev -domain kema.cloud
+
+Random values (e.g. routing prefixes) are stored in Pulumi state. Use -state-dir with a persistent
+directory to keep them stable across runs, otherwise a temporary state is used and discarded.
+
+Applications deployed with basichttpapp are not available as a component: they are not shared
+cluster components, and basichttpapp.DeployBasicHTTPApp derives the application name from the git
+repository of the working directory and its runtime environment from the stack name, on top of
+requiring application-specific parameters such as image and ownership. Render them from the
+application Pulumi program instead, passing render.Options to DeployBasicHTTPApp.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kemadev/go-framework/pkg/log"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/cni"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/gateway"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/gwapicrds"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/priorityclass"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/render"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optup"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/tokens"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// projectName is the name of the Pulumi project used for rendering.
+	projectName = "infrastructure-components-render"
+	// stackName is the name of the Pulumi stack used for rendering.
+	stackName = "render"
+)
+
+const (
+	// componentGatewayAPICRDs renders the Gateway API CRDs.
+	componentGatewayAPICRDs = "gwapicrds"
+	// componentPriorityClass renders the default priority classes.
+	componentPriorityClass = "priorityclass"
+	// componentCNI renders the CNI.
+	componentCNI = "cni"
+	// componentGateway renders the tier gateways resources.
+	componentGateway = "gateway"
+)
+
+// availableComponents are the components that can be rendered, in rendering order.
+var availableComponents = []string{
+	componentGatewayAPICRDs,
+	componentPriorityClass,
+	componentCNI,
+	componentGateway,
+}
+
+// stringsFlag is a repeatable string flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// renderArgs contains the arguments used to render components.
+type renderArgs struct {
+	// Dir is the directory to render manifests to.
+	Dir string
+	// StateDir is the directory holding Pulumi state.
+	StateDir string
+	// Components is the list of components to render.
+	Components []string
+	// ClusterName is the name of the cluster to render manifests for.
+	ClusterName string
+	// CNI contains the CNI parameters.
+	CNI cni.CNIArgs
+	// Gateway contains the parameters of the rendered tier gateway.
+	Gateway gateway.TierArgs
+}
+
+func main() {
+	logger := log.CreateFallbackLogger()
+
+	args, err := parseArgs(os.Args[1:])
+	if err != nil {
+		logger.Error(
+			"render",
+			slog.String("Body", "invalid arguments"),
+			slog.String("error.message", err.Error()),
+		)
+		os.Exit(2)
+	}
+
+	err = run(context.Background(), args)
+	if err != nil {
+		logger.Error(
+			"render",
+			slog.String("Body", "render failure"),
+			slog.String("error.message", err.Error()),
+		)
+		os.Exit(1)
+	}
+
+	logger.Info(
+		"render",
+		slog.String("Body", "manifests rendered"),
+		slog.String("directory", args.Dir),
+	)
+}
+
+// parseArgs parses command line arguments, returning the render arguments and an error if any.
+func parseArgs(arguments []string) (renderArgs, error) {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	dir := fs.String("dir", "dist/manifests", "directory to render manifests to")
+	stateDir := fs.String("state-dir", "", "directory holding Pulumi state, a temporary one is used if empty")
+	components := fs.String(
+		"components",
+		strings.Join(availableComponents, ","),
+		"comma-separated list of components to render, among "+strings.Join(availableComponents, ", "),
+	)
+	clusterName := fs.String("cluster-name", "render", "name of the cluster to render manifests for")
+	ipFamily := fs.String("cni-ip-family", "", "IP families enabled by the CNI, among ipv4, ipv6, dual-stack")
+	ipv4PodCIDR := fs.String("cni-ipv4-pod-cidr", "", "IPv4 CIDR pod IPs are allocated from, required for IPv4")
+	ipv6PodCIDR := fs.String("cni-ipv6-pod-cidr", "", "IPv6 CIDR pod IPs are allocated from, a random ULA prefix is used if empty")
+	mutualAuth := fs.Bool("cni-mutual-auth", false, "enable workloads mutual authentication using SPIRE")
+	gatewayTier := fs.String("gateway-tier", string(gateway.TierPublicApp), "tier of the rendered gateway")
+	certIssuerName := fs.String("cert-issuer", "letsencrypt", "name of the cert-manager issuer used by the gateway")
+	lbPoolCIDR := fs.String("lb-pool-cidr", "", "CIDR of the load balancer IP pool used by the gateway")
+	var gatewayIPs, domains stringsFlag
+	fs.Var(&gatewayIPs, "gateway-ip", "IP the gateway should be reachable on, can be repeated")
+	fs.Var(&domains, "domain", "domain served by the gateway, can be repeated, defaults to the tier base host")
+	httpRedirect := fs.Bool("http-redirect", true, "redirect plain HTTP requests to HTTPS for all domains")
+	apex := fs.Bool("apex", false, "serve apex domains along with their subdomains for all domains")
+
+	err := fs.Parse(arguments)
+	if err != nil {
+		return renderArgs{}, err
+	}
+
+	args := renderArgs{
+		Dir:         *dir,
+		StateDir:    *stateDir,
+		ClusterName: *clusterName,
+		CNI: cni.CNIArgs{
+			IPFamily:             cni.IPFamily(*ipFamily),
+			IPv4PodCIDR:          *ipv4PodCIDR,
+			IPv6PodCIDR:          *ipv6PodCIDR,
+			MutualAuthentication: *mutualAuth,
+		},
+		Gateway: gateway.TierArgs{
+			Tier:           gateway.Tier(*gatewayTier),
+			CertIssuerName: *certIssuerName,
+		},
+	}
+
+	for _, d := range domains {
+		args.Gateway.Domains = append(args.Gateway.Domains, gateway.DomainArgs{
+			Name:         d,
+			HTTPRedirect: *httpRedirect,
+			Apex:         *apex,
+		})
+	}
+
+	for _, c := range strings.Split(*components, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !slices.Contains(availableComponents, c) {
+			return renderArgs{}, fmt.Errorf("unknown component %q, available components are %s", c, strings.Join(availableComponents, ", "))
+		}
+		args.Components = append(args.Components, c)
+	}
+	if len(args.Components) == 0 {
+		return renderArgs{}, fmt.Errorf("at least one component must be rendered")
+	}
+
+	for _, ip := range gatewayIPs {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return renderArgs{}, fmt.Errorf("invalid gateway IP %q", ip)
+		}
+		args.Gateway.GatewayIPs = append(args.Gateway.GatewayIPs, parsed)
+	}
+
+	if slices.Contains(args.Components, componentGateway) {
+		if *lbPoolCIDR == "" {
+			return renderArgs{}, fmt.Errorf("lb-pool-cidr is required to render the gateway")
+		}
+		_, cidr, err := net.ParseCIDR(*lbPoolCIDR)
+		if err != nil {
+			return renderArgs{}, fmt.Errorf("invalid lb-pool-cidr: %w", err)
+		}
+		args.Gateway.LBPoolCIDR = *cidr
+	}
+
+	return args, nil
+}
+
+// program returns the Pulumi program rendering the requested components.
+func program(args renderArgs) pulumi.RunFunc {
+	return func(ctx *pulumi.Context) error {
+		provider, err := render.NewProvider(ctx, args.Dir)
+		if err != nil {
+			return err
+		}
+		opts := render.Options(provider)
+
+		for _, c := range args.Components {
+			switch c {
+			case componentGatewayAPICRDs:
+				// Rendering has no cluster to read served CRDs from, nor a deployed stack to read the version from
+				_, err = gwapicrds.DeployGatewayAPICRDs(ctx, gwapicrds.GatewayAPICRDsArgs{SkipUpgradeCheck: true}, opts...)
+			case componentPriorityClass:
+				err = priorityclass.CreateDefaultPriorityClasses(ctx, opts...)
+			case componentCNI:
+				_, err = cni.RenderCNI(ctx, args.ClusterName, args.CNI, opts...)
+			case componentGateway:
+				err = gateway.DeployGatewayResources(
+					ctx,
+					[]gateway.TierArgs{args.Gateway},
+					// Rendered tier gateway only, other load balancer services depend on the cluster
+					nil,
+					// L2 announcements only, BGP peering depends on the network
+					nil,
+					opts...,
+				)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to render component %s: %w", c, err)
+			}
+		}
+		return nil
+	}
+}
+
+// run renders the requested components to the output directory, returning an error if any.
+func run(ctx context.Context, args renderArgs) error {
+	stateDir := args.StateDir
+	if stateDir == "" {
+		tmp, err := os.MkdirTemp("", projectName+"-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary state directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		stateDir = tmp
+	} else {
+		err := os.MkdirAll(stateDir, 0o750)
+		if err != nil {
+			return fmt.Errorf("failed to create state directory: %w", err)
+		}
+	}
+
+	stack, err := auto.UpsertStackInlineSource(
+		ctx,
+		stackName,
+		projectName,
+		program(args),
+		auto.Project(workspace.Project{
+			Name:    tokens.PackageName(projectName),
+			Runtime: workspace.NewProjectRuntimeInfo("go", nil),
+			Backend: &workspace.ProjectBackend{
+				URL: "file://" + stateDir,
+			},
+		}),
+		auto.EnvVars(map[string]string{
+			// State only holds rendering results, no secret is involved
+			"PULUMI_CONFIG_PASSPHRASE": "",
+			"PULUMI_SKIP_UPDATE_CHECK": "true",
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create render stack: %w", err)
+	}
+
+	_, err = stack.Up(ctx, optup.ProgressStreams(os.Stderr))
+	if err != nil {
+		return fmt.Errorf("failed to render manifests: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+repo-import generates repository catalogue entries and a Pulumi import file for repositories that
+already exist in a GitHub organization but are not in the catalogue yet.
+
+Entries are printed to standard output, to be appended to the catalogue repositories, and are
+marked to be imported on next update. Repositories without a description, which the catalogue
+requires, are skipped and reported, to be described on GitHub before running again. The import file can be used instead, using
+`pulumi import --file`.
+
+Usage:
+
+	GITHUB_TOKEN=... repo-import -org kemadev -catalogue deploy/github/30-repo/repositories.yaml \
+		-project github-com-kemadev-infrastructure-components-deploy-github-30-repo \
+		-import-file dist/import.json -provider-urn '<provider urn>'
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kemadev/go-framework/pkg/log"
+	"github.com/kemadev/infrastructure-components/pkg/github/repo"
+	"gopkg.in/yaml.v3"
+)
+
+// importArgs contains the arguments used to generate catalogue entries.
+type importArgs struct {
+	// Org is the GitHub organization to list repositories of.
+	Org string
+	// Catalogue is the path of the repository catalogue file.
+	Catalogue string
+	// Project is the name of the Pulumi project managing repositories.
+	Project string
+	// ImportFile is the path of the Pulumi import file to write, not written if empty.
+	ImportFile string
+	// ProviderURN is the URN of the GitHub provider of the Pulumi project.
+	ProviderURN string
+	// APIURL is the URL of the GitHub REST API.
+	APIURL string
+}
+
+func main() {
+	logger := log.CreateFallbackLogger()
+
+	args, err := parseArgs(os.Args[1:])
+	if err != nil {
+		logger.Error(
+			"repo-import",
+			slog.String("Body", "invalid arguments"),
+			slog.String("error.message", err.Error()),
+		)
+		os.Exit(2)
+	}
+
+	count, skipped, err := run(context.Background(), args)
+	if err != nil {
+		logger.Error(
+			"repo-import",
+			slog.String("Body", "import failure"),
+			slog.String("error.message", err.Error()),
+		)
+		os.Exit(1)
+	}
+
+	for _, name := range skipped {
+		logger.Warn(
+			"repo-import",
+			slog.String("Body", "repository skipped, description is required"),
+			slog.String("repository", name),
+		)
+	}
+	logger.Info(
+		"repo-import",
+		slog.String("Body", "catalogue entries generated"),
+		slog.Int("count", count),
+	)
+}
+
+// parseArgs parses command line arguments, returning the import arguments and an error if any.
+func parseArgs(arguments []string) (importArgs, error) {
+	fs := flag.NewFlagSet("repo-import", flag.ContinueOnError)
+	org := fs.String("org", "kemadev", "GitHub organization to list repositories of")
+	catalogue := fs.String("catalogue", "", "path of the repository catalogue file")
+	project := fs.String("project", "", "name of the Pulumi project managing repositories")
+	importFile := fs.String("import-file", "", "path of the Pulumi import file to write, not written if empty")
+	providerURN := fs.String("provider-urn", "", "URN of the GitHub provider of the Pulumi project")
+	apiURL := fs.String("api-url", "https://api.github.com", "URL of the GitHub REST API")
+	err := fs.Parse(arguments)
+	if err != nil {
+		return importArgs{}, fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if *catalogue == "" {
+		return importArgs{}, fmt.Errorf("-catalogue is required")
+	}
+	if *importFile != "" && *project == "" {
+		return importArgs{}, fmt.Errorf("-project is required to write an import file")
+	}
+	return importArgs{
+		Org:         *org,
+		Catalogue:   *catalogue,
+		Project:     *project,
+		ImportFile:  *importFile,
+		ProviderURN: *providerURN,
+		APIURL:      *apiURL,
+	}, nil
+}
+
+// run generates catalogue entries of repositories missing from the catalogue, returning their count, the names of
+// skipped repositories and an error if any.
+func run(ctx context.Context, args importArgs) (int, []string, error) {
+	catalogue, err := repo.LoadCatalogue(args.Catalogue)
+	if err != nil {
+		return 0, nil, err
+	}
+	existing, err := repo.ListOrgRepositories(
+		ctx,
+		&http.Client{Timeout: 30 * time.Second},
+		args.APIURL,
+		args.Org,
+		os.Getenv("GITHUB_TOKEN"),
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	entries, skipped := repo.ImportEntries(catalogue, existing)
+	if len(entries) == 0 {
+		return 0, skipped, nil
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	err = encoder.Encode(entries)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to write catalogue entries: %w", err)
+	}
+	err = encoder.Close()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to write catalogue entries: %w", err)
+	}
+
+	if args.ImportFile != "" {
+		content, err := json.MarshalIndent(repo.NewImportFile(args.Project, entries, args.ProviderURN), "", "  ")
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to encode import file: %w", err)
+		}
+		err = os.WriteFile(args.ImportFile, append(content, '\n'), 0o644)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to write import file: %w", err)
+		}
+	}
+	return len(entries), skipped, nil
+}
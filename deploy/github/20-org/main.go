@@ -5,57 +5,16 @@ import (
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+// configPath is the path of the organization configuration file, relative to the project directory.
+const configPath = "org.yaml"
+
 func main() {
 	pulumi.Run(func(ctx *pulumi.Context) error {
-		err := org.Wrapper(ctx, org.WrapperArgs{
-			Settings: org.SettingsArgs{
-				Company:      "kemadev",
-				Description:  "Making cloud infrastructure a breeze!",
-				Email:        "contact@kema.dev",
-				BillingEmail: "billing@kema.dev",
-				Blog:         "https://www.kema.dev",
-				Location:     "France",
-			},
-			Members: org.MembersArgs{
-				Members: []org.User{
-					{
-						Username: "kema-dev",
-						Role:     "admin",
-					},
-				},
-			},
-			Teams: org.TeamsArgs{
-				Teams: []org.TeamArgs{
-					{
-						Name: org.AdminTeamName,
-						Members: []org.TeamMemberArgs{
-							{
-								Username: "kema-dev",
-								Role:     "maintainer",
-							},
-						},
-					},
-					{
-						Name: org.MaintainersTeamName,
-						Members: []org.TeamMemberArgs{
-							{
-								Username: "kema-dev",
-								Role:     "maintainer",
-							},
-						},
-					},
-					{
-						Name: org.DevelopersTeamName,
-						Members: []org.TeamMemberArgs{
-							{
-								Username: "kema-dev",
-								Role:     "maintainer",
-							},
-						},
-					},
-				},
-			},
-		})
+		args, err := org.LoadWrapperArgs(configPath)
+		if err != nil {
+			return err
+		}
+		err = org.Wrapper(ctx, args)
 		if err != nil {
 			return err
 		}
@@ -8,7 +8,7 @@ import (
 
 type ActionsArgs struct {
 	// Actions is a list of GitHub Actions patterns that are allowed to run in the organization.
-	Actions []string
+	Actions []string `yaml:"actions"`
 }
 
 // ActionsDefaultActions is the default list of GitHub Actions patterns that are allowed to run in the organization.
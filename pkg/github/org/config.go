@@ -0,0 +1,178 @@
+package org
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A configError is a validation error of a configuration field.
+type configError struct {
+	// path is the path of the field, e.g. teams[0].members[1].username.
+	path string
+	err  error
+}
+
+func (e *configError) Error() string {
+	return e.path + ": " + e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// fieldErrorf returns a validation error of the field at path.
+func fieldErrorf(path string, format string, a ...any) error {
+	return &configError{path: path, err: fmt.Errorf(format, a...)}
+}
+
+// LoadWrapperArgs reads the organization configuration file at path, and returns the corresponding arguments and an
+// error if any. The file is either YAML or JSON, following schema/github-org.schema.json.
+func LoadWrapperArgs(path string) (WrapperArgs, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return WrapperArgs{}, fmt.Errorf("failed to read organization config file: %w", err)
+	}
+	return ParseWrapperArgs(path, content)
+}
+
+// ParseWrapperArgs decodes the organization configuration content, YAML or JSON, and validates it, returning the
+// corresponding arguments and an error if any. Unknown fields are rejected, and errors are prefixed with the name of
+// the configuration and the line of the offending field.
+func ParseWrapperArgs(name string, content []byte) (WrapperArgs, error) {
+	root := yaml.Node{}
+	err := yaml.Unmarshal(content, &root)
+	if err != nil {
+		return WrapperArgs{}, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	args := WrapperArgs{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&args)
+	if errors.Is(err, io.EOF) {
+		return WrapperArgs{}, fmt.Errorf("%s is empty", name)
+	}
+	if err != nil {
+		return WrapperArgs{}, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	err = validateWrapperArgs(args)
+	var fieldErr *configError
+	if errors.As(err, &fieldErr) {
+		return WrapperArgs{}, fmt.Errorf("%s:%d: %w", name, lineOf(nodeLines(&root), fieldErr.path), err)
+	}
+	if err != nil {
+		return WrapperArgs{}, fmt.Errorf("error validating %s: %w", name, err)
+	}
+	return args, nil
+}
+
+// nodeLines returns the line of each field of the document, keyed by path.
+func nodeLines(root *yaml.Node) map[string]int {
+	lines := map[string]int{}
+	var walk func(n *yaml.Node, path string)
+	walk = func(n *yaml.Node, path string) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				lines[key] = n.Content[i].Line
+				walk(n.Content[i+1], key)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				p := path + "[" + strconv.Itoa(i) + "]"
+				lines[p] = c.Line
+				walk(c, p)
+			}
+		}
+	}
+	walk(root, "")
+	return lines
+}
+
+// lineOf returns the line of the field at path, or of its closest declared parent, e.g. for missing required fields.
+func lineOf(lines map[string]int, path string) int {
+	for path != "" {
+		line, ok := lines[path]
+		if ok {
+			return line
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 1
+}
+
+// validateWrapperArgs validates the organization configuration, returning a configError if any field is invalid.
+func validateWrapperArgs(args WrapperArgs) error {
+	if args.GitHubPlan != "" && !slices.Contains([]string{"free", "team", "enterprise"}, args.GitHubPlan) {
+		return fieldErrorf("gitHubPlan", "plan %q is invalid", args.GitHubPlan)
+	}
+
+	required := []struct {
+		field string
+		value string
+	}{
+		{field: "billingEmail", value: args.Settings.BillingEmail},
+		{field: "blog", value: args.Settings.Blog},
+		{field: "company", value: args.Settings.Company},
+		{field: "description", value: args.Settings.Description},
+		{field: "email", value: args.Settings.Email},
+		{field: "location", value: args.Settings.Location},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			return fieldErrorf("settings."+r.field, "%s is required", r.field)
+		}
+	}
+
+	if args.Members.OffboardingMode != "" &&
+		!slices.Contains([]string{OffboardingModeReportOnly, OffboardingModeEnforce}, args.Members.OffboardingMode) {
+		return fieldErrorf("offboardingMode", "mode %q is invalid", args.Members.OffboardingMode)
+	}
+	usernames := map[string]bool{}
+	userLists := []struct {
+		field string
+		users []User
+	}{
+		{field: "members", users: args.Members.Members},
+		{field: "admins", users: args.Members.Admins},
+	}
+	for _, l := range userLists {
+		for i, u := range l.users {
+			path := l.field + "[" + strconv.Itoa(i) + "]"
+			if u.Username == "" {
+				return fieldErrorf(path+".username", "username is required")
+			}
+			if usernames[u.Username] {
+				return fieldErrorf(path+".username", "member %s is declared more than once", u.Username)
+			}
+			usernames[u.Username] = true
+			if l.field == "members" && !slices.Contains([]string{"member", "admin"}, u.Role) {
+				return fieldErrorf(path+".role", "role %q is invalid, must be member or admin", u.Role)
+			}
+		}
+	}
+
+	_, err := checkDeclaredTeams(args.Teams.Teams, args.Members)
+	return err
+}
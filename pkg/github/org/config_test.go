@@ -0,0 +1,123 @@
+package org
+
+import (
+	"strings"
+	"testing"
+)
+
+const configBase = `settings:
+  billingEmail: billing@example.com
+  blog: https://example.com
+  company: Example
+  description: Example organization
+  email: contact@example.com
+  location: Paris
+members:
+  - username: alice
+    role: admin
+  - username: bob
+    role: member
+`
+
+func TestParseWrapperArgsTeams(t *testing.T) {
+	tests := []struct {
+		name    string
+		teams   string
+		wantErr string
+	}{
+		{
+			name: "valid nested teams",
+			teams: `teams:
+  - name: platform
+    members:
+      - username: alice
+        role: maintainer
+    teams:
+      - name: network
+        members:
+          - username: bob
+            role: member
+`,
+		},
+		{
+			name: "duplicate slug",
+			teams: `teams:
+  - name: Platform Team
+  - name: platform-team
+`,
+			wantErr: "config.yaml:15: teams[1].name: Team platform-team is declared more than once",
+		},
+		{
+			name: "invalid privacy",
+			teams: `teams:
+  - name: platform
+    privacy: public
+`,
+			wantErr: "config.yaml:15: teams[0].privacy:",
+		},
+		{
+			name: "nested secret team",
+			teams: `teams:
+  - name: platform
+    teams:
+      - name: network
+        privacy: secret
+`,
+			wantErr: "config.yaml:17: teams[0].teams[0].privacy:",
+		},
+		{
+			name: "nested team with parent",
+			teams: `teams:
+  - name: platform
+    teams:
+      - name: network
+        parentTeam: other
+`,
+			wantErr: "config.yaml:17: teams[0].teams[0].parentTeam:",
+		},
+		{
+			name: "child of declared secret team",
+			teams: `teams:
+  - name: platform
+    privacy: secret
+  - name: network
+    parentTeam: platform
+`,
+			wantErr: "config.yaml:17: teams[1].parentTeam: Team network parent platform is secret",
+		},
+		{
+			name: "team member not organization member",
+			teams: `teams:
+  - name: platform
+    members:
+      - username: carol
+        role: member
+`,
+			wantErr: "config.yaml:16: teams[0].members[0].username:",
+		},
+		{
+			name: "team member invalid role",
+			teams: `teams:
+  - name: platform
+    members:
+      - username: bob
+        role: owner
+`,
+			wantErr: "config.yaml:17: teams[0].members[0].role:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWrapperArgs("config.yaml", []byte(configBase+tt.teams))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseWrapperArgs() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseWrapperArgs() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,37 +1,173 @@
 package org
 
 import (
+	"fmt"
+	"slices"
+
 	"github.com/kemadev/infrastructure-components/pkg/util"
 	"github.com/pulumi/pulumi-github/sdk/v6/go/github"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+const (
+	// OffboardingModeReportOnly keeps the organization membership of users removed from MembersArgs, reporting them as
+	// undeclared members, so that they can be offboarded manually.
+	OffboardingModeReportOnly = "report-only"
+	// OffboardingModeEnforce removes the organization membership of users removed from MembersArgs.
+	OffboardingModeEnforce = "enforce"
+)
+
+const (
+	// ExportKeyMembers is the stack output key of organization members declared in MembersArgs.
+	ExportKeyMembers = "members"
+	// ExportKeyUndeclaredMembers is the stack output key of organization members that are not declared in MembersArgs.
+	ExportKeyUndeclaredMembers = "undeclaredMembers"
+)
+
 type User struct {
 	// Username is the GitHub username of the user.
-	Username string
+	Username string `yaml:"username"`
 	// Role is the role of the user in the organization. List of available roles can be found in the [documentation].
 	//
 	// [documentation]: https://www.pulumi.com/registry/packages/github/api-docs/membership/#state_role_go
-	Role string
+	Role string `yaml:"role"`
+	// Import indicates whether the existing organization membership of the user should be imported rather than created.
+	// It can be left set once imported.
+	Import bool `yaml:"import"`
 }
 
 type MembersArgs struct {
 	// Members is a list of users to add to the organization.
-	Members []User
-	// Admins is a list of users to add as admins to the organization.
-	Admins []User
-}
-
-func createMembers(ctx *pulumi.Context, provider *github.Provider, argsMembers MembersArgs) error {
-	for _, t := range argsMembers.Members {
-		memberName := util.FormatResourceName(ctx, "Member")
-		_, err := github.NewMembership(ctx, memberName, &github.MembershipArgs{
-			Username: pulumi.String(t.Username),
-			Role:     pulumi.String(t.Role),
-		}, pulumi.Provider(provider))
+	Members []User `yaml:"members"`
+	// Admins is a list of users to add as admins to the organization. Their role is always "admin".
+	Admins []User `yaml:"admins"`
+	// OffboardingMode tells what happens to users removed from Members and Admins, either OffboardingModeReportOnly or
+	// OffboardingModeEnforce. Defaults to OffboardingModeReportOnly. In both modes, users are removed from teams before
+	// their membership is removed or reported, as teams require members to be declared. Declared members are exported
+	// as ExportKeyMembers, so that repository stacks revoke direct collaborator access of removed users, see
+	// repo.MembersFromStack. Repository stacks should then be updated after the organization stack.
+	OffboardingMode string `yaml:"offboardingMode"`
+}
+
+var MembersDefaultArgs = MembersArgs{
+	OffboardingMode: OffboardingModeReportOnly,
+}
+
+func createMembersSetDefaults(args *MembersArgs) error {
+	if args.OffboardingMode == "" {
+		args.OffboardingMode = MembersDefaultArgs.OffboardingMode
+	}
+	if !slices.Contains([]string{OffboardingModeReportOnly, OffboardingModeEnforce}, args.OffboardingMode) {
+		return fmt.Errorf("OffboardingMode %q is invalid", args.OffboardingMode)
+	}
+	// Do not modify the caller's admins
+	args.Admins = slices.Clone(args.Admins)
+	for i := range args.Admins {
+		args.Admins[i].Role = "admin"
+	}
+	usernames := map[string]bool{}
+	for _, u := range slices.Concat(args.Members, args.Admins) {
+		if u.Username == "" {
+			return fmt.Errorf("member Username is required")
+		}
+		if usernames[u.Username] {
+			return fmt.Errorf("member %s is declared more than once", u.Username)
+		}
+		usernames[u.Username] = true
+	}
+	return nil
+}
+
+// allMembers returns the users of Members and Admins.
+func (args MembersArgs) allMembers() []User {
+	return slices.Concat(args.Members, args.Admins)
+}
+
+// isMember returns true if the user is declared in Members or Admins.
+func (args MembersArgs) isMember(username string) bool {
+	return slices.ContainsFunc(args.allMembers(), func(u User) bool { return u.Username == username })
+}
+
+// createMembers creates the organization membership of each member, keyed by username, exports declared members, and
+// reports organization members that are not declared. It returns the created memberships, keyed by username.
+func createMembers(
+	ctx *pulumi.Context,
+	provider *github.Provider,
+	owner string,
+	argsMembers MembersArgs,
+) (map[string]*github.Membership, error) {
+	err := createMembersSetDefaults(&argsMembers)
+	if err != nil {
+		return nil, err
+	}
+	memberships := map[string]*github.Membership{}
+	usernames := []string{}
+	for i, u := range argsMembers.allMembers() {
+		opts := []pulumi.ResourceOption{
+			pulumi.Provider(provider),
+			// Keep membership of removed users, which are reported instead
+			pulumi.RetainOnDelete(argsMembers.OffboardingMode == OffboardingModeReportOnly),
+		}
+		if i == 0 && len(argsMembers.Members) > 0 {
+			// Memberships used to share a single name, only allowing one member, so that the first member keeps its
+			// existing membership instead of it being deleted
+			opts = append(opts, pulumi.Aliases([]pulumi.Alias{
+				{Name: pulumi.String(util.FormatResourceName(ctx, "Member"))},
+			}))
+		}
+		if u.Import {
+			opts = append(opts, pulumi.Import(pulumi.ID(owner+":"+u.Username)))
+		}
+		memberName := util.FormatResourceName(ctx, "Member "+u.Username)
+		membership, err := github.NewMembership(ctx, memberName, &github.MembershipArgs{
+			Username: pulumi.String(u.Username),
+			Role:     pulumi.String(u.Role),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		memberships[u.Username] = membership
+		usernames = append(usernames, u.Username)
+	}
+	slices.Sort(usernames)
+	ctx.Export(ExportKeyMembers, pulumi.ToStringArray(usernames))
+	err = reportUndeclaredMembers(ctx, provider, owner, argsMembers)
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// reportUndeclaredMembers warns about and exports organization members that are not declared, e.g. users pending
+// offboarding in OffboardingModeReportOnly, or members added outside of Pulumi.
+func reportUndeclaredMembers(
+	ctx *pulumi.Context,
+	provider *github.Provider,
+	owner string,
+	argsMembers MembersArgs,
+) error {
+	org, err := github.GetOrganization(ctx, &github.GetOrganizationArgs{
+		Name: owner,
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return fmt.Errorf("failed to read organization members: %w", err)
+	}
+	undeclared := []string{}
+	for _, m := range org.Members {
+		if !argsMembers.isMember(m) {
+			undeclared = append(undeclared, m)
+		}
+	}
+	slices.Sort(undeclared)
+	for _, m := range undeclared {
+		err := ctx.Log.Warn(
+			fmt.Sprintf("organization member %s is not declared, offboard them or declare them", m),
+			nil,
+		)
 		if err != nil {
 			return err
 		}
 	}
+	ctx.Export(ExportKeyUndeclaredMembers, pulumi.ToStringArray(undeclared))
 	return nil
 }
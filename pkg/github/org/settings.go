@@ -10,17 +10,17 @@ import (
 
 type SettingsArgs struct {
 	// BillingEmail is the email address for billing notifications.
-	BillingEmail string
+	BillingEmail string `yaml:"billingEmail"`
 	// Blog is the URL of the organization's blog.
-	Blog string
+	Blog string `yaml:"blog"`
 	// Company is the name of the comany running the organization.
-	Company string
+	Company string `yaml:"company"`
 	// Description is a short description of the organization.
-	Description string
+	Description string `yaml:"description"`
 	// Email is the email address for the organization.
-	Email string
+	Email string `yaml:"email"`
 	// Location is the location of the organization.
-	Location string
+	Location string `yaml:"location"`
 }
 
 var SettingsDefaultArgs = SettingsArgs{}
@@ -2,6 +2,11 @@ package org
 
 import (
 	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/kemadev/infrastructure-components/pkg/util"
 	"github.com/pulumi/pulumi-github/sdk/v6/go/github"
@@ -10,33 +15,49 @@ import (
 
 type TeamMemberArgs struct {
 	// Username is the GitHub username of the team member.
-	Username string
+	Username string `yaml:"username"`
 	// Role is the role of the team member in the team. List of available roles can be found in the [documentation].
 	//
 	// [documentation]: https://www.pulumi.com/registry/packages/github/api-docs/membership/#state_role_go
-	Role string
+	Role string `yaml:"role"`
 }
 
 type TeamArgs struct {
 	// Name is the name of the team.
-	Name string
+	Name string `yaml:"name"`
 	// Description is a short description of the team.
-	Description string
-	// Privacy is the privacy setting of the team. List of available privacy settings can be found in the [documentation].
+	Description string `yaml:"description"`
+	// Privacy is the privacy setting of the team, either TeamPrivacyClosed or TeamPrivacySecret. Defaults to
+	// TeamPrivacyClosed. Secret teams cannot be nested. List of available privacy settings can be found in the
+	// [documentation].
 	//
 	// [documentation]: https://www.pulumi.com/registry/packages/github/api-docs/team/#privacy_go
-	Privacy string
-	// ParentTeam is the ID or slug of the parent team. If not set, the team will be a top-level team.
-	ParentTeam string
+	Privacy string `yaml:"privacy"`
+	// ParentTeam is the name, slug or ID of the parent team, either declared or existing in the organization. If not
+	// set, the team will be a top-level team, unless nested in Teams of its parent.
+	ParentTeam string `yaml:"parentTeam"`
 	// Members is a list of team members.
-	Members []TeamMemberArgs
+	Members []TeamMemberArgs `yaml:"members"`
+	// Teams is a list of child teams, nested in the team.
+	Teams []TeamArgs `yaml:"teams"`
 }
 
 type TeamsArgs struct {
 	// Teams is a list of teams to create in the organization.
-	Teams []TeamArgs
+	Teams []TeamArgs `yaml:"teams"`
 }
 
+const (
+	// TeamPrivacyClosed makes the team visible to all organization members.
+	TeamPrivacyClosed = "closed"
+	// TeamPrivacySecret makes the team only visible to its members and organization owners.
+	TeamPrivacySecret = "secret"
+)
+
+// ExportKeyTeamIDs is the stack output key of the IDs of declared teams, keyed by slug, e.g. to be read by repository
+// stacks using a stack reference.
+const ExportKeyTeamIDs = "teamIds"
+
 const (
 	// AdminTeamName is the name of the team with full access everywhere.
 	AdminTeamName = "admins"
@@ -92,51 +113,212 @@ func createTeamsSetDefaults(args *TeamsArgs) {
 	}
 }
 
-func checkTeamMembersAreMembers(argsTeams TeamsArgs, argsMembers MembersArgs) error {
-	for _, t := range argsTeams.Teams {
-		if t.Members != nil {
-			for _, m := range t.Members {
-				found := false
-				for _, member := range argsMembers.Members {
-					if m.Username == member.Username {
-						found = true
-						break
-					}
-				}
-				if !found {
-					return fmt.Errorf(
-						"Team member %s in team %s is not also set to be an organization member",
-						m.Username,
-						t.Name,
-					)
-				}
+// nonSlugRegexp matches runs of characters GitHub replaces with a hyphen in team slugs.
+var nonSlugRegexp = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// TeamSlug returns the slug GitHub derives from the team name, e.g. "Platform Team" becomes "platform-team".
+func TeamSlug(name string) string {
+	return strings.Trim(nonSlugRegexp.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// A flatTeam is a declared team along with the reference of its parent team, empty for top-level teams.
+type flatTeam struct {
+	TeamArgs
+	parent string
+	// nested is true if the team is declared in Teams of its parent.
+	nested bool
+	// path is the configuration path of the team, e.g. teams[0].teams[1].
+	path string
+}
+
+// flattenTeams returns the declared teams at path, parents first, with nested teams referencing their parent by name.
+func flattenTeams(teams []TeamArgs, parent string, path string) []flatTeam {
+	flat := []flatTeam{}
+	for i, t := range teams {
+		ref := t.ParentTeam
+		if parent != "" {
+			ref = parent
+		}
+		teamPath := path + "[" + strconv.Itoa(i) + "]"
+		flat = append(flat, flatTeam{TeamArgs: t, parent: ref, nested: parent != "", path: teamPath})
+		flat = append(flat, flattenTeams(t.Teams, t.Name, teamPath+".teams")...)
+	}
+	return flat
+}
+
+// checkTeams returns a configError if declared teams are declared more than once, have an invalid privacy, or if
+// secret teams are nested.
+func checkTeams(teams []flatTeam) error {
+	declared := map[string]flatTeam{}
+	for _, t := range teams {
+		slug := TeamSlug(t.Name)
+		if slug == "" {
+			return fieldErrorf(t.path+".name", "Team name %q is invalid", t.Name)
+		}
+		if _, ok := declared[slug]; ok {
+			return fieldErrorf(t.path+".name", "Team %s is declared more than once", t.Name)
+		}
+		declared[slug] = t
+	}
+	for _, t := range teams {
+		if !slices.Contains([]string{TeamPrivacyClosed, TeamPrivacySecret}, t.Privacy) {
+			return fieldErrorf(t.path+".privacy", "Team %s privacy %q is invalid, must be secret or closed", t.Name, t.Privacy)
+		}
+		if t.Privacy == TeamPrivacySecret && (t.parent != "" || len(t.Teams) > 0) {
+			return fieldErrorf(t.path+".privacy", "Team %s is secret and cannot be nested", t.Name)
+		}
+		if t.nested && t.ParentTeam != "" {
+			return fieldErrorf(t.path+".parentTeam", "Team %s is nested and cannot set ParentTeam", t.Name)
+		}
+		parent, ok := declared[TeamSlug(t.parent)]
+		if ok && parent.Privacy == TeamPrivacySecret {
+			return fieldErrorf(
+				t.path+".parentTeam",
+				"Team %s parent %s is secret and cannot have child teams",
+				t.Name,
+				parent.Name,
+			)
+		}
+	}
+	return nil
+}
+
+// orderTeams returns the declared teams ordered so that parents are created before their children, and an error if
+// parent references are cyclic.
+func orderTeams(teams []flatTeam) ([]flatTeam, error) {
+	declared := map[string]bool{}
+	for _, t := range teams {
+		declared[TeamSlug(t.Name)] = true
+	}
+	ordered := []flatTeam{}
+	placed := map[string]bool{}
+	for len(ordered) < len(teams) {
+		progress := false
+		for _, t := range teams {
+			slug := TeamSlug(t.Name)
+			parentSlug := TeamSlug(t.parent)
+			if placed[slug] || (declared[parentSlug] && !placed[parentSlug]) {
+				continue
+			}
+			ordered = append(ordered, t)
+			placed[slug] = true
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("Teams parent references are cyclic")
+		}
+	}
+	return ordered, nil
+}
+
+// checkTeamMembers returns a configError if team members are not also organization members or have an invalid role.
+func checkTeamMembers(teams []flatTeam, argsMembers MembersArgs) error {
+	for _, t := range teams {
+		for i, m := range t.Members {
+			memberPath := t.path + ".members[" + strconv.Itoa(i) + "]"
+			if !argsMembers.isMember(m.Username) {
+				return fieldErrorf(
+					memberPath+".username",
+					"Team member %s in team %s is not also set to be an organization member",
+					m.Username,
+					t.Name,
+				)
+			}
+			if !slices.Contains([]string{"member", "maintainer"}, m.Role) {
+				return fieldErrorf(
+					memberPath+".role",
+					"Team member %s in team %s role %q is invalid, must be member or maintainer",
+					m.Username,
+					t.Name,
+					m.Role,
+				)
 			}
 		}
 	}
 	return nil
 }
 
+// checkDeclaredTeams returns the declared teams flattened, defaulting their privacy, and a configError if any of them
+// is invalid. It is the single source of truth of teams validation, used by both configuration validation and teams
+// creation.
+func checkDeclaredTeams(argsTeams []TeamArgs, argsMembers MembersArgs) ([]flatTeam, error) {
+	teams := flattenTeams(argsTeams, "", "teams")
+	for i := range teams {
+		if teams[i].Privacy == "" {
+			teams[i].Privacy = TeamPrivacyClosed
+		}
+	}
+	err := checkTeams(teams)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTeamMembers(teams, argsMembers)
+	if err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+// resolveParentTeam returns the ID of the parent team referenced by name, slug or ID, looking up teams that are not
+// declared by slug, and an error if any.
+func resolveParentTeam(
+	ctx *pulumi.Context,
+	provider *github.Provider,
+	ref string,
+	created map[string]*github.Team,
+) (pulumi.StringInput, error) {
+	if ref == "" {
+		return pulumi.String(""), nil
+	}
+	parent, ok := created[TeamSlug(ref)]
+	if ok {
+		return parent.ID().ToStringOutput(), nil
+	}
+	_, err := strconv.Atoi(ref)
+	if err == nil {
+		return pulumi.String(ref), nil
+	}
+	team, err := github.LookupTeam(ctx, &github.LookupTeamArgs{
+		Slug: ref,
+	}, pulumi.Provider(provider))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up parent team %s: %w", ref, err)
+	}
+	return pulumi.String(team.Id), nil
+}
+
 func createTeams(
 	ctx *pulumi.Context,
 	provider *github.Provider,
 	argsTeams TeamsArgs,
 	argsMembers MembersArgs,
+	memberships map[string]*github.Membership,
 ) error {
-	err := checkTeamMembersAreMembers(argsTeams, argsMembers)
+	teams, err := checkDeclaredTeams(argsTeams.Teams, argsMembers)
 	if err != nil {
 		return err
 	}
-	for _, t := range argsTeams.Teams {
+	teams, err = orderTeams(teams)
+	if err != nil {
+		return err
+	}
+	created := map[string]*github.Team{}
+	for _, t := range teams {
+		parentTeamID, err := resolveParentTeam(ctx, provider, t.parent, created)
+		if err != nil {
+			return err
+		}
 		teamName := util.FormatResourceName(ctx, "Team "+t.Name)
 		team, err := github.NewTeam(ctx, teamName, &github.TeamArgs{
 			Name:         pulumi.String(t.Name),
 			Description:  pulumi.String(t.Description),
-			Privacy:      pulumi.String("closed"),
-			ParentTeamId: pulumi.String(t.ParentTeam),
+			Privacy:      pulumi.String(t.Privacy),
+			ParentTeamId: parentTeamID,
 		}, pulumi.Provider(provider))
 		if err != nil {
 			return err
 		}
+		created[TeamSlug(t.Name)] = team
 		teamSettingsName := util.FormatResourceName(ctx, "Team "+t.Name+" settings")
 		_, err = github.NewTeamSettings(ctx, teamSettingsName, &github.TeamSettingsArgs{
 			TeamId: team.ID(),
@@ -150,6 +332,12 @@ func createTeams(
 			return err
 		}
 		if t.Members != nil {
+			// Add users to teams once they are organization members. Removed users are stripped from teams first, as Pulumi
+			// deletes their membership at the end of the update
+			var teamMemberships []pulumi.Resource
+			for _, m := range t.Members {
+				teamMemberships = append(teamMemberships, memberships[m.Username])
+			}
 			teamMembersName := util.FormatResourceName(ctx, "Team "+t.Name+" members")
 			_, err = github.NewTeamMembers(ctx, teamMembersName, &github.TeamMembersArgs{
 				TeamId: team.ID(),
@@ -163,11 +351,27 @@ func createTeams(
 					}
 					return members
 				}(),
-			}, pulumi.Provider(provider))
+			}, pulumi.Provider(provider), pulumi.DependsOn(teamMemberships))
 			if err != nil {
 				return err
 			}
 		}
 	}
+	exportTeamIDs(ctx, created)
 	return nil
 }
+
+// exportTeamIDs exports the IDs of created teams, keyed by their slug as returned by GitHub.
+func exportTeamIDs(ctx *pulumi.Context, created map[string]*github.Team) {
+	outputs := []any{}
+	for _, slug := range slices.Sorted(maps.Keys(created)) {
+		outputs = append(outputs, created[slug].Slug, created[slug].ID())
+	}
+	ctx.Export(ExportKeyTeamIDs, pulumi.All(outputs...).ApplyT(func(values []any) map[string]string {
+		ids := map[string]string{}
+		for i := 0; i+1 < len(values); i += 2 {
+			ids[values[i].(string)] = string(values[i+1].(pulumi.ID))
+		}
+		return ids
+	}).(pulumi.StringMapOutput))
+}
@@ -7,17 +7,17 @@ import (
 
 type WrapperArgs struct {
 	// Provider is the GitHub provider configuration.
-	Provider p.ProviderArgs
+	Provider p.ProviderArgs `yaml:"provider"`
 	// Settings contains the settings for the organization.
-	Settings SettingsArgs
+	Settings SettingsArgs `yaml:"settings"`
 	// Teams contains the teams to create in the organization.
-	Teams TeamsArgs
+	Teams TeamsArgs `yaml:",inline"`
 	// Actions contains the GitHub Actions patterns that are allowed to run in the organization.
-	Actions ActionsArgs
+	Actions ActionsArgs `yaml:",inline"`
 	// Members contains the members to add to the organization.
-	Members MembersArgs
+	Members MembersArgs `yaml:",inline"`
 	// GitHubPlan is the GitHub plan subscribed for the organization. It is used to determine whether to create resources for paid features. Default to "free".
-	GitHubPlan string
+	GitHubPlan string `yaml:"gitHubPlan"`
 }
 
 func setDefaultArgs(args *WrapperArgs) {
@@ -41,11 +41,11 @@ func Wrapper(ctx *pulumi.Context, args WrapperArgs) error {
 	if err != nil {
 		return err
 	}
-	err = createMembers(ctx, provider, args.Members)
+	memberships, err := createMembers(ctx, provider, args.Provider.Owner, args.Members)
 	if err != nil {
 		return err
 	}
-	err = createTeams(ctx, provider, args.Teams, args.Members)
+	err = createTeams(ctx, provider, args.Teams, args.Members, memberships)
 	if err != nil {
 		return err
 	}
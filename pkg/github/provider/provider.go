@@ -8,7 +8,7 @@ import (
 
 type ProviderArgs struct {
 	// Owner is the GitHub organization owner (i.e. organization name).
-	Owner string
+	Owner string `yaml:"owner"`
 }
 
 var ProviderDefaultArgs = ProviderArgs{
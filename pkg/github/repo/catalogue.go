@@ -0,0 +1,230 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A CatalogueEntry contains repository settings of the catalogue, either defaults, a profile or a repository. Unset
+// fields are inherited from the extended profile, then from catalogue defaults.
+type CatalogueEntry struct {
+	// Extends is the name of the profile the entry inherits settings from. Profiles may themselves extend a profile.
+	Extends string `yaml:"extends,omitempty"`
+	// Description is a short description of the repository.
+	Description string `yaml:"description,omitempty"`
+	// HomepageUrl is the URL of the repository's homepage.
+	HomepageUrl string `yaml:"homepageUrl,omitempty"`
+	// Visibility is the visibility of the repository.
+	Visibility string `yaml:"visibility,omitempty"`
+	// Topics are topics to associate with the repository, added to inherited ones.
+	Topics []string `yaml:"topics,omitempty"`
+	// Archived indicates whether the repository should be archived.
+	Archived *bool `yaml:"archived,omitempty"`
+	// IsTemplate indicates whether the repository is a template repository.
+	IsTemplate *bool `yaml:"isTemplate,omitempty"`
+	// Teams are teams to add as collaborators to the repository, overriding inherited roles of the same teams.
+	Teams []Team `yaml:"teams,omitempty"`
+	// DirectMembers are direct members to add to the repository, overriding inherited roles of the same users.
+	DirectMembers []DirectMember `yaml:"directMembers,omitempty"`
+	// Rulesets contains the settings for rulesets in the repository, set fields overriding inherited ones.
+	Rulesets *RulesetsArgs `yaml:"rulesets,omitempty"`
+	// Envs contains the settings for environments in the repository, set fields overriding inherited ones.
+	Envs *EnvsArgs `yaml:"environments,omitempty"`
+}
+
+// A CatalogueRepository is a repository of the catalogue.
+type CatalogueRepository struct {
+	// Name is the name of the repository.
+	Name string `yaml:"name"`
+	// CatalogueEntry contains the repository settings.
+	CatalogueEntry `yaml:",inline"`
+	// Import indicates whether the existing repository should be imported rather than created.
+	Import bool `yaml:"import,omitempty"`
+}
+
+// A Catalogue is a declarative list of the organization repositories, e.g.
+//
+//	defaults:
+//	  visibility: private
+//	profiles:
+//	  public:
+//	    visibility: public
+//	  public-go-library:
+//	    extends: public
+//	    topics: [go, library]
+//	repositories:
+//	  - name: go-framework
+//	    extends: public-go-library
+//	    description: Go framework, ensuring best practices and security
+type Catalogue struct {
+	// Defaults are settings shared by all repositories.
+	Defaults CatalogueEntry `yaml:"defaults,omitempty"`
+	// Profiles are named settings repositories and other profiles can extend.
+	Profiles map[string]CatalogueEntry `yaml:"profiles,omitempty"`
+	// Repositories are the repositories of the organization.
+	Repositories []CatalogueRepository `yaml:"repositories"`
+}
+
+// LoadCatalogue reads the repository catalogue file at path, returning it and an error if any. Unknown fields are
+// rejected.
+func LoadCatalogue(path string) (Catalogue, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Catalogue{}, fmt.Errorf("failed to read repository catalogue file: %w", err)
+	}
+	catalogue := Catalogue{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&catalogue)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Catalogue{}, fmt.Errorf("failed to decode repository catalogue file %s: %w", path, err)
+	}
+	return catalogue, nil
+}
+
+// mergeEntry returns the base entry overridden by set fields of the override entry.
+func mergeEntry(base CatalogueEntry, override CatalogueEntry) CatalogueEntry {
+	merged := base
+	merged.Extends = ""
+	if override.Description != "" {
+		merged.Description = override.Description
+	}
+	if override.HomepageUrl != "" {
+		merged.HomepageUrl = override.HomepageUrl
+	}
+	if override.Visibility != "" {
+		merged.Visibility = override.Visibility
+	}
+	merged.Topics = slices.Clone(base.Topics)
+	for _, t := range override.Topics {
+		if !slices.Contains(merged.Topics, t) {
+			merged.Topics = append(merged.Topics, t)
+		}
+	}
+	if override.Archived != nil {
+		merged.Archived = override.Archived
+	}
+	if override.IsTemplate != nil {
+		merged.IsTemplate = override.IsTemplate
+	}
+	merged.Teams = slices.Clone(base.Teams)
+	for _, t := range override.Teams {
+		i := slices.IndexFunc(merged.Teams, func(m Team) bool { return m.Name == t.Name })
+		if i < 0 {
+			merged.Teams = append(merged.Teams, t)
+			continue
+		}
+		merged.Teams[i] = t
+	}
+	merged.DirectMembers = slices.Clone(base.DirectMembers)
+	for _, d := range override.DirectMembers {
+		i := slices.IndexFunc(merged.DirectMembers, func(m DirectMember) bool { return m.Username == d.Username })
+		if i < 0 {
+			merged.DirectMembers = append(merged.DirectMembers, d)
+			continue
+		}
+		merged.DirectMembers[i] = d
+	}
+	if override.Rulesets != nil {
+		rulesets := RulesetsArgs{}
+		if base.Rulesets != nil {
+			rulesets = *base.Rulesets
+		}
+		if override.Rulesets.RequiredReviewersMain != 0 {
+			rulesets.RequiredReviewersMain = override.Rulesets.RequiredReviewersMain
+		}
+		if override.Rulesets.RequiredStatusChecks != nil {
+			rulesets.RequiredStatusChecks = override.Rulesets.RequiredStatusChecks
+		}
+		merged.Rulesets = &rulesets
+	}
+	if override.Envs != nil {
+		envs := EnvsArgs{}
+		if base.Envs != nil {
+			envs = *base.Envs
+		}
+		if override.Envs.Dev != "" {
+			envs.Dev = override.Envs.Dev
+		}
+		if override.Envs.Next != "" {
+			envs.Next = override.Envs.Next
+		}
+		if override.Envs.Prod != "" {
+			envs.Prod = override.Envs.Prod
+		}
+		merged.Envs = &envs
+	}
+	return merged
+}
+
+// resolveEntry returns the entry merged with the profiles it extends and catalogue defaults, and an error if it
+// extends an unknown profile or if profiles inheritance is cyclic.
+func (c Catalogue) resolveEntry(entry CatalogueEntry) (CatalogueEntry, error) {
+	chain := []CatalogueEntry{entry}
+	seen := []string{}
+	for name := entry.Extends; name != ""; {
+		if slices.Contains(seen, name) {
+			return CatalogueEntry{}, fmt.Errorf("profile %s inheritance is cyclic: %v", name, append(seen, name))
+		}
+		seen = append(seen, name)
+		profile, ok := c.Profiles[name]
+		if !ok {
+			return CatalogueEntry{}, fmt.Errorf("profile %s is not declared", name)
+		}
+		chain = append(chain, profile)
+		name = profile.Extends
+	}
+	resolved := c.Defaults
+	for _, e := range slices.Backward(chain) {
+		resolved = mergeEntry(resolved, e)
+	}
+	return resolved, nil
+}
+
+// Resolve returns the wrapper arguments of each repository of the catalogue, with inherited settings, and an error if
+// any repository is invalid. Provider and GitHubPlan of returned arguments are left unset.
+func (c Catalogue) Resolve() ([]WrapperArgs, error) {
+	names := map[string]bool{}
+	args := []WrapperArgs{}
+	for i, r := range c.Repositories {
+		if r.Name == "" {
+			return nil, fmt.Errorf("repositories[%d] name is required", i)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("repository %s is declared more than once", r.Name)
+		}
+		names[r.Name] = true
+		entry, err := c.resolveEntry(r.CatalogueEntry)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving repository %s: %w", r.Name, err)
+		}
+		a := WrapperArgs{
+			Repository: RepositoryArgs{
+				Name:          r.Name,
+				Description:   entry.Description,
+				HomepageUrl:   entry.HomepageUrl,
+				Visibility:    entry.Visibility,
+				Topics:        entry.Topics,
+				Archived:      entry.Archived != nil && *entry.Archived,
+				IsTemplate:    entry.IsTemplate != nil && *entry.IsTemplate,
+				Teams:         entry.Teams,
+				DirectMembers: entry.DirectMembers,
+				Import:        r.Import,
+			},
+		}
+		if entry.Rulesets != nil {
+			a.Rulesets = *entry.Rulesets
+		}
+		if entry.Envs != nil {
+			a.Envs = *entry.Envs
+		}
+		args = append(args, a)
+	}
+	return args, nil
+}
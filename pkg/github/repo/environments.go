@@ -8,11 +8,11 @@ import (
 
 type EnvsArgs struct {
 	// Dev is the name of the development environment.
-	Dev string
+	Dev string `yaml:"dev,omitempty"`
 	// Next is the name of the next environment, typically used for staging or pre-production.
-	Next string
+	Next string `yaml:"next,omitempty"`
 	// Prod is the name of the production environment.
-	Prod string
+	Prod string `yaml:"prod,omitempty"`
 }
 
 type TEnvironmentsCreated struct {
@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kemadev/infrastructure-components/pkg/util"
+)
+
+// repositoryResourceType is the Pulumi type token of repositories.
+const repositoryResourceType = "github:index/repository:Repository"
+
+// An ExistingRepository is a repository of the organization, as returned by the GitHub REST API.
+type ExistingRepository struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Homepage    string   `json:"homepage"`
+	Visibility  string   `json:"visibility"`
+	Topics      []string `json:"topics"`
+	Archived    bool     `json:"archived"`
+	IsTemplate  bool     `json:"is_template"`
+}
+
+// ListOrgRepositories returns all repositories of the organization using the GitHub REST API at apiURL, e.g.
+// https://api.github.com, authenticating with token if not empty, and an error if any.
+func ListOrgRepositories(
+	ctx context.Context,
+	client *http.Client,
+	apiURL string,
+	org string,
+	token string,
+) ([]ExistingRepository, error) {
+	repos := []ExistingRepository{}
+	for page := 1; ; page++ {
+		u, err := url.JoinPath(apiURL, "orgs", org, "repos")
+		if err != nil {
+			return nil, fmt.Errorf("failed to build repositories url: %w", err)
+		}
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodGet,
+			u+"?per_page=100&type=all&page="+strconv.Itoa(page),
+			nil,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create repositories request: %w", err)
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repositories: %w", err)
+		}
+		pageRepos := []ExistingRepository{}
+		err = func() error {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("failed to list repositories: unexpected status %s", resp.Status)
+			}
+			return json.NewDecoder(resp.Body).Decode(&pageRepos)
+		}()
+		if err != nil {
+			return nil, fmt.Errorf("error reading repositories page %d: %w", page, err)
+		}
+		repos = append(repos, pageRepos...)
+		if len(pageRepos) < 100 {
+			return repos, nil
+		}
+	}
+}
+
+// ImportEntries returns catalogue entries of existing repositories that are not in the catalogue, sorted by name,
+// marked to be imported. Settings equal to catalogue defaults are omitted. Repositories without a valid description,
+// which the catalogue requires, are skipped, their sorted names being returned along with entries so that they can be
+// reported.
+func ImportEntries(catalogue Catalogue, existing []ExistingRepository) ([]CatalogueRepository, []string) {
+	entries := []CatalogueRepository{}
+	skipped := []string{}
+	for _, e := range existing {
+		if slices.ContainsFunc(catalogue.Repositories, func(r CatalogueRepository) bool { return r.Name == e.Name }) {
+			continue
+		}
+		description := strings.TrimSpace(e.Description)
+		if description == "" || description == "CHANGEME" {
+			skipped = append(skipped, e.Name)
+			continue
+		}
+		entry := CatalogueRepository{
+			Name:   e.Name,
+			Import: true,
+			CatalogueEntry: CatalogueEntry{
+				Description: description,
+				HomepageUrl: e.Homepage,
+			},
+		}
+		if e.Visibility != catalogue.Defaults.Visibility {
+			entry.Visibility = e.Visibility
+		}
+		for _, t := range e.Topics {
+			if !slices.Contains(catalogue.Defaults.Topics, t) {
+				entry.Topics = append(entry.Topics, t)
+			}
+		}
+		if e.Archived {
+			entry.Archived = &e.Archived
+		}
+		if e.IsTemplate {
+			entry.IsTemplate = &e.IsTemplate
+		}
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b CatalogueRepository) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	slices.Sort(skipped)
+	return entries, skipped
+}
+
+// An ImportResource is a resource of a Pulumi import file.
+type ImportResource struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	ID       string `json:"id"`
+	Provider string `json:"provider,omitempty"`
+}
+
+// An ImportFile is a Pulumi import file, see https://www.pulumi.com/docs/iac/adopting-pulumi/import/#bulk-import-operations.
+type ImportFile struct {
+	NameTable map[string]string `json:"nameTable,omitempty"`
+	Resources []ImportResource  `json:"resources"`
+}
+
+// NewImportFile returns the Pulumi import file of the repositories of the entries, for the Pulumi project running
+// Wrapper, using the provider of URN providerURN if not empty.
+func NewImportFile(project string, entries []CatalogueRepository, providerURN string) ImportFile {
+	file := ImportFile{
+		Resources: []ImportResource{},
+	}
+	provider := ""
+	if providerURN != "" {
+		provider = "provider"
+		file.NameTable = map[string]string{
+			provider: providerURN,
+		}
+	}
+	for _, e := range entries {
+		file.Resources = append(file.Resources, ImportResource{
+			Type: repositoryResourceType,
+			// Matches the name given by createRepo, util.FormatResourceName requiring a Pulumi context
+			Name:     util.NameTargetPulumiResource.Truncate(util.KebabCase(project + "-" + e.Name + " Repository")),
+			ID:       e.Name,
+			Provider: provider,
+		})
+	}
+	return file
+}
@@ -2,7 +2,9 @@ package repo
 
 import (
 	"fmt"
+	"slices"
 
+	"github.com/kemadev/infrastructure-components/pkg/github/org"
 	"github.com/kemadev/infrastructure-components/pkg/util"
 	"github.com/pulumi/pulumi-github/sdk/v6/go/github"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
@@ -10,20 +12,24 @@ import (
 
 type DirectMember struct {
 	// Username is the GitHub username of the user to add as a direct member of the repository.
-	Username string
+	Username string `yaml:"username"`
 	// Role is the role of the user in the repository. List of available roles can be found in the [documentation].
 	//
 	// [documentation]: https://www.pulumi.com/registry/packages/github/api-docs/repositorycollaborators/#permission_go
-	Role string
+	Role string `yaml:"role"`
+	// OutsideCollaborator indicates whether the user is not an organization member, so that they are granted access
+	// regardless of WrapperArgs.OrgMembers.
+	OutsideCollaborator bool `yaml:"outsideCollaborator"`
 }
 
 type Team struct {
-	// Name is the name of the team to add as a collaborator to the repository.
-	Name string
+	// Name is the name or slug of the team to add as a collaborator to the repository, resolved to its ID using
+	// WrapperArgs.TeamIDs if set.
+	Name string `yaml:"name"`
 	// Role is the role of the team in the repository. List of available roles can be found in the [documentation].
 	//
 	// [documentation]: https://www.pulumi.com/registry/packages/github/api-docs/repositorycollaborators/#permission_go
-	Role string
+	Role string `yaml:"role"`
 }
 
 type RepositoryArgs struct {
@@ -49,6 +55,9 @@ type RepositoryArgs struct {
 	Teams []Team
 	// DirectMembers is a list of direct members to add to the repository with specific roles.
 	DirectMembers []DirectMember
+	// Import indicates whether the existing repository should be imported rather than created. It can be left set once
+	// imported.
+	Import bool
 }
 
 var RepositoryDefaultArgs = RepositoryArgs{
@@ -81,8 +90,14 @@ func createRepo(
 	argsRepo RepositoryArgs,
 	enablePaidFeatures bool,
 	prefix string,
+	teamIDs pulumi.StringMapInput,
+	orgMembers pulumi.StringArrayInput,
 ) (*github.Repository, error) {
 	repoName := util.FormatResourceName(ctx, prefix+"Repository")
+	opts := []pulumi.ResourceOption{pulumi.Provider(provider), pulumi.IgnoreChanges([]string{"template"})}
+	if argsRepo.Import {
+		opts = append(opts, pulumi.Import(pulumi.ID(argsRepo.Name)))
+	}
 	repo, err := github.NewRepository(ctx, repoName, &github.RepositoryArgs{
 		Name:        pulumi.String(argsRepo.Name),
 		Description: pulumi.String(argsRepo.Description),
@@ -132,7 +147,7 @@ func createRepo(
 			}
 			return nil
 		}(),
-	}, pulumi.Provider(provider), pulumi.IgnoreChanges([]string{"template"}))
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -159,21 +174,12 @@ func createRepo(
 		repoCollaboratorsName,
 		&github.RepositoryCollaboratorsArgs{
 			Repository: repo.Name,
-			Users: func() github.RepositoryCollaboratorsUserArray {
-				var members github.RepositoryCollaboratorsUserArray
-				for _, m := range argsRepo.DirectMembers {
-					members = append(members, &github.RepositoryCollaboratorsUserArgs{
-						Username:   pulumi.String(m.Username),
-						Permission: pulumi.String(m.Role),
-					})
-				}
-				return members
-			}(),
+			Users:      collaboratorUsers(ctx, argsRepo.DirectMembers, orgMembers),
 			Teams: func() github.RepositoryCollaboratorsTeamArray {
 				var teams github.RepositoryCollaboratorsTeamArray
 				for _, t := range argsRepo.Teams {
 					teams = append(teams, &github.RepositoryCollaboratorsTeamArgs{
-						TeamId:     pulumi.String(t.Name),
+						TeamId:     teamID(teamIDs, t.Name),
 						Permission: pulumi.String(t.Role),
 					})
 				}
@@ -187,3 +193,90 @@ func createRepo(
 	}
 	return repo, nil
 }
+
+// teamID returns the ID of the team referenced by name or slug, looked up in teamIDs, keyed by slug, if set, failing
+// when resolved if the team is missing. Otherwise, the slug is returned, which the provider resolves.
+func teamID(teamIDs pulumi.StringMapInput, name string) pulumi.StringInput {
+	slug := org.TeamSlug(name)
+	if teamIDs == nil {
+		return pulumi.String(slug)
+	}
+	return teamIDs.ToStringMapOutput().ApplyT(func(ids map[string]string) (string, error) {
+		id, ok := ids[slug]
+		if !ok {
+			return "", fmt.Errorf("team %s is not declared in the organization", name)
+		}
+		return id, nil
+	}).(pulumi.StringOutput)
+}
+
+// collaboratorUsers returns the direct members to grant access to. If orgMembers is set, direct members that are
+// neither organization members nor outside collaborators are left out with a warning, e.g. offboarded members.
+func collaboratorUsers(
+	ctx *pulumi.Context,
+	directMembers []DirectMember,
+	orgMembers pulumi.StringArrayInput,
+) github.RepositoryCollaboratorsUserArrayInput {
+	if orgMembers == nil {
+		var members github.RepositoryCollaboratorsUserArray
+		for _, m := range directMembers {
+			members = append(members, &github.RepositoryCollaboratorsUserArgs{
+				Username:   pulumi.String(m.Username),
+				Permission: pulumi.String(m.Role),
+			})
+		}
+		return members
+	}
+	return orgMembers.ToStringArrayOutput().ApplyT(func(usernames []string) ([]github.RepositoryCollaboratorsUser, error) {
+		members := []github.RepositoryCollaboratorsUser{}
+		for _, m := range directMembers {
+			if !m.OutsideCollaborator && !slices.Contains(usernames, m.Username) {
+				err := ctx.Log.Warn(
+					fmt.Sprintf("direct member %s is not an organization member, not granting access", m.Username),
+					nil,
+				)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			members = append(members, github.RepositoryCollaboratorsUser{
+				Username:   m.Username,
+				Permission: &m.Role,
+			})
+		}
+		return members, nil
+	}).(github.RepositoryCollaboratorsUserArrayOutput)
+}
+
+// MembersFromStack returns the usernames of the organization members of the referenced organization stack, as
+// exported by org.Wrapper.
+func MembersFromStack(orgStack *pulumi.StackReference) pulumi.StringArrayOutput {
+	return orgStack.GetOutput(pulumi.String(org.ExportKeyMembers)).ApplyT(func(v any) ([]string, error) {
+		raw, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("organization stack output %s is not a list", org.ExportKeyMembers)
+		}
+		usernames := []string{}
+		for _, u := range raw {
+			usernames = append(usernames, fmt.Sprint(u))
+		}
+		return usernames, nil
+	}).(pulumi.StringArrayOutput)
+}
+
+// TeamIDsFromStack returns the IDs of the teams of the referenced organization stack, keyed by slug, as exported by
+// org.Wrapper.
+func TeamIDsFromStack(orgStack *pulumi.StackReference) pulumi.StringMapOutput {
+	return orgStack.GetOutput(pulumi.String(org.ExportKeyTeamIDs)).ApplyT(func(v any) (map[string]string, error) {
+		raw, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("organization stack output %s is not a map", org.ExportKeyTeamIDs)
+		}
+		ids := map[string]string{}
+		for slug, id := range raw {
+			ids[slug] = fmt.Sprint(id)
+		}
+		return ids, nil
+	}).(pulumi.StringMapOutput)
+}
@@ -8,9 +8,9 @@ import (
 
 type RulesetsArgs struct {
 	// RequiredReviewersMain is the number of required reviewers for the main branch.
-	RequiredReviewersMain int
+	RequiredReviewersMain int `yaml:"requiredReviewersMain,omitempty"`
 	// RequiredStatusChecks is a list of required status checks that must pass before merging.
-	RequiredStatusChecks []string
+	RequiredStatusChecks []string `yaml:"requiredStatusChecks,omitempty"`
 }
 
 var RulesetsDefaultArgs = RulesetsArgs{
@@ -17,6 +17,13 @@ type WrapperArgs struct {
 	Repository RepositoryArgs
 	// Provider is the GitHub provider to use for the repository. If provided, ProviderOpts will be ignored.
 	Provider *github.Provider
+	// TeamIDs are the IDs of the organization teams, keyed by slug, used to resolve Repository.Teams, e.g. as returned by
+	// TeamIDsFromStack. Teams are referenced by slug if unset.
+	TeamIDs pulumi.StringMapInput
+	// OrgMembers are the usernames of the organization members, e.g. as returned by MembersFromStack. Direct members
+	// of Repository that are neither organization members nor outside collaborators are not granted access, so that
+	// users removed from the organization lose access. All direct members are granted access if unset.
+	OrgMembers pulumi.StringArrayInput
 	// GitHubPlan is the GitHub plan subscribed for the organization. It is used to determine whether to create resources for paid features. Default to "free".
 	GitHubPlan string
 }
@@ -54,7 +61,7 @@ func Wrapper(ctx *pulumi.Context, args WrapperArgs) error {
 		provider = prov
 	}
 	prefix := args.Repository.Name + " "
-	repo, err := createRepo(ctx, provider, args.Repository, enablePaidFeatures, prefix)
+	repo, err := createRepo(ctx, provider, args.Repository, enablePaidFeatures, prefix, args.TeamIDs, args.OrgMembers)
 	if err != nil {
 		return err
 	}
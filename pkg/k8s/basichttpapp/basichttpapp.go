@@ -16,8 +16,11 @@ import (
 	"github.com/kemadev/go-framework/pkg/route"
 	"github.com/kemadev/infrastructure-components/pkg/k8s/gateway"
 	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/nodeprofile"
 	"github.com/kemadev/infrastructure-components/pkg/k8s/priorityclass"
 	"github.com/kemadev/infrastructure-components/pkg/k8s/pulumilabel"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/topologyspread"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/trafficpolicy"
 	"github.com/kemadev/infrastructure-components/pkg/private/businessunit"
 	"github.com/kemadev/infrastructure-components/pkg/private/complianceframework"
 	"github.com/kemadev/infrastructure-components/pkg/private/costcenter"
@@ -82,8 +85,12 @@ type AppParms struct {
 	RunAsRoot bool
 	// Port is the port on which the application is listening.
 	Port int
-	// HTTPHostnames is the list of hostnames the application is listening on.
+	// HTTPHostnames is the list of hostnames the application is listening on. They must all belong to the same
+	// gateway tier, the application being attached to this tier gateway, see gateway.TierForHost.
 	HTTPHostnames []string
+	// GatewayTiers are the deployed gateway tiers HTTPHostnames are resolved against, only their Tier and Domains being
+	// used. Defaults to tiers serving their base host, see gateway.BaseHostTiers.
+	GatewayTiers []gateway.TierArgs
 	// HTTPRules is the list of HTTPRoute rules to use for the application.
 	HTTPRules pulumi.ArrayInput
 	// HTTPReadTimeout is the HTTP read timeout, in seconds.
@@ -108,8 +115,18 @@ type AppParms struct {
 	MemoryLimitMiB int
 	// MinReplicas is the minimum number of replicas for the pod, used for HPA
 	MinReplicas int
-	// MaxReplicas is the maximum number of replicas for the pod, used for HPA
+	// MaxReplicas is the maximum number of replicas for the pod, used for HPA. It also sizes the namespace
+	// ResourceQuota.
 	MaxReplicas int
+	// QuotaHeadroomPercent is the share of MaxReplicas, in percent, the namespace ResourceQuota allows on top of
+	// MaxReplicas pods, e.g. for rolling updates surge.
+	QuotaHeadroomPercent int
+	// QuotaHard are ResourceQuota hard limits overriding the ones computed from MaxReplicas and resources, e.g.
+	// `{"pods": "30"}`.
+	QuotaHard pulumi.StringMap
+	// LimitRangeLimits are LimitRange limits replacing the ones computed from resources, defaulting and capping
+	// containers resources of the namespace.
+	LimitRangeLimits corev1.LimitRangeItemArray
 	// ProgressDeadlineSeconds is the maximum time in seconds for the deployment to be ready.
 	ProgressDeadlineSeconds int
 	// ImagePullPolicy is the image pull policy to use.
@@ -120,14 +137,42 @@ type AppParms struct {
 	PodTolerations corev1.TolerationArrayInput
 	// NodeSelectors is the node selectors to use for the pod.
 	NodeSelectors pulumi.StringMapInput
+	// NodeProfile is the node pool profile the pods are scheduled on, setting NodeSelectors if unset and appending the
+	// profile tolerations to PodTolerations. Pods are scheduled on any untainted node if empty.
+	NodeProfile nodeprofile.Profile
 	// PriorityClassName is the name of the priority class to use for the pod.
 	PriorityClassName string
-	// TopologySpreadConstraints is the list of topology spread constraints to use for the pod.
+	// TopologySpreadConstraints is the list of topology spread constraints to use for the pod. Computed from
+	// TopologySpread if unset.
 	TopologySpreadConstraints corev1.TopologySpreadConstraintArray
+	// TopologySpread is the topology spread preset of pods, defaulting to topologyspread.PresetBestEffort. It is
+	// validated against MinReplicas and MaxReplicas.
+	TopologySpread topologyspread.Args
+	// TopologySpreadByEnv overrides TopologySpread per runtime environment, keyed by RuntimeEnv, e.g. to use
+	// topologyspread.PresetSingleNodeDev in development.
+	TopologySpreadByEnv map[string]topologyspread.Args
 	// HorizontalPodAutoscalerBehavior is the behavior of the HPA.
 	HorizontalPodAutoscalerBehavior autoscalingv2.HorizontalPodAutoscalerBehaviorPtrInput
 	// HorizontalPodAutoscalerBehaviorMetricSpec is the metric spec for the HPA behavior.
 	HorizontalPodAutoscalerBehaviorMetricSpec autoscalingv2.MetricSpecArray
+	// MutualAuthentication is a boolean indicating if in-cluster clients must be mutually authenticated to reach the
+	// application. It requires cni.CNIArgs.MutualAuthentication to be enabled, and creates a network policy only allowing
+	// traffic from the tier gateway and from authenticated in-cluster workloads.
+	MutualAuthentication bool
+	// MeshGlobalService is a boolean indicating if the service should be global across the cluster mesh, load balancing
+	// traffic to endpoints of all clusters, see https://docs.cilium.io/en/stable/network/clustermesh/services/.
+	MeshGlobalService bool
+	// MeshLocalEndpointsOnly is a boolean indicating if the endpoints of this cluster should not be shared with the
+	// mesh, while still reaching remote endpoints of the global service. Used along with MeshGlobalService.
+	MeshLocalEndpointsOnly bool
+	// EgressGateway is the name of the egress gateway routing the application outbound traffic, giving it a stable
+	// source IP, see egressgateway.EgressGateway. Outbound traffic leaves from the node the pod runs on if empty.
+	EgressGateway string
+	// TrafficPolicy contains the rate limits, request size limits and WAF protecting the application from gateway
+	// traffic. HTTPRules backends referencing the application Service are routed through the policy proxy instead.
+	// Unset timeouts default to the application HTTP ones. Proxy replicas and resources are included in the namespace
+	// ResourceQuota, their limits not exceeding the application ones. The application is not protected if nil.
+	TrafficPolicy *trafficpolicy.TrafficPolicyArgs
 }
 
 var (
@@ -268,6 +313,18 @@ func validateParams(params *AppParms) error {
 	if params.HTTPRules == nil {
 		return fmt.Errorf("HTTPRules cannot be nil")
 	}
+	if len(params.GatewayTiers) == 0 {
+		return fmt.Errorf("GatewayTiers cannot be empty")
+	}
+	for _, t := range params.GatewayTiers {
+		if t.Tier.BaseHost() == "" {
+			return fmt.Errorf("GatewayTiers tier %q is unknown", t.Tier)
+		}
+	}
+	_, err := gatewayTier(params.HTTPHostnames, params.GatewayTiers)
+	if err != nil {
+		return fmt.Errorf("HTTPHostnames are not served by GatewayTiers: %w", err)
+	}
 	if params.HTTPReadTimeout == 0 {
 		return fmt.Errorf("HTTPReadTimeout cannot be zero")
 	}
@@ -298,6 +355,17 @@ func validateParams(params *AppParms) error {
 	if params.MaxReplicas == 0 {
 		return fmt.Errorf("MaxReplicas cannot be zero")
 	}
+	if params.QuotaHeadroomPercent < 0 {
+		return fmt.Errorf("QuotaHeadroomPercent cannot be negative")
+	}
+	for k, v := range params.QuotaHard {
+		if v == nil {
+			return fmt.Errorf("QuotaHard %s cannot be nil", k)
+		}
+	}
+	if params.LimitRangeLimits != nil && len(params.LimitRangeLimits) == 0 {
+		return fmt.Errorf("LimitRangeLimits cannot be empty, leave it nil to compute limits from resources")
+	}
 	if params.ProgressDeadlineSeconds == 0 {
 		return fmt.Errorf("ProgressDeadlineSeconds cannot be zero")
 	}
@@ -313,18 +381,51 @@ func validateParams(params *AppParms) error {
 	// if params.NodeSelectors == nil {
 	// 	return fmt.Errorf("NodeSelectors cannot be nil")
 	// }
+	if params.NodeProfile != "" {
+		err = params.NodeProfile.Validate()
+		if err != nil {
+			return fmt.Errorf("error validating NodeProfile: %w", err)
+		}
+	}
 	if params.PriorityClassName == "" {
 		return fmt.Errorf("PriorityClassName cannot be empty")
 	}
 	if params.TopologySpreadConstraints == nil {
 		return fmt.Errorf("TopologySpreadConstraints cannot be nil")
 	}
+	if params.TopologySpread.Preset == "" {
+		return fmt.Errorf("TopologySpread Preset cannot be empty")
+	}
+	// Check all environments overrides, not only the current environment one
+	for env, spread := range params.TopologySpreadByEnv {
+		err = topologyspread.MergeArgs(&spread)
+		if err != nil {
+			return fmt.Errorf("error filling TopologySpreadByEnv %s: %w", env, err)
+		}
+		err = topologyspread.Validate(spread, params.MinReplicas, params.MaxReplicas)
+		if err != nil {
+			return fmt.Errorf("error validating TopologySpreadByEnv %s: %w", env, err)
+		}
+	}
 	if params.HorizontalPodAutoscalerBehavior == nil {
 		return fmt.Errorf("HorizontalPodAutoscalerBehavior cannot be nil")
 	}
 	if params.HorizontalPodAutoscalerBehaviorMetricSpec == nil {
 		return fmt.Errorf("HorizontalPodAutoscalerBehaviorMetricSpec cannot be nil")
 	}
+	if params.TrafficPolicy != nil {
+		// Namespace LimitRange caps containers, proxies included, to the application limits
+		proxy := trafficPolicyProxy(*params)
+		if params.CPULimitMiliCPU != 0 && proxy.CPULimitMiliCPU > params.CPULimitMiliCPU {
+			return fmt.Errorf("TrafficPolicy CPULimitMiliCPU cannot exceed CPULimitMiliCPU")
+		}
+		if params.MemoryLimitMiB != 0 && proxy.MemoryLimitMiB > params.MemoryLimitMiB {
+			return fmt.Errorf("TrafficPolicy MemoryLimitMiB cannot exceed MemoryLimitMiB")
+		}
+	}
+	if params.MeshLocalEndpointsOnly && !params.MeshGlobalService {
+		return fmt.Errorf("MeshLocalEndpointsOnly requires MeshGlobalService")
+	}
 	return nil
 }
 
@@ -409,6 +510,7 @@ func mergeParams(
 				},
 			},
 		},
+		GatewayTiers:            gateway.BaseHostTiers(),
 		HTTPReadTimeout:         15,
 		HTTPWriteTimeout:        15,
 		HTTPIdleTimeout:         60,
@@ -418,6 +520,7 @@ func mergeParams(
 		MemoryRequestMiB:        500,
 		MinReplicas:             1,
 		MaxReplicas:             10,
+		QuotaHeadroomPercent:    25,
 		ImagePullPolicy:         "IfNotPresent",
 		ProgressDeadlineSeconds: 180,
 		PodTolerations: corev1.TolerationArray{
@@ -468,106 +571,6 @@ func mergeParams(
 			},
 		},
 		PriorityClassName: priorityclass.PriorityClassNormal,
-		TopologySpreadConstraints: corev1.TopologySpreadConstraintArray{
-			// Spread pods across regions, best effort
-			corev1.TopologySpreadConstraintArgs{
-				MaxSkew: pulumi.Int(1),
-				LabelSelector: &metav1.LabelSelectorArgs{
-					MatchLabels: pulumi.StringMap{
-						"app.kubernetes.io/instance": pulumi.String(appInstance),
-					},
-				},
-				MatchLabelKeys: pulumi.StringArray{
-					pulumi.String("pod-template-hash"),
-				},
-				TopologyKey:       pulumi.String(label.LabelTopologyRegionKey),
-				WhenUnsatisfiable: pulumi.String("ScheduleAnyway"),
-			},
-			// Spread pods across zones, best effort
-			corev1.TopologySpreadConstraintArgs{
-				MaxSkew: pulumi.Int(1),
-				LabelSelector: &metav1.LabelSelectorArgs{
-					MatchLabels: pulumi.StringMap{
-						"app.kubernetes.io/instance": pulumi.String(appInstance),
-					},
-				},
-				MatchLabelKeys: pulumi.StringArray{
-					pulumi.String("pod-template-hash"),
-				},
-				TopologyKey:       pulumi.String(label.LabelTopologyZoneKey),
-				WhenUnsatisfiable: pulumi.String("ScheduleAnyway"),
-			},
-			// Spread pods across datacenters, best effort
-			corev1.TopologySpreadConstraintArgs{
-				MaxSkew: pulumi.Int(1),
-				LabelSelector: &metav1.LabelSelectorArgs{
-					MatchLabels: pulumi.StringMap{
-						"app.kubernetes.io/instance": pulumi.String(appInstance),
-					},
-				},
-				MatchLabelKeys: pulumi.StringArray{
-					pulumi.String("pod-template-hash"),
-				},
-				TopologyKey:       pulumi.String(label.LabelTopologyDatacenterKey),
-				WhenUnsatisfiable: pulumi.String("ScheduleAnyway"),
-			},
-			// Spread pods across datacenter zones, best effort
-			corev1.TopologySpreadConstraintArgs{
-				MaxSkew: pulumi.Int(1),
-				LabelSelector: &metav1.LabelSelectorArgs{
-					MatchLabels: pulumi.StringMap{
-						"app.kubernetes.io/instance": pulumi.String(appInstance),
-					},
-				},
-				MatchLabelKeys: pulumi.StringArray{
-					pulumi.String("pod-template-hash"),
-				},
-				TopologyKey:       pulumi.String(label.LabelTopologyDatacenterZoneKey),
-				WhenUnsatisfiable: pulumi.String("ScheduleAnyway"),
-			},
-			// Spread pods across aisles, best effort
-			corev1.TopologySpreadConstraintArgs{
-				MaxSkew: pulumi.Int(1),
-				LabelSelector: &metav1.LabelSelectorArgs{
-					MatchLabels: pulumi.StringMap{
-						"app.kubernetes.io/instance": pulumi.String(appInstance),
-					},
-				},
-				MatchLabelKeys: pulumi.StringArray{
-					pulumi.String("pod-template-hash"),
-				},
-				TopologyKey:       pulumi.String(label.LabelTopologyDatacenterAisleKey),
-				WhenUnsatisfiable: pulumi.String("ScheduleAnyway"),
-			},
-			// Spread pods across racks, best effort
-			corev1.TopologySpreadConstraintArgs{
-				MaxSkew: pulumi.Int(1),
-				LabelSelector: &metav1.LabelSelectorArgs{
-					MatchLabels: pulumi.StringMap{
-						"app.kubernetes.io/instance": pulumi.String(appInstance),
-					},
-				},
-				MatchLabelKeys: pulumi.StringArray{
-					pulumi.String("pod-template-hash"),
-				},
-				TopologyKey:       pulumi.String(label.LabelTopologyDatacenterRackKey),
-				WhenUnsatisfiable: pulumi.String("ScheduleAnyway"),
-			},
-			// Spread pods across nodes, best effort
-			corev1.TopologySpreadConstraintArgs{
-				MaxSkew: pulumi.Int(1),
-				LabelSelector: &metav1.LabelSelectorArgs{
-					MatchLabels: pulumi.StringMap{
-						"app.kubernetes.io/instance": pulumi.String(appInstance),
-					},
-				},
-				MatchLabelKeys: pulumi.StringArray{
-					pulumi.String("pod-template-hash"),
-				},
-				TopologyKey:       pulumi.String(label.LabelTopologyHostnameKey),
-				WhenUnsatisfiable: pulumi.String("ScheduleAnyway"),
-			},
-		},
 		HorizontalPodAutoscalerBehavior: &autoscalingv2.HorizontalPodAutoscalerBehaviorArgs{
 			ScaleDown: &autoscalingv2.HPAScalingRulesArgs{
 				// Downscale max 30%/minute
@@ -609,6 +612,31 @@ func mergeParams(
 	if err != nil {
 		return fmt.Errorf("error filling app parameters: %w", err)
 	}
+	// Unknown profiles are rejected once params are validated
+	if params.NodeProfile != "" {
+		if params.NodeSelectors == nil {
+			params.NodeSelectors = params.NodeProfile.NodeSelector()
+		}
+		params.PodTolerations = params.NodeProfile.WithTolerations(params.PodTolerations)
+	}
+	spread, ok := params.TopologySpreadByEnv[params.RuntimeEnv]
+	if !ok {
+		spread = params.TopologySpread
+	}
+	err = topologyspread.MergeArgs(&spread)
+	if err != nil {
+		return fmt.Errorf("error filling TopologySpread: %w", err)
+	}
+	err = topologyspread.Validate(spread, params.MinReplicas, params.MaxReplicas)
+	if err != nil {
+		return fmt.Errorf("error validating TopologySpread: %w", err)
+	}
+	params.TopologySpread = spread
+	if params.TopologySpreadConstraints == nil {
+		params.TopologySpreadConstraints = topologyspread.Constraints(spread, pulumi.StringMap{
+			"app.kubernetes.io/instance": pulumi.String(appInstance),
+		})
+	}
 	err = validateParams(params)
 	if err != nil {
 		return fmt.Errorf("error validating app parameters: %w", err)
@@ -630,9 +658,64 @@ func checkChangemeParams(params AppParms) bool {
 		params.MonitoringUrl.String() == ""
 }
 
+// gatewayTier returns the tier of the gateway serving the application hostnames, defaulting to the main API one, and
+// an error if hostnames belong to different tiers.
+func gatewayTier(hostnames []string, tiers []gateway.TierArgs) (gateway.Tier, error) {
+	if len(hostnames) == 0 {
+		return gateway.TierForHost(host.HostMainApi.Host, tiers)
+	}
+	tier, err := gateway.TierForHost(hostnames[0], tiers)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range hostnames[1:] {
+		t, err := gateway.TierForHost(h, tiers)
+		if err != nil {
+			return "", err
+		}
+		if t != tier {
+			return "", fmt.Errorf("hostnames %s and %s belong to different gateway tiers", hostnames[0], h)
+		}
+	}
+	return tier, nil
+}
+
+// policyRules returns the HTTP rules with backends referencing the service replaced with the traffic policy proxy
+// one, so that gateway traffic goes through the policy. Other rules and backends are kept as is.
+func policyRules(rules pulumi.ArrayInput, service string, proxy string) pulumi.ArrayOutput {
+	return rules.ToArrayOutput().ApplyT(func(rules []any) []any {
+		routed := make([]any, len(rules))
+		for i, r := range rules {
+			routed[i] = r
+			rule, ok := r.(map[string]any)
+			if !ok {
+				continue
+			}
+			refs, ok := rule["backendRefs"].([]any)
+			if !ok {
+				continue
+			}
+			routedRefs := make([]any, len(refs))
+			for j, ref := range refs {
+				routedRefs[j] = ref
+				backend, ok := ref.(map[string]any)
+				if ok && backend["name"] == service {
+					backend = maps.Clone(backend)
+					backend["name"] = proxy
+					routedRefs[j] = backend
+				}
+			}
+			rule = maps.Clone(rule)
+			rule["backendRefs"] = routedRefs
+			routed[i] = rule
+		}
+		return routed
+	}).(pulumi.ArrayOutput)
+}
+
 // DeployBasicHTTPApp deploys a basic HTTP application to the Kubernetes cluster, using the provided parameters merged with the default ones,
-// and returns an error if any of the parameters is invalid or if the deployment fails.
-func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
+// and returns an error if any of the parameters is invalid or if the deployment fails. opts are applied to all created resources.
+func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms, opts ...pulumi.ResourceOption) error {
 	if checkChangemeParams(params) {
 		return fmt.Errorf("please set all parameters to valid values, not 'changeme'")
 	}
@@ -653,6 +736,12 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 		return fmt.Errorf("failed to apply default application parameters: %w", err)
 	}
 
+	// Gateway the application is exposed on, so that private applications are never exposed on public IPs
+	tier, err := gatewayTier(params.HTTPHostnames, params.GatewayTiers)
+	if err != nil {
+		return fmt.Errorf("error selecting gateway tier: %w", err)
+	}
+
 	sharedLabels := pulumilabel.DefaultLabels(
 		pulumi.String(params.AppName),
 		pulumi.String(appInstance),
@@ -685,17 +774,23 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 					"pod-security.kubernetes.io/warn-version":    pulumi.String("latest"),
 				}
 				maps.Copy(labels, sharedLabels)
-				// Allow shared gateway access to this namespace
+				// Allow tier gateway access to this namespace
 				gatewayAttachmentEnableLabel := pulumi.StringMap{
-					label.SharedGatewayAccessLabelKey: pulumi.String(
-						label.SharedGatewayAccessLabelValue,
+					tier.AccessLabelKey(): pulumi.String(
+						label.GatewayAccessLabelValue,
 					),
 				}
 				maps.Copy(labels, gatewayAttachmentEnableLabel)
 				return labels
 			}(),
 		},
-	})
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Namespace guardrails, preventing the application from consuming the cluster
+	err = deployNamespaceGuardrails(ctx, params, namespace, sharedLabels, opts...)
 	if err != nil {
 		return err
 	}
@@ -769,7 +864,7 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 			}
 			return envMap
 		}(),
-	})
+	}, opts...)
 
 	// Application deployment
 	deployment, err := appsv1.NewDeployment(ctx, "deployment", &appsv1.DeploymentArgs{
@@ -787,7 +882,22 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 				Metadata: &metav1.ObjectMetaArgs{
 					Name:      pulumi.String(appInstance),
 					Namespace: pulumi.String(namespace),
-					Labels:    sharedLabels,
+					Labels: func() pulumi.StringMap {
+						if params.EgressGateway == "" && !params.DataClassification.IsSensitive() {
+							return sharedLabels
+						}
+						labels := pulumi.StringMap{}
+						maps.Copy(labels, sharedLabels)
+						if params.EgressGateway != "" {
+							// Route outbound traffic through the egress gateway
+							labels[label.EgressGatewayLabelKey] = pulumi.String(params.EgressGateway)
+						}
+						if params.DataClassification.IsSensitive() {
+							// Redact gateway access logs of sensitive data
+							labels[label.AccessLogRedactLabelKey] = pulumi.String(label.AccessLogRedactLabelValue)
+						}
+						return labels
+					}(),
 				},
 				Spec: &corev1.PodSpecArgs{
 					PriorityClassName:         pulumi.String(params.PriorityClassName),
@@ -865,7 +975,7 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 				},
 			},
 		},
-	})
+	}, opts...)
 	if err != nil {
 		return err
 	}
@@ -891,6 +1001,7 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 				Metrics:  params.HorizontalPodAutoscalerBehaviorMetricSpec,
 			},
 		},
+		opts...,
 	)
 	if err != nil {
 		return err
@@ -902,6 +1013,16 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 			Name:      pulumi.String(appInstance),
 			Namespace: pulumi.String(namespace),
 			Labels:    sharedLabels,
+			Annotations: func() pulumi.StringMap {
+				if !params.MeshGlobalService {
+					return nil
+				}
+				// See https://docs.cilium.io/en/stable/network/clustermesh/services/
+				return pulumi.StringMap{
+					"service.cilium.io/global": pulumi.String("true"),
+					"service.cilium.io/shared": pulumi.String(strconv.FormatBool(!params.MeshLocalEndpointsOnly)),
+				}
+			}(),
 		},
 		Spec: &corev1.ServiceSpecArgs{
 			Ports: corev1.ServicePortArray{
@@ -917,11 +1038,101 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 			// Prioritize close endpoints, best-effort, see https://kubernetes.io/docs/reference/networking/virtual-ips/#traffic-distribution
 			// TrafficDistribution: pulumi.String("PreferClose"),
 		},
-	})
+	}, opts...)
 	if err != nil {
 		return err
 	}
 
+	// Application traffic policy, enforced in front of the application by routing gateway traffic through its proxy
+	httpRules := params.HTTPRules
+	if params.TrafficPolicy != nil {
+		policy := *params.TrafficPolicy
+		if policy.RequestTimeout == 0 {
+			policy.RequestTimeout = time.Duration(params.HTTPReadTimeout) * time.Second
+		}
+		if policy.ResponseTimeout == 0 {
+			policy.ResponseTimeout = time.Duration(params.HTTPWriteTimeout) * time.Second
+		}
+		if policy.IdleTimeout == 0 {
+			policy.IdleTimeout = time.Duration(params.HTTPIdleTimeout) * time.Second
+		}
+		proxy, err := trafficpolicy.DeployTrafficPolicy(
+			ctx,
+			"traffic-policy",
+			namespace,
+			appInstance,
+			params.Port,
+			policy,
+			sharedLabels,
+			opts...,
+		)
+		if err != nil {
+			return err
+		}
+		httpRules = policyRules(params.HTTPRules, appInstance, proxy)
+	}
+
+	// Application network policy, see https://docs.cilium.io/en/stable/network/servicemesh/mutual-authentication/mutual-authentication/
+	if params.MutualAuthentication {
+		port := pulumi.Array{
+			pulumi.Map{
+				"ports": pulumi.Array{
+					pulumi.Map{
+						"port":     pulumi.String(strconv.Itoa(params.Port)),
+						"protocol": pulumi.String("TCP"),
+					},
+				},
+			},
+		}
+		_, err = yamlv2.NewConfigGroup(ctx, "network-policy", &yamlv2.ConfigGroupArgs{
+			Objs: pulumi.Array{
+				pulumi.Map{
+					"apiVersion": pulumi.String("cilium.io/v2"),
+					"kind":       pulumi.String("CiliumNetworkPolicy"),
+					"metadata": pulumi.Map{
+						"name":      pulumi.String(appInstance),
+						"namespace": pulumi.String(namespace),
+						"labels":    sharedLabels,
+					},
+					"spec": pulumi.Map{
+						"endpointSelector": pulumi.Map{
+							"matchLabels": basicSelector,
+						},
+						"ingress": pulumi.Array{
+							// Allow tier gateway traffic, authenticated by the gateway itself
+							pulumi.Map{
+								"fromEntities": pulumi.StringArray{
+									pulumi.String("ingress"),
+								},
+								"toPorts": port,
+							},
+							// Allow kubelet probes
+							pulumi.Map{
+								"fromEntities": pulumi.StringArray{
+									pulumi.String("host"),
+								},
+								"toPorts": port,
+							},
+							// Allow in-cluster traffic from mutually authenticated workloads only
+							pulumi.Map{
+								"fromEntities": pulumi.StringArray{
+									pulumi.String("cluster"),
+								},
+								"toPorts": port,
+								"authentication": pulumi.Map{
+									"mode": pulumi.String("required"),
+								},
+							},
+						},
+					},
+				},
+			},
+		}, opts...)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Application HTTP route
 	hostnames := make(
 		pulumi.StringArray,
@@ -947,16 +1158,16 @@ func DeployBasicHTTPApp(ctx *pulumi.Context, params AppParms) error {
 				"spec": pulumi.Map{
 					"parentRefs": pulumi.Array{
 						pulumi.Map{
-							"name":      pulumi.String(gateway.SharedGatewayName),
+							"name":      pulumi.String(tier.GatewayName()),
 							"namespace": pulumi.String(gateway.SharedGatewayNamespace),
 						},
 					},
 					"hotnames": hostnames,
-					"rules":    params.HTTPRules,
+					"rules":    httpRules,
 				},
 			},
 		},
-	})
+	}, opts...)
 	if err != nil {
 		return err
 	}
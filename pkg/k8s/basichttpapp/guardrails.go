@@ -0,0 +1,146 @@
+package basichttpapp
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"strconv"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/trafficpolicy"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// ExportKeyResourceQuota is the stack output key of the application namespace ResourceQuota hard limits.
+	ExportKeyResourceQuota = "resourceQuota"
+	// ExportKeyLimitRange is the stack output key of the application namespace LimitRange limits.
+	ExportKeyLimitRange = "limitRange"
+)
+
+// withHeadroom returns the value increased by headroomPercent, rounded up.
+func withHeadroom(value int, headroomPercent int) int {
+	return (value*(100+headroomPercent) + 99) / 100
+}
+
+// trafficPolicyProxy returns the traffic policy parameters of the application filled with defaults, i.e. its proxy
+// replicas and resources as deployed, or zero values if the application has no traffic policy.
+func trafficPolicyProxy(params AppParms) trafficpolicy.TrafficPolicyArgs {
+	if params.TrafficPolicy == nil {
+		return trafficpolicy.TrafficPolicyArgs{}
+	}
+	p := params.TrafficPolicy
+	d := trafficpolicy.TrafficPolicyDefaultArgs
+	return trafficpolicy.TrafficPolicyArgs{
+		Replicas:          cmp.Or(p.Replicas, d.Replicas),
+		CPURequestMiliCPU: cmp.Or(p.CPURequestMiliCPU, d.CPURequestMiliCPU),
+		CPULimitMiliCPU:   cmp.Or(p.CPULimitMiliCPU, d.CPULimitMiliCPU),
+		MemoryRequestMiB:  cmp.Or(p.MemoryRequestMiB, d.MemoryRequestMiB),
+		MemoryLimitMiB:    cmp.Or(p.MemoryLimitMiB, d.MemoryLimitMiB),
+	}
+}
+
+// namespaceQuotaHard returns the hard limits of the application namespace ResourceQuota, allowing MaxReplicas pods
+// and traffic policy proxies, each with their own resources, plus headroom, e.g. for rolling updates surge and
+// debugging pods. Limits are only capped if the application sets them, as capping them requires all pods to set them.
+// Params QuotaHard entries override computed ones.
+func namespaceQuotaHard(params AppParms) pulumi.StringMap {
+	pods := withHeadroom(params.MaxReplicas, params.QuotaHeadroomPercent)
+	proxy := trafficPolicyProxy(params)
+	proxyPods := withHeadroom(proxy.Replicas, params.QuotaHeadroomPercent)
+	hard := pulumi.StringMap{
+		"pods": pulumi.String(strconv.Itoa(pods + proxyPods)),
+		"requests.cpu": pulumi.String(
+			strconv.Itoa(pods*params.CPURequestMiliCPU+proxyPods*proxy.CPURequestMiliCPU) + "m",
+		),
+		"requests.memory": pulumi.String(
+			strconv.Itoa(pods*params.MemoryRequestMiB+proxyPods*proxy.MemoryRequestMiB) + "Mi",
+		),
+	}
+	if params.CPULimitMiliCPU != 0 {
+		hard["limits.cpu"] = pulumi.String(
+			strconv.Itoa(pods*params.CPULimitMiliCPU+proxyPods*proxy.CPULimitMiliCPU) + "m",
+		)
+	}
+	if params.MemoryLimitMiB != 0 {
+		hard["limits.memory"] = pulumi.String(
+			strconv.Itoa(pods*params.MemoryLimitMiB+proxyPods*proxy.MemoryLimitMiB) + "Mi",
+		)
+	}
+	maps.Copy(hard, params.QuotaHard)
+	return hard
+}
+
+// namespaceLimitRange returns the limits of the application namespace LimitRange, defaulting containers resources to
+// the application ones and capping them, so that extra pods fit in the quota. Params LimitRangeLimits replace computed
+// ones if set.
+func namespaceLimitRange(params AppParms) corev1.LimitRangeItemArray {
+	if params.LimitRangeLimits != nil {
+		return params.LimitRangeLimits
+	}
+	defaultRequest := pulumi.StringMap{
+		"cpu":    pulumi.String(strconv.Itoa(params.CPURequestMiliCPU) + "m"),
+		"memory": pulumi.String(strconv.Itoa(params.MemoryRequestMiB) + "Mi"),
+	}
+	// Only default and cap limits set by the application, as defaults apply to its own containers too
+	limits := pulumi.StringMap{}
+	if params.CPULimitMiliCPU != 0 {
+		limits["cpu"] = pulumi.String(strconv.Itoa(params.CPULimitMiliCPU) + "m")
+	}
+	if params.MemoryLimitMiB != 0 {
+		limits["memory"] = pulumi.String(strconv.Itoa(params.MemoryLimitMiB) + "Mi")
+	}
+	item := &corev1.LimitRangeItemArgs{
+		Type:           pulumi.String("Container"),
+		DefaultRequest: defaultRequest,
+	}
+	if len(limits) > 0 {
+		item.Default = limits
+		item.Max = limits
+	}
+	return corev1.LimitRangeItemArray{item}
+}
+
+// deployNamespaceGuardrails deploys the ResourceQuota and LimitRange of the application namespace, exporting their
+// limits, applying opts to all created resources, and returns an error if any.
+func deployNamespaceGuardrails(
+	ctx *pulumi.Context,
+	params AppParms,
+	namespace string,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	quota, err := corev1.NewResourceQuota(ctx, "resource-quota", &corev1.ResourceQuotaArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String(namespace),
+			Namespace: pulumi.String(namespace),
+			Labels:    sharedLabels,
+		},
+		Spec: &corev1.ResourceQuotaSpecArgs{
+			Hard: namespaceQuotaHard(params),
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create resource quota: %w", err)
+	}
+
+	limitRange, err := corev1.NewLimitRange(ctx, "limit-range", &corev1.LimitRangeArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String(namespace),
+			Namespace: pulumi.String(namespace),
+			Labels:    sharedLabels,
+		},
+		Spec: &corev1.LimitRangeSpecArgs{
+			Limits: namespaceLimitRange(params),
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create limit range: %w", err)
+	}
+
+	ctx.Export(ExportKeyResourceQuota, quota.Spec.Hard())
+	ctx.Export(ExportKeyLimitRange, limitRange.Spec.Limits())
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package certmanager
+
+import (
+	"fmt"
+
+	"dario.cat/mergo"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/gateway"
+	"github.com/kemadev/infrastructure-components/pkg/private/domain"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// A Route53Args contains the parameters needed to solve DNS-01 challenges using AWS Route53, see
+// https://cert-manager.io/docs/configuration/acme/dns01/route53/.
+type Route53Args struct {
+	// Region is the AWS region of the Route53 API.
+	Region string
+	// AccessKeyID is the AWS access key ID. Ambient credentials (e.g. IRSA) are used if nil.
+	AccessKeyID pulumi.StringInput
+	// SecretAccessKey is the AWS secret access key, used along with AccessKeyID.
+	SecretAccessKey pulumi.StringInput
+}
+
+// A CloudflareArgs contains the parameters needed to solve DNS-01 challenges using Cloudflare, see
+// https://cert-manager.io/docs/configuration/acme/dns01/cloudflare/.
+type CloudflareArgs struct {
+	// APIToken is the Cloudflare API token, with Zone.DNS edit permission.
+	APIToken pulumi.StringInput
+}
+
+// A CertManagerArgs contains all the parameters needed to deploy cert-manager and its issuers.
+type CertManagerArgs struct {
+	// Version is the cert-manager Helm chart version.
+	Version string
+	// IssuerName is the name of the ACME issuer, e.g. the one referenced by public tier gateways.
+	IssuerName string
+	// IssuerNamespace is the namespace of the ACME issuer, i.e. the namespace of the gateways using it.
+	IssuerNamespace string
+	// ACMEServer is the ACME directory URL.
+	ACMEServer string
+	// ACMEEmail is the email address registered to the ACME server, receiving expiry notices.
+	ACMEEmail string
+	// AwsRegisteredDomains are the domains whose challenges are solved using Route53. Registrar domains are only
+	// defaulted if none of them is set, so that setting some registrar domains, even to an empty list, disables the
+	// other registrars.
+	AwsRegisteredDomains []domain.Domain
+	// CloudflareRegisteredDomains are the domains whose challenges are solved using Cloudflare.
+	CloudflareRegisteredDomains []domain.Domain
+	// SquarespaceRegisteredDomains are the domains whose challenges are solved using Route53, following a
+	// `_acme-challenge.<domain>` CNAME record delegating challenges to a Route53 zone, as Squarespace has no DNS API.
+	SquarespaceRegisteredDomains []domain.Domain
+	// InternalDomains are the domains whose certificates are issued by the private CA.
+	InternalDomains []domain.Domain
+	// Route53 contains the Route53 solver parameters, required for AWS and Squarespace registered domains.
+	Route53 Route53Args
+	// Cloudflare contains the Cloudflare solver parameters, required for Cloudflare registered domains.
+	Cloudflare CloudflareArgs
+	// Values are Helm values deeply merged over the default ones, overriding them.
+	Values pulumi.Map
+}
+
+// CertManagerDefaultArgs are the default cert-manager parameters.
+var CertManagerDefaultArgs = CertManagerArgs{
+	// TODO add renovate tracking
+	Version:                      "v1.18.2",
+	IssuerName:                   "letsencrypt",
+	IssuerNamespace:              gateway.SharedGatewayNamespace,
+	ACMEServer:                   "https://acme-v02.api.letsencrypt.org/directory",
+	AwsRegisteredDomains:         domain.AwsRegisteredDomain,
+	CloudflareRegisteredDomains:  domain.CloudflareRegisteredDomain,
+	SquarespaceRegisteredDomains: domain.SquarespaceRegisteredDomain,
+	InternalDomains:              domain.InternalDomain,
+}
+
+// validateArgs validates the cert-manager parameters, returning an error if any of them is invalid.
+func validateArgs(args CertManagerArgs) error {
+	if args.Version == "" {
+		return fmt.Errorf("Version cannot be empty")
+	}
+	if args.IssuerName == "" {
+		return fmt.Errorf("IssuerName cannot be empty")
+	}
+	if args.IssuerNamespace == "" {
+		return fmt.Errorf("IssuerNamespace cannot be empty")
+	}
+	if args.ACMEServer == "" {
+		return fmt.Errorf("ACMEServer cannot be empty")
+	}
+	if args.ACMEEmail == "" {
+		return fmt.Errorf("ACMEEmail cannot be empty")
+	}
+	if len(args.AwsRegisteredDomains)+len(args.SquarespaceRegisteredDomains) > 0 && args.Route53.Region == "" {
+		return fmt.Errorf("Route53 Region cannot be empty when AWS or Squarespace registered domains are set")
+	}
+	if (args.Route53.AccessKeyID == nil) != (args.Route53.SecretAccessKey == nil) {
+		return fmt.Errorf("Route53 AccessKeyID and SecretAccessKey must be set together")
+	}
+	if len(args.CloudflareRegisteredDomains) > 0 && args.Cloudflare.APIToken == nil {
+		return fmt.Errorf("Cloudflare APIToken cannot be nil when Cloudflare registered domains are set")
+	}
+	return nil
+}
+
+// mergeArgs fills unset cert-manager parameters with their default values and validates them, returning an error if
+// any of them is invalid.
+func mergeArgs(args *CertManagerArgs) error {
+	defaults := CertManagerDefaultArgs
+	if args.AwsRegisteredDomains != nil ||
+		args.CloudflareRegisteredDomains != nil ||
+		args.SquarespaceRegisteredDomains != nil {
+		// Leave unset registrars disabled, not to require their credentials
+		defaults.AwsRegisteredDomains = nil
+		defaults.CloudflareRegisteredDomains = nil
+		defaults.SquarespaceRegisteredDomains = nil
+	}
+	err := mergo.Merge(args, defaults)
+	if err != nil {
+		return fmt.Errorf("error filling cert-manager parameters: %w", err)
+	}
+	err = validateArgs(*args)
+	if err != nil {
+		return fmt.Errorf("error validating cert-manager parameters: %w", err)
+	}
+	return nil
+}
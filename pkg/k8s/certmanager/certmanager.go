@@ -0,0 +1,132 @@
+/*
+Package certmanager deploys cert-manager along with the issuers used by gateways.
+
+An ACME issuer solves DNS-01 challenges with a solver picked per domain depending on its
+registrar, so that wildcard certificates can be issued. A private CA issuer signs certificates
+of internal domains, that can't be validated by public ACME servers.
+*/
+package certmanager
+
+import (
+	"fmt"
+
+	"dario.cat/mergo"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/priorityclass"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/pulumilabel"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v3"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// Namespace is the namespace cert-manager is deployed to.
+	Namespace = "cert-manager"
+	// InternalCAIssuerName is the name of the ClusterIssuer signing certificates of internal domains, to be referenced
+	// using the `cert-manager.io/cluster-issuer` annotation.
+	InternalCAIssuerName = "internal-ca"
+)
+
+const (
+	certManagerName = "cert-manager"
+	certManagerRepo = "https://charts.jetstack.io"
+)
+
+// DeployCertManager deploys cert-manager using Helm along with its issuers, using the provided parameters merged with
+// the default ones, applying opts to all created resources, returning the corresponding Release object and an error if
+// any.
+func DeployCertManager(
+	ctx *pulumi.Context,
+	args CertManagerArgs,
+	opts ...pulumi.ResourceOption,
+) (*helm.Release, error) {
+	err := mergeArgs(&args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply default cert-manager parameters: %w", err)
+	}
+
+	sharedLabels := pulumilabel.DefaultLabels(
+		pulumi.String(certManagerName),
+		pulumi.String(certManagerName),
+		pulumi.String(args.Version),
+		pulumi.String("certificates"),
+		pulumi.String("security"),
+	)
+
+	ns, err := corev1.NewNamespace(ctx, Namespace, &corev1.NamespaceArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String(Namespace),
+			Namespace: pulumi.String(Namespace),
+			Labels:    sharedLabels,
+		},
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create namespace %s: %w", Namespace, err)
+	}
+
+	values := helmValues(sharedLabels)
+	if args.Values != nil {
+		err := mergo.Merge(&values, args.Values, mergo.WithOverride)
+		if err != nil {
+			return nil, fmt.Errorf("error merging cert-manager values: %w", err)
+		}
+	}
+
+	release, err := helm.NewRelease(ctx, certManagerName, &helm.ReleaseArgs{
+		Name:        pulumi.String(certManagerName),
+		Description: pulumi.String("Certificates issuance and renewal"),
+		Namespace:   ns.Metadata.Name(),
+		Timeout:     pulumi.Int(600),
+		RepositoryOpts: &helm.RepositoryOptsArgs{
+			Repo: pulumi.String(certManagerRepo),
+		},
+		Chart:   pulumi.String(certManagerName),
+		Version: pulumi.String(args.Version),
+		Values:  values,
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deploy cert-manager: %w", err)
+	}
+
+	issuerOpts := append([]pulumi.ResourceOption{pulumi.DependsOn([]pulumi.Resource{release})}, opts...)
+	err = deployACMEIssuer(ctx, args, sharedLabels, issuerOpts...)
+	if err != nil {
+		return nil, err
+	}
+	err = deployInternalCAIssuer(ctx, args, sharedLabels, issuerOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// helmValues returns the cert-manager Helm values.
+func helmValues(sharedLabels pulumi.StringMap) pulumi.Map {
+	return pulumi.Map{
+		"global": pulumi.Map{
+			// Add labels to all resources
+			"commonLabels": sharedLabels,
+			// Set cert-manager as high priority, as expired certificates break gateways
+			"priorityClassName": pulumi.String(priorityclass.PriorityClassHigh),
+		},
+		"crds": pulumi.Map{
+			// Install and keep CRDs
+			"enabled": pulumi.Bool(true),
+			"keep":    pulumi.Bool(true),
+		},
+		"config": pulumi.Map{
+			"apiVersion": pulumi.String("controller.config.cert-manager.io/v1alpha1"),
+			"kind":       pulumi.String("ControllerConfiguration"),
+			// Issue certificates for annotated gateways, see https://cert-manager.io/docs/usage/gateway/
+			"enableGatewayAPI": pulumi.Bool(true),
+		},
+		"prometheus": pulumi.Map{
+			// Expose cert-manager metrics
+			"enabled": pulumi.Bool(true),
+		},
+		// Check DNS-01 propagation using public resolvers, as internal ones may serve split-horizon zones
+		"dns01RecursiveNameserversOnly": pulumi.Bool(true),
+		"dns01RecursiveNameservers":     pulumi.String("1.1.1.1:53,[2606:4700:4700::1111]:53"),
+	}
+}
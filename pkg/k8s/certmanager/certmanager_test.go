@@ -0,0 +1,269 @@
+package certmanager
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/kemadev/infrastructure-components/pkg/private/domain"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// mocks records the inputs of created resources, keyed by name.
+type mocks struct {
+	mu        sync.Mutex
+	resources map[string]resource.PropertyMap
+}
+
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources[args.Name] = args.Inputs
+	return args.Name + "-id", args.Inputs, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+// deploy runs DeployCertManager with args using mocks, returning the inputs of created resources, keyed by name.
+func deploy(t *testing.T, args CertManagerArgs) map[string]map[string]any {
+	t.Helper()
+	m := &mocks{resources: map[string]resource.PropertyMap{}}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		_, err := DeployCertManager(ctx, args)
+		return err
+	}, pulumi.WithMocks("project", "stack", m))
+	if err != nil {
+		t.Fatalf("DeployCertManager() error = %v", err)
+	}
+	resources := map[string]map[string]any{}
+	for name, inputs := range m.resources {
+		resources[name] = inputs.Mappable()
+	}
+	return resources
+}
+
+// configGroupObjects returns the objects of the config group, failing if it was not created.
+func configGroupObjects(t *testing.T, resources map[string]map[string]any, name string) []map[string]any {
+	t.Helper()
+	group, ok := resources[name]
+	if !ok {
+		t.Fatalf("config group %s was not created", name)
+	}
+	objs := []map[string]any{}
+	for _, o := range group["objs"].([]any) {
+		objs = append(objs, o.(map[string]any))
+	}
+	return objs
+}
+
+// path returns the value at the keys of nested maps, nil if any is missing.
+func path(v any, keys ...string) any {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// solverFor returns the ACME solver whose selector includes the zone, nil if none.
+func solverFor(t *testing.T, resources map[string]map[string]any, zone domain.Domain) map[string]any {
+	t.Helper()
+	issuer := configGroupObjects(t, resources, "acme-issuer")[0]
+	var found map[string]any
+	for _, s := range path(issuer, "spec", "acme", "solvers").([]any) {
+		solver := s.(map[string]any)
+		zones := path(solver, "selector", "dnsZones").([]any)
+		if slices.Contains(zones, any(zone.String())) {
+			if found != nil {
+				t.Fatalf("zone %s is selected by more than one solver", zone)
+			}
+			found = solver
+		}
+	}
+	return found
+}
+
+func testArgs() CertManagerArgs {
+	return CertManagerArgs{
+		ACMEEmail:                    "acme@example.com",
+		AwsRegisteredDomains:         []domain.Domain{domain.DomainKemaDotRun},
+		CloudflareRegisteredDomains:  []domain.Domain{domain.DomainKemaDotCloud},
+		SquarespaceRegisteredDomains: []domain.Domain{domain.DomainKemaDotDev},
+		InternalDomains:              []domain.Domain{domain.DomainKemaDotInternal},
+		Route53: Route53Args{
+			Region:          "eu-west-3",
+			AccessKeyID:     pulumi.String("access-key-id"),
+			SecretAccessKey: pulumi.String("secret-access-key"),
+		},
+		Cloudflare: CloudflareArgs{
+			APIToken: pulumi.String("api-token"),
+		},
+	}
+}
+
+func TestACMESolvers(t *testing.T) {
+	resources := deploy(t, testArgs())
+
+	tests := []struct {
+		name            string
+		zone            domain.Domain
+		wantProvider    string
+		wantSecret      string
+		wantCNAMEFollow bool
+	}{
+		{
+			name:         "aws",
+			zone:         domain.DomainKemaDotRun,
+			wantProvider: "route53",
+			wantSecret:   route53SecretName,
+		},
+		{
+			name:         "cloudflare",
+			zone:         domain.DomainKemaDotCloud,
+			wantProvider: "cloudflare",
+			wantSecret:   cloudflareSecretName,
+		},
+		{
+			name:            "squarespace",
+			zone:            domain.DomainKemaDotDev,
+			wantProvider:    "route53",
+			wantSecret:      route53SecretName,
+			wantCNAMEFollow: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solver := solverFor(t, resources, tt.zone)
+			if solver == nil {
+				t.Fatalf("no solver selects zone %s", tt.zone)
+			}
+			if path(solver, "dns01", tt.wantProvider) == nil {
+				t.Errorf("zone %s solver = %v, want %s", tt.zone, solver, tt.wantProvider)
+			}
+			follow := path(solver, "dns01", "cnameStrategy") == "Follow"
+			if follow != tt.wantCNAMEFollow {
+				t.Errorf("zone %s solver follows CNAME = %t, want %t", tt.zone, follow, tt.wantCNAMEFollow)
+			}
+			if _, ok := resources[tt.wantSecret]; !ok {
+				t.Errorf("zone %s solver credentials secret %s was not created", tt.zone, tt.wantSecret)
+			}
+		})
+	}
+
+	if solverFor(t, resources, domain.DomainKemaDotInternal) != nil {
+		t.Errorf("internal zone %s is selected by an ACME solver", domain.DomainKemaDotInternal)
+	}
+}
+
+func TestACMESolversAmbientCredentials(t *testing.T) {
+	args := testArgs()
+	args.Route53.AccessKeyID = nil
+	args.Route53.SecretAccessKey = nil
+	resources := deploy(t, args)
+
+	if _, ok := resources[route53SecretName]; ok {
+		t.Errorf("route53 credentials secret was created without credentials")
+	}
+	solver := solverFor(t, resources, domain.DomainKemaDotRun)
+	if path(solver, "dns01", "route53", "accessKeyIDSecretRef") != nil {
+		t.Errorf("route53 solver references credentials without credentials: %v", solver)
+	}
+}
+
+func TestInternalCAIssuer(t *testing.T) {
+	resources := deploy(t, testArgs())
+
+	objs := configGroupObjects(t, resources, InternalCAIssuerName)
+	i := slices.IndexFunc(objs, func(o map[string]any) bool { return o["kind"] == "ClusterIssuer" })
+	if i < 0 {
+		t.Fatalf("internal ca config group has no ClusterIssuer: %v", objs)
+	}
+	issuer := objs[i]
+	if path(issuer, "metadata", "name") != InternalCAIssuerName {
+		t.Errorf("ClusterIssuer name = %v, want %s", path(issuer, "metadata", "name"), InternalCAIssuerName)
+	}
+	if path(issuer, "spec", "ca", "secretName") != InternalCAIssuerName {
+		t.Errorf("ClusterIssuer ca secret = %v, want %s", path(issuer, "spec", "ca", "secretName"), InternalCAIssuerName)
+	}
+	j := slices.IndexFunc(objs, func(o map[string]any) bool { return o["kind"] == "Certificate" })
+	if j < 0 || path(objs[j], "spec", "isCA") != true {
+		t.Fatalf("internal ca config group has no CA Certificate: %v", objs)
+	}
+	if path(objs[j], "spec", "commonName") != domain.DomainKemaDotInternal.String()+" internal CA" {
+		t.Errorf("CA common name = %v", path(objs[j], "spec", "commonName"))
+	}
+}
+
+func TestMergeArgsRegistrarDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		aws             []domain.Domain
+		cloudflare      []domain.Domain
+		squarespace     []domain.Domain
+		wantAws         []domain.Domain
+		wantCloudflare  []domain.Domain
+		wantSquarespace []domain.Domain
+	}{
+		{
+			name:            "all registrars unset",
+			wantAws:         domain.AwsRegisteredDomain,
+			wantCloudflare:  domain.CloudflareRegisteredDomain,
+			wantSquarespace: domain.SquarespaceRegisteredDomain,
+		},
+		{
+			name:           "only cloudflare set",
+			cloudflare:     []domain.Domain{domain.DomainKemaDotCloud},
+			wantCloudflare: []domain.Domain{domain.DomainKemaDotCloud},
+		},
+		{
+			name:    "empty list stays empty",
+			aws:     []domain.Domain{},
+			wantAws: []domain.Domain{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := testArgs()
+			args.AwsRegisteredDomains = tt.aws
+			args.CloudflareRegisteredDomains = tt.cloudflare
+			args.SquarespaceRegisteredDomains = tt.squarespace
+			err := mergeArgs(&args)
+			if err != nil {
+				t.Fatalf("mergeArgs() error = %v", err)
+			}
+			if !slices.Equal(args.AwsRegisteredDomains, tt.wantAws) {
+				t.Errorf("AwsRegisteredDomains = %v, want %v", args.AwsRegisteredDomains, tt.wantAws)
+			}
+			if !slices.Equal(args.CloudflareRegisteredDomains, tt.wantCloudflare) {
+				t.Errorf("CloudflareRegisteredDomains = %v, want %v", args.CloudflareRegisteredDomains, tt.wantCloudflare)
+			}
+			if !slices.Equal(args.SquarespaceRegisteredDomains, tt.wantSquarespace) {
+				t.Errorf(
+					"SquarespaceRegisteredDomains = %v, want %v",
+					args.SquarespaceRegisteredDomains,
+					tt.wantSquarespace,
+				)
+			}
+		})
+	}
+}
+
+func TestMergeArgsDisabledRegistrarNeedsNoCredentials(t *testing.T) {
+	args := CertManagerArgs{
+		ACMEEmail:                   "acme@example.com",
+		CloudflareRegisteredDomains: []domain.Domain{domain.DomainKemaDotCloud},
+		Cloudflare: CloudflareArgs{
+			APIToken: pulumi.String("api-token"),
+		},
+	}
+	err := mergeArgs(&args)
+	if err != nil {
+		t.Errorf("mergeArgs() without Route53 parameters error = %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package certmanager
+
+import (
+	"fmt"
+
+	"github.com/kemadev/infrastructure-components/pkg/private/domain"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	yamlv2 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml/v2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// route53SecretName is the name of the secret holding Route53 credentials.
+	route53SecretName = "route53-credentials"
+	// cloudflareSecretName is the name of the secret holding the Cloudflare API token.
+	cloudflareSecretName = "cloudflare-api-token"
+	// selfSignedIssuerName is the name of the issuer bootstrapping the private CA.
+	selfSignedIssuerName = "selfsigned"
+)
+
+// dnsZones returns the domains as DNS zones, used to select solvers.
+func dnsZones(domains []domain.Domain) pulumi.StringArray {
+	zones := make(pulumi.StringArray, len(domains))
+	for i, d := range domains {
+		zones[i] = pulumi.String(d.String())
+	}
+	return zones
+}
+
+// route53Solver returns a Route53 DNS-01 solver for the domains, following CNAME records if follow is true.
+func route53Solver(args CertManagerArgs, domains []domain.Domain, follow bool) pulumi.Map {
+	route53 := pulumi.Map{
+		"region": pulumi.String(args.Route53.Region),
+	}
+	if args.Route53.AccessKeyID != nil {
+		route53["accessKeyIDSecretRef"] = pulumi.Map{
+			"name": pulumi.String(route53SecretName),
+			"key":  pulumi.String("access-key-id"),
+		}
+		route53["secretAccessKeySecretRef"] = pulumi.Map{
+			"name": pulumi.String(route53SecretName),
+			"key":  pulumi.String("secret-access-key"),
+		}
+	}
+	dns01 := pulumi.Map{
+		"route53": route53,
+	}
+	if follow {
+		// Follow challenge delegation, see https://cert-manager.io/docs/configuration/acme/dns01/#delegated-domains-for-dns01
+		dns01["cnameStrategy"] = pulumi.String("Follow")
+	}
+	return pulumi.Map{
+		"selector": pulumi.Map{
+			"dnsZones": dnsZones(domains),
+		},
+		"dns01": dns01,
+	}
+}
+
+// deployACMEIssuer deploys the ACME issuer, with DNS-01 solvers picked per domain registrar, along with solvers
+// credentials, applying opts to all created resources, and returns an error if any.
+func deployACMEIssuer(
+	ctx *pulumi.Context,
+	args CertManagerArgs,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	solvers := pulumi.Array{}
+
+	if len(args.AwsRegisteredDomains)+len(args.SquarespaceRegisteredDomains) > 0 &&
+		args.Route53.AccessKeyID != nil {
+		_, err := corev1.NewSecret(ctx, route53SecretName, &corev1.SecretArgs{
+			Metadata: &metav1.ObjectMetaArgs{
+				Name:      pulumi.String(route53SecretName),
+				Namespace: pulumi.String(args.IssuerNamespace),
+				Labels:    sharedLabels,
+			},
+			StringData: pulumi.StringMap{
+				"access-key-id":     args.Route53.AccessKeyID,
+				"secret-access-key": pulumi.ToSecret(args.Route53.SecretAccessKey).(pulumi.StringOutput),
+			},
+		}, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to create route53 credentials secret: %w", err)
+		}
+	}
+	if len(args.AwsRegisteredDomains) > 0 {
+		solvers = append(solvers, route53Solver(args, args.AwsRegisteredDomains, false))
+	}
+	if len(args.SquarespaceRegisteredDomains) > 0 {
+		solvers = append(solvers, route53Solver(args, args.SquarespaceRegisteredDomains, true))
+	}
+
+	if len(args.CloudflareRegisteredDomains) > 0 {
+		_, err := corev1.NewSecret(ctx, cloudflareSecretName, &corev1.SecretArgs{
+			Metadata: &metav1.ObjectMetaArgs{
+				Name:      pulumi.String(cloudflareSecretName),
+				Namespace: pulumi.String(args.IssuerNamespace),
+				Labels:    sharedLabels,
+			},
+			StringData: pulumi.StringMap{
+				"api-token": pulumi.ToSecret(args.Cloudflare.APIToken).(pulumi.StringOutput),
+			},
+		}, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to create cloudflare api token secret: %w", err)
+		}
+		solvers = append(solvers, pulumi.Map{
+			"selector": pulumi.Map{
+				"dnsZones": dnsZones(args.CloudflareRegisteredDomains),
+			},
+			"dns01": pulumi.Map{
+				"cloudflare": pulumi.Map{
+					"apiTokenSecretRef": pulumi.Map{
+						"name": pulumi.String(cloudflareSecretName),
+						"key":  pulumi.String("api-token"),
+					},
+				},
+			},
+		})
+	}
+
+	_, err := yamlv2.NewConfigGroup(ctx, "acme-issuer", &yamlv2.ConfigGroupArgs{
+		Objs: pulumi.Array{
+			pulumi.Map{
+				"apiVersion": pulumi.String("cert-manager.io/v1"),
+				"kind":       pulumi.String("Issuer"),
+				"metadata": pulumi.Map{
+					"name":      pulumi.String(args.IssuerName),
+					"namespace": pulumi.String(args.IssuerNamespace),
+					"labels":    sharedLabels,
+				},
+				"spec": pulumi.Map{
+					"acme": pulumi.Map{
+						"server": pulumi.String(args.ACMEServer),
+						"email":  pulumi.String(args.ACMEEmail),
+						"privateKeySecretRef": pulumi.Map{
+							"name": pulumi.String(args.IssuerName + "-account-key"),
+						},
+						"solvers": solvers,
+					},
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to deploy acme issuer: %w", err)
+	}
+
+	return nil
+}
+
+// deployInternalCAIssuer deploys the private CA and the ClusterIssuer signing certificates of internal domains, applying
+// opts to all created resources, and returns an error if any.
+func deployInternalCAIssuer(
+	ctx *pulumi.Context,
+	args CertManagerArgs,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	if len(args.InternalDomains) == 0 {
+		return nil
+	}
+
+	_, err := yamlv2.NewConfigGroup(ctx, InternalCAIssuerName, &yamlv2.ConfigGroupArgs{
+		Objs: pulumi.Array{
+			// Bootstrap the CA using a self-signed certificate
+			pulumi.Map{
+				"apiVersion": pulumi.String("cert-manager.io/v1"),
+				"kind":       pulumi.String("Issuer"),
+				"metadata": pulumi.Map{
+					"name":      pulumi.String(selfSignedIssuerName),
+					"namespace": pulumi.String(Namespace),
+					"labels":    sharedLabels,
+				},
+				"spec": pulumi.Map{
+					"selfSigned": pulumi.Map{},
+				},
+			},
+			pulumi.Map{
+				"apiVersion": pulumi.String("cert-manager.io/v1"),
+				"kind":       pulumi.String("Certificate"),
+				"metadata": pulumi.Map{
+					"name":      pulumi.String(InternalCAIssuerName),
+					"namespace": pulumi.String(Namespace),
+					"labels":    sharedLabels,
+				},
+				"spec": pulumi.Map{
+					"isCA":       pulumi.Bool(true),
+					"commonName": pulumi.String(args.InternalDomains[0].String() + " internal CA"),
+					"secretName": pulumi.String(InternalCAIssuerName),
+					// Renew CA well before expiry, as issued certificates chain up to it
+					"duration":    pulumi.String("87600h"),
+					"renewBefore": pulumi.String("8760h"),
+					"privateKey": pulumi.Map{
+						"algorithm": pulumi.String("ECDSA"),
+						"size":      pulumi.Int(384),
+					},
+					"issuerRef": pulumi.Map{
+						"name":  pulumi.String(selfSignedIssuerName),
+						"kind":  pulumi.String("Issuer"),
+						"group": pulumi.String("cert-manager.io"),
+					},
+				},
+			},
+			pulumi.Map{
+				"apiVersion": pulumi.String("cert-manager.io/v1"),
+				"kind":       pulumi.String("ClusterIssuer"),
+				"metadata": pulumi.Map{
+					"name":   pulumi.String(InternalCAIssuerName),
+					"labels": sharedLabels,
+				},
+				"spec": pulumi.Map{
+					"ca": pulumi.Map{
+						"secretName": pulumi.String(InternalCAIssuerName),
+					},
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to deploy internal ca issuer: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package cni
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// An AccessLogSink represents where gateway access logs are emitted to.
+type AccessLogSink string
+
+const (
+	// AccessLogSinkStdout emits access logs to the collector standard output, as OTLP JSON lines.
+	AccessLogSinkStdout AccessLogSink = "stdout"
+	// AccessLogSinkOTLP emits access logs to FlowExportArgs.OTelEndpointUrl.
+	AccessLogSinkOTLP AccessLogSink = "otlp"
+)
+
+const (
+	// accessLogReceiver is the name of the collector receiver reading access logs.
+	accessLogReceiver = "filelog/access"
+	// accessLogLatencyAttribute is the attribute holding request latency, in nanoseconds, as semantic conventions have
+	// no log attribute for it.
+	accessLogLatencyAttribute = "http.server.request.duration_ns"
+)
+
+// An AccessLogRedaction contains the fields removed from access logs and exported L7 flows of applications handling
+// sensitive data, i.e. pods carrying the [label.AccessLogRedactLabelKey] label. As Envoy logs cannot be attributed to
+// applications, their debug and trace records, that may dump requests, are dropped.
+type AccessLogRedaction struct {
+	// URLQuery is a boolean indicating if URL query strings should be removed.
+	URLQuery bool
+	// Headers is a boolean indicating if request headers should be removed.
+	Headers bool
+}
+
+// An AccessLogArgs contains all the parameters needed to log requests served by gateways. Requests are reported to
+// Hubble by gateways Envoy as L7 flows, that are exported along with other flows and mapped to semantic conventions
+// attributes. It requires FlowExportArgs.Mode to be FlowExportModeDynamic.
+type AccessLogArgs struct {
+	// Sink is where access logs are emitted to.
+	Sink AccessLogSink
+	// FileName is the name of the file access logs are exported to, in Hubble run directory on each node.
+	FileName string
+	// Redaction contains the fields removed from access logs and exported flows of sensitive applications. No field is
+	// removed if nil.
+	Redaction *AccessLogRedaction
+}
+
+// AccessLogDefaultArgs are the default access log parameters.
+var AccessLogDefaultArgs = AccessLogArgs{
+	Sink:     AccessLogSinkStdout,
+	FileName: "access.log",
+}
+
+// validateAccessLogArgs validates the access log parameters along with the flow export ones, returning an error if any
+// of them is invalid.
+func validateAccessLogArgs(args AccessLogArgs, flowExport FlowExportArgs) error {
+	if !slices.Contains([]AccessLogSink{AccessLogSinkStdout, AccessLogSinkOTLP}, args.Sink) {
+		return fmt.Errorf("Sink %q is invalid", args.Sink)
+	}
+	if args.FileName == "" {
+		return fmt.Errorf("FileName cannot be empty")
+	}
+	if args.FileName == flowExport.FileName {
+		return fmt.Errorf("FileName %s is already used by flow export", args.FileName)
+	}
+	if flowExport.Mode != FlowExportModeDynamic {
+		return fmt.Errorf("access logs require flow export Mode %s", FlowExportModeDynamic)
+	}
+	if args.Sink == AccessLogSinkOTLP && flowExport.OTelEndpointUrl.String() == "" {
+		return fmt.Errorf("Sink %s requires flow export OTelEndpointUrl", args.Sink)
+	}
+	return nil
+}
+
+// accessLogExport returns the Hubble dynamic export configuration of gateways access logs.
+func accessLogExport(args AccessLogArgs) pulumi.Map {
+	return pulumi.Map{
+		"name":     pulumi.String("access"),
+		"filePath": pulumi.String(flowExportDir + "/" + args.FileName),
+		"fieldMask": pulumi.StringArray{
+			pulumi.String("time"),
+			pulumi.String("node_name"),
+			pulumi.String("IP"),
+			pulumi.String("source"),
+			pulumi.String("destination"),
+			pulumi.String("l7"),
+			pulumi.String("trace_context"),
+		},
+		// Responses of requests proxied by gateways, holding request fields along with status and latency
+		"includeFilters": pulumi.Array{
+			pulumi.Map{
+				"destination_label": pulumi.StringArray{pulumi.String("reserved:ingress")},
+				"protocol":          pulumi.StringArray{pulumi.String("http")},
+				"reply":             pulumi.BoolArray{pulumi.Bool(true)},
+			},
+		},
+	}
+}
+
+// forwardedForHeader is the expression of the value of the X-Forwarded-For header of a flow, to which gateways Envoy
+// append the address of the client.
+const forwardedForHeader = `filter(body.flow.l7.http.headers, {lower(#.key) == "x-forwarded-for"})[0].value`
+
+// redactionOperators returns the collector operators removing the sensitive fields of L7 flows from or to pods
+// carrying the [label.AccessLogRedactLabelKey] label, none if redaction is nil.
+func redactionOperators(redaction *AccessLogRedaction) []map[string]any {
+	if redaction == nil {
+		return nil
+	}
+	sensitiveLabel := `"k8s:` + label.AccessLogRedactLabelKey + `=` + label.AccessLogRedactLabelValue + `"`
+	// Requests are sent to applications, replies are sent by applications
+	sensitive := "((body.flow.source?.labels != nil and " + sensitiveLabel + " in body.flow.source.labels) or " +
+		"(body.flow.destination?.labels != nil and " + sensitiveLabel + " in body.flow.destination.labels))"
+	operators := []map[string]any{}
+	if redaction.URLQuery {
+		operators = append(operators, map[string]any{
+			"type":  "add",
+			"field": "body.flow.l7.http.url",
+			"value": `EXPR(split(body.flow.l7.http.url, "?")[0])`,
+			"if":    sensitive + " and body.flow.l7?.http?.url != nil",
+		})
+	}
+	if redaction.Headers {
+		operators = append(operators, map[string]any{
+			"type":  "remove",
+			"field": "body.flow.l7.http.headers",
+			"if":    sensitive + " and body.flow.l7?.http?.headers != nil",
+		})
+	}
+	return operators
+}
+
+// accessLogReceiverConfig returns the collector receiver reading access logs, mapping fields to semantic conventions
+// attributes and redacting them as configured.
+func accessLogReceiverConfig(args AccessLogArgs) map[string]any {
+	operators := []map[string]any{
+		{
+			"type":     "json_parser",
+			"parse_to": "body",
+			"timestamp": map[string]any{
+				"parse_from":  "body.time",
+				"layout_type": "gotime",
+				"layout":      "2006-01-02T15:04:05.999999999Z07:00",
+			},
+		},
+	}
+	// Read client address before headers are redacted
+	operators = append(operators, map[string]any{
+		"type":  "add",
+		"field": `attributes["` + string(semconv.HTTPClientIPKey) + `"]`,
+		"value": `EXPR(trim(last(split(` + forwardedForHeader + `, ","))))`,
+		"if":    `body.flow.l7?.http?.headers != nil and any(body.flow.l7.http.headers, {lower(#.key) == "x-forwarded-for"})`,
+	})
+	operators = append(operators, redactionOperators(args.Redaction)...)
+	operators = append(operators,
+		flowAttribute("body.flow.l7.http.method", string(semconv.HTTPMethodKey)),
+		flowAttribute("body.flow.l7.http.url", string(semconv.HTTPURLKey)),
+		flowAttribute("body.flow.l7.http.code", string(semconv.HTTPStatusCodeKey)),
+		flowAttribute("body.flow.l7.latency_ns", accessLogLatencyAttribute),
+		// Replies are sent by upstreams to gateways Envoy, the client address being read from forwarding headers
+		flowAttribute("body.flow.IP.source", string(semconv.NetHostIPKey)),
+		flowAttribute("body.flow.IP.destination", string(semconv.NetPeerIPKey)),
+		flowAttribute("body.flow.source.namespace", string(semconv.K8SNamespaceNameKey)),
+		flowAttribute("body.flow.source.pod_name", string(semconv.K8SPodNameKey)),
+		flowAttribute("body.flow.node_name", string(semconv.K8SNodeNameKey)),
+		map[string]any{
+			"type": "trace_parser",
+			"trace_id": map[string]any{
+				"parse_from": "body.flow.trace_context.parent.trace_id",
+			},
+			"if": "body.flow.trace_context?.parent?.trace_id != nil",
+		},
+	)
+	return map[string]any{
+		"include":   []string{flowExportDir + "/" + args.FileName},
+		"start_at":  "end",
+		"operators": operators,
+	}
+}
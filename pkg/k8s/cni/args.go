@@ -0,0 +1,444 @@
+package cni
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"dario.cat/mergo"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/ipam"
+	"github.com/kemadev/infrastructure-components/pkg/private/domain"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// An IPFamily represents the IP families enabled in the cluster.
+type IPFamily string
+
+const (
+	// IPFamilyIPv4 enables IPv4 only.
+	IPFamilyIPv4 IPFamily = "ipv4"
+	// IPFamilyIPv6 enables IPv6 only.
+	IPFamilyIPv6 IPFamily = "ipv6"
+	// IPFamilyDualStack enables both IPv4 and IPv6.
+	IPFamilyDualStack IPFamily = "dual-stack"
+)
+
+// HasIPv4 returns whether the IP family includes IPv4.
+func (f IPFamily) HasIPv4() bool {
+	return f == IPFamilyIPv4 || f == IPFamilyDualStack
+}
+
+// HasIPv6 returns whether the IP family includes IPv6.
+func (f IPFamily) HasIPv6() bool {
+	return f == IPFamilyIPv6 || f == IPFamilyDualStack
+}
+
+// A RoutingMode represents how pod traffic is forwarded between nodes, see https://docs.cilium.io/en/stable/network/concepts/routing/.
+type RoutingMode string
+
+const (
+	// RoutingModeNative forwards packets using the underlying network routing, without encapsulation.
+	RoutingModeNative RoutingMode = "native"
+	// RoutingModeTunnel encapsulates packets between nodes (VXLAN or Geneve).
+	RoutingModeTunnel RoutingMode = "tunnel"
+)
+
+// An EncryptionMode represents the transparent encryption method, see https://docs.cilium.io/en/stable/security/network/encryption/.
+type EncryptionMode string
+
+const (
+	// EncryptionModeNone disables transparent encryption.
+	EncryptionModeNone EncryptionMode = "none"
+	// EncryptionModeWireGuard uses WireGuard for transparent encryption.
+	EncryptionModeWireGuard EncryptionMode = "wireguard"
+	// EncryptionModeIPsec uses IPsec for transparent encryption. It requires the IPsec keys secret to be created beforehand,
+	// see https://docs.cilium.io/en/stable/security/network/encryption-ipsec/.
+	EncryptionModeIPsec EncryptionMode = "ipsec"
+)
+
+// A DatapathMode represents the mode for pod devices of the core datapath.
+type DatapathMode string
+
+const (
+	// DatapathModeVeth uses veth devices.
+	DatapathModeVeth DatapathMode = "veth"
+	// DatapathModeNetkit uses netkit devices, requiring Linux 6.8 or newer.
+	DatapathModeNetkit DatapathMode = "netkit"
+	// DatapathModeNetkitL2 uses netkit devices in L2 mode, requiring Linux 6.8 or newer.
+	DatapathModeNetkitL2 DatapathMode = "netkit-l2"
+)
+
+// A LBAcceleration represents the XDP acceleration mode of the load balancer, see https://docs.cilium.io/en/stable/operations/performance/tuning/#xdp-acceleration.
+type LBAcceleration string
+
+const (
+	// LBAccelerationDisabled disables XDP acceleration, for NICs without XDP support.
+	LBAccelerationDisabled LBAcceleration = "disabled"
+	// LBAccelerationNative enables XDP acceleration, failing on devices that don't support it.
+	LBAccelerationNative LBAcceleration = "native"
+	// LBAccelerationBestEffort enables XDP acceleration on devices that support it.
+	LBAccelerationBestEffort LBAcceleration = "best-effort"
+)
+
+// A LBMode represents how the load balancer forwards traffic to remote backends, see https://docs.cilium.io/en/stable/network/kubernetes/kubeproxy-free/#dsr-mode.
+type LBMode string
+
+const (
+	// LBModeSNAT masquerades traffic to remote backends, replies going back through the load balancing node.
+	LBModeSNAT LBMode = "snat"
+	// LBModeDSR uses direct server return for all traffic, backends replying to clients directly.
+	LBModeDSR LBMode = "dsr"
+	// LBModeHybrid uses direct server return for TCP traffic and SNAT for UDP traffic.
+	LBModeHybrid LBMode = "hybrid"
+)
+
+// A TunnelProtocol represents the encapsulation protocol used in tunnel routing mode.
+type TunnelProtocol string
+
+const (
+	// TunnelProtocolVXLAN uses VXLAN encapsulation.
+	TunnelProtocolVXLAN TunnelProtocol = "vxlan"
+	// TunnelProtocolGeneve uses Geneve encapsulation.
+	TunnelProtocolGeneve TunnelProtocol = "geneve"
+)
+
+// A LBAnnouncement represents how load balancer IPs are announced to the network.
+type LBAnnouncement string
+
+const (
+	// LBAnnouncementL2 announces IPs using ARP / NDP, requiring nodes to share an L2 segment, see https://docs.cilium.io/en/stable/network/l2-announcements/.
+	LBAnnouncementL2 LBAnnouncement = "l2"
+	// LBAnnouncementBGP announces IPs to peer routers over BGP, see https://docs.cilium.io/en/stable/network/bgp-control-plane/bgp-control-plane/.
+	LBAnnouncementBGP LBAnnouncement = "bgp"
+)
+
+// A SPIRECAKeyType represents the key type of the SPIRE server CA, see https://spiffe.io/docs/latest/deploying/spire_server/#server-configuration-file.
+type SPIRECAKeyType string
+
+const (
+	// SPIRECAKeyTypeRSA2048 uses 2048 bits RSA keys.
+	SPIRECAKeyTypeRSA2048 SPIRECAKeyType = "rsa-2048"
+	// SPIRECAKeyTypeRSA4096 uses 4096 bits RSA keys.
+	SPIRECAKeyTypeRSA4096 SPIRECAKeyType = "rsa-4096"
+	// SPIRECAKeyTypeECP256 uses NIST P-256 ECDSA keys.
+	SPIRECAKeyTypeECP256 SPIRECAKeyType = "ec-p256"
+	// SPIRECAKeyTypeECP384 uses NIST P-384 ECDSA keys.
+	SPIRECAKeyTypeECP384 SPIRECAKeyType = "ec-p384"
+)
+
+// maglevTableSizes are the allowed Maglev table sizes, see https://docs.cilium.io/en/stable/network/kubernetes/kubeproxy-free/#maglev-consistent-hashing.
+var maglevTableSizes = []int{251, 509, 1021, 2039, 4093, 8191, 16381, 32749, 65521, 131071}
+
+// A CNIArgs contains all the parameters needed to deploy the CNI.
+type CNIArgs struct {
+	// Version is the Cilium Helm chart version.
+	Version string
+	// IPFamily is the IP families to enable in the cluster.
+	IPFamily IPFamily
+	// RoutingMode is the routing mode between nodes.
+	RoutingMode RoutingMode
+	// TunnelProtocol is the encapsulation protocol, used in tunnel routing mode only.
+	TunnelProtocol TunnelProtocol
+	// Encryption is the transparent encryption method.
+	Encryption EncryptionMode
+	// WireGuardPersistentKeepalive is the interval of WireGuard keepalive packets, e.g. to keep NAT mappings open, used
+	// with WireGuard encryption only. Keepalives are not sent if zero.
+	WireGuardPersistentKeepalive time.Duration
+	// IPsecKeysSecret is the name of the secret holding IPsec keys, used with IPsec encryption only. Defaults to Cilium
+	// one if empty.
+	IPsecKeysSecret string
+	// DatapathMode is the mode for pod devices of the core datapath.
+	DatapathMode DatapathMode
+	// LBAcceleration is the XDP acceleration mode of the load balancer.
+	LBAcceleration LBAcceleration
+	// LBMode is how the load balancer forwards traffic to remote backends. Direct server return requires native routing
+	// or Geneve tunnel protocol.
+	LBMode LBMode
+	// LBAnnouncement is how load balancer IPs are announced to the network. Using BGP, peering is configured by the
+	// gateway package.
+	LBAnnouncement LBAnnouncement
+	// L2LeaseDuration is the duration of the leases electing the node announcing each IP, used with L2 announcements
+	// only. Lower values fail over faster at the expense of API server load. Defaults to Cilium one if zero.
+	L2LeaseDuration time.Duration
+	// BGPSecretsNamespace is the namespace of the secrets holding BGP peers passwords, used with BGP announcements
+	// only. Defaults to Cilium one if empty.
+	BGPSecretsNamespace string
+	// MaglevTableSize is the Maglev lookup table size, must be a prime number among the ones supported by Cilium.
+	MaglevTableSize int
+	// Allocation contains the CIDRs allocated to the cluster, e.g. returned by ipam.Pin. Unset pod CIDRs are taken from
+	// it.
+	Allocation *ipam.ClusterAllocation
+	// IPv4PodCIDR is the IPv4 CIDR pod IPs are allocated from, required when IPFamily includes IPv4. Defaults to
+	// Allocation IPv4 pod CIDR.
+	IPv4PodCIDR string
+	// IPv4PodCIDRMaskSize is the mask size of IPv4 pod CIDRs allocated to each node.
+	IPv4PodCIDRMaskSize int
+	// IPv4NativeRoutingCIDR is the IPv4 CIDR that can be reached without masquerading in native routing mode. Defaults
+	// to IPv4PodCIDR.
+	IPv4NativeRoutingCIDR string
+	// IPv6PodCIDR is the IPv6 CIDR pod IPs are allocated from. Defaults to Allocation IPv6 pod CIDR. If unset while
+	// IPFamily includes IPv6, a random ULA prefix is generated, see [RandomIPv6ULARoutingPrefix].
+	IPv6PodCIDR string
+	// IPv6PodCIDRMaskSize is the mask size of IPv6 pod CIDRs allocated to each node, used along with IPv6PodCIDR.
+	IPv6PodCIDRMaskSize int
+	// IPv6NativeRoutingCIDR is the IPv6 CIDR that can be reached without masquerading in native routing mode, used along
+	// with IPv6PodCIDR. Defaults to IPv6PodCIDR.
+	IPv6NativeRoutingCIDR string
+	// MutualAuthentication enables mutual authentication of workloads, installing SPIRE through the Cilium chart, see
+	// https://docs.cilium.io/en/stable/network/servicemesh/mutual-authentication/mutual-authentication/. Network policies
+	// then require it per rule, using `authentication.mode: required`.
+	MutualAuthentication bool
+	// SPIRECAKeyType is the key type of the SPIRE server CA, used along with MutualAuthentication.
+	SPIRECAKeyType SPIRECAKeyType
+	// SPIRETrustDomain is the SPIFFE trust domain, used along with MutualAuthentication.
+	SPIRETrustDomain string
+	// BPFMasquerade enables eBPF based masquerading of traffic leaving the cluster, see
+	// https://docs.cilium.io/en/stable/network/concepts/masquerading/.
+	BPFMasquerade bool
+	// EgressGateway enables the egress gateway feature, routing selected pods outbound traffic through dedicated nodes,
+	// see https://docs.cilium.io/en/stable/network/egress-gateway/egress-gateway/. It requires BPFMasquerade and IPv4.
+	EgressGateway bool
+	// HostFirewall is how the baseline host firewall policies are applied. Policies should be audited, using Hubble
+	// policy verdicts, before being enforced.
+	HostFirewall HostFirewallMode
+	// HostFirewallManagementCIDRs are the CIDRs allowed to reach nodes over SSH, e.g. bastion hosts ones. Nodes are not
+	// reachable over SSH once host firewall policies are enforced if empty.
+	HostFirewallManagementCIDRs []string
+	// HostFirewallExtraIngress is the traffic allowed to reach all nodes on top of the one required by the cluster.
+	HostFirewallExtraIngress []HostFirewallIngress
+	// ClusterMesh contains the parameters needed to mesh the cluster with peer clusters. ClusterMesh is disabled if nil.
+	ClusterMesh *ClusterMeshArgs
+	// FlowExport contains the parameters needed to export Hubble flows. Flows are not exported if nil.
+	FlowExport *FlowExportArgs
+	// Values are Helm values deeply merged over the ones computed from the other parameters, overriding them.
+	Values pulumi.Map
+}
+
+// CNIDefaultArgs are the default CNI parameters.
+var CNIDefaultArgs = CNIArgs{
+	// TODO add renovate tracking
+	Version:             "1.17.4",
+	IPFamily:            IPFamilyIPv6,
+	RoutingMode:         RoutingModeNative,
+	TunnelProtocol:      TunnelProtocolVXLAN,
+	Encryption:          EncryptionModeWireGuard,
+	DatapathMode:        DatapathModeNetkit,
+	LBAcceleration:      LBAccelerationBestEffort,
+	LBMode:              LBModeHybrid,
+	LBAnnouncement:      LBAnnouncementL2,
+	MaglevTableSize:     16381,
+	IPv4PodCIDRMaskSize: 24,
+	IPv6PodCIDRMaskSize: 120,
+	HostFirewall:        HostFirewallModeAudit,
+	SPIRECAKeyType:      SPIRECAKeyTypeECP384,
+	SPIRETrustDomain:    domain.DomainKemaDotInternal.String(),
+}
+
+// validateArgs validates the CNI parameters, returning an error if any of them is invalid or if they are incompatible.
+func validateArgs(args CNIArgs) error {
+	if args.Version == "" {
+		return fmt.Errorf("Version cannot be empty")
+	}
+	if !slices.Contains([]IPFamily{IPFamilyIPv4, IPFamilyIPv6, IPFamilyDualStack}, args.IPFamily) {
+		return fmt.Errorf("IPFamily %q is invalid", args.IPFamily)
+	}
+	if !slices.Contains([]RoutingMode{RoutingModeNative, RoutingModeTunnel}, args.RoutingMode) {
+		return fmt.Errorf("RoutingMode %q is invalid", args.RoutingMode)
+	}
+	if !slices.Contains([]TunnelProtocol{TunnelProtocolVXLAN, TunnelProtocolGeneve}, args.TunnelProtocol) {
+		return fmt.Errorf("TunnelProtocol %q is invalid", args.TunnelProtocol)
+	}
+	if !slices.Contains(
+		[]EncryptionMode{EncryptionModeNone, EncryptionModeWireGuard, EncryptionModeIPsec},
+		args.Encryption,
+	) {
+		return fmt.Errorf("Encryption %q is invalid", args.Encryption)
+	}
+	if !slices.Contains(
+		[]DatapathMode{DatapathModeVeth, DatapathModeNetkit, DatapathModeNetkitL2},
+		args.DatapathMode,
+	) {
+		return fmt.Errorf("DatapathMode %q is invalid", args.DatapathMode)
+	}
+	if !slices.Contains(
+		[]LBAcceleration{LBAccelerationDisabled, LBAccelerationNative, LBAccelerationBestEffort},
+		args.LBAcceleration,
+	) {
+		return fmt.Errorf("LBAcceleration %q is invalid", args.LBAcceleration)
+	}
+	if !slices.Contains([]LBAnnouncement{LBAnnouncementL2, LBAnnouncementBGP}, args.LBAnnouncement) {
+		return fmt.Errorf("LBAnnouncement %q is invalid", args.LBAnnouncement)
+	}
+	if !slices.Contains([]LBMode{LBModeSNAT, LBModeDSR, LBModeHybrid}, args.LBMode) {
+		return fmt.Errorf("LBMode %q is invalid", args.LBMode)
+	}
+	if args.LBMode != LBModeSNAT && args.RoutingMode == RoutingModeTunnel && args.TunnelProtocol != TunnelProtocolGeneve {
+		return fmt.Errorf(
+			"LBMode %s requires native routing or %s tunnel protocol, TunnelProtocol is %s",
+			args.LBMode,
+			TunnelProtocolGeneve,
+			args.TunnelProtocol,
+		)
+	}
+	if args.WireGuardPersistentKeepalive < 0 {
+		return fmt.Errorf("WireGuardPersistentKeepalive cannot be negative")
+	}
+	if args.WireGuardPersistentKeepalive != 0 && args.Encryption != EncryptionModeWireGuard {
+		return fmt.Errorf("WireGuardPersistentKeepalive requires %s encryption, Encryption is %s", EncryptionModeWireGuard, args.Encryption)
+	}
+	if args.IPsecKeysSecret != "" && args.Encryption != EncryptionModeIPsec {
+		return fmt.Errorf("IPsecKeysSecret requires %s encryption, Encryption is %s", EncryptionModeIPsec, args.Encryption)
+	}
+	if args.L2LeaseDuration < 0 {
+		return fmt.Errorf("L2LeaseDuration cannot be negative")
+	}
+	if args.L2LeaseDuration != 0 && args.LBAnnouncement != LBAnnouncementL2 {
+		return fmt.Errorf("L2LeaseDuration requires %s announcements, LBAnnouncement is %s", LBAnnouncementL2, args.LBAnnouncement)
+	}
+	if args.BGPSecretsNamespace != "" && args.LBAnnouncement != LBAnnouncementBGP {
+		return fmt.Errorf("BGPSecretsNamespace requires %s announcements, LBAnnouncement is %s", LBAnnouncementBGP, args.LBAnnouncement)
+	}
+	if !slices.Contains(maglevTableSizes, args.MaglevTableSize) {
+		return fmt.Errorf("MaglevTableSize %d is invalid, must be one of %v", args.MaglevTableSize, maglevTableSizes)
+	}
+	if args.EgressGateway && !args.BPFMasquerade {
+		return fmt.Errorf("EgressGateway requires BPFMasquerade")
+	}
+	if args.EgressGateway && !args.IPFamily.HasIPv4() {
+		return fmt.Errorf("EgressGateway requires IPv4, IPFamily is %s", args.IPFamily)
+	}
+	if !slices.Contains([]HostFirewallMode{HostFirewallModeAudit, HostFirewallModeEnforce}, args.HostFirewall) {
+		return fmt.Errorf("HostFirewall %q is invalid", args.HostFirewall)
+	}
+	for _, c := range args.HostFirewallManagementCIDRs {
+		_, err := netip.ParsePrefix(c)
+		if err != nil {
+			return fmt.Errorf("HostFirewallManagementCIDRs CIDR %q is invalid: %w", c, err)
+		}
+	}
+	for i, ingress := range args.HostFirewallExtraIngress {
+		err := validateHostFirewallIngress(ingress)
+		if err != nil {
+			return fmt.Errorf("HostFirewallExtraIngress %d is invalid: %w", i, err)
+		}
+	}
+	if !slices.Contains(
+		[]SPIRECAKeyType{SPIRECAKeyTypeRSA2048, SPIRECAKeyTypeRSA4096, SPIRECAKeyTypeECP256, SPIRECAKeyTypeECP384},
+		args.SPIRECAKeyType,
+	) {
+		return fmt.Errorf("SPIRECAKeyType %q is invalid", args.SPIRECAKeyType)
+	}
+	if args.SPIRETrustDomain == "" {
+		return fmt.Errorf("SPIRETrustDomain cannot be empty")
+	}
+	if args.IPFamily.HasIPv4() {
+		if args.IPv4PodCIDR == "" {
+			return fmt.Errorf("IPv4PodCIDR cannot be empty when IPFamily is %s", args.IPFamily)
+		}
+		err := validatePodCIDR(
+			"IPv4",
+			args.IPv4PodCIDR,
+			args.IPv4PodCIDRMaskSize,
+			args.IPv4NativeRoutingCIDR,
+			true,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if args.IPFamily.HasIPv6() && args.IPv6PodCIDR != "" {
+		err := validatePodCIDR(
+			"IPv6",
+			args.IPv6PodCIDR,
+			args.IPv6PodCIDRMaskSize,
+			args.IPv6NativeRoutingCIDR,
+			false,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePodCIDR validates pod CIDR parameters of the given IP family, returning an error if any of them is invalid.
+func validatePodCIDR(family string, podCIDR string, maskSize int, nativeRoutingCIDR string, isIPv4 bool) error {
+	pod, err := netip.ParsePrefix(podCIDR)
+	if err != nil || pod.Addr().Is4() != isIPv4 {
+		return fmt.Errorf("%sPodCIDR %q is not a valid %s CIDR", family, podCIDR, family)
+	}
+	if maskSize <= pod.Bits() || maskSize > pod.Addr().BitLen() {
+		return fmt.Errorf(
+			"%sPodCIDRMaskSize %d must be greater than %sPodCIDR mask size %d and at most %d",
+			family,
+			maskSize,
+			family,
+			pod.Bits(),
+			pod.Addr().BitLen(),
+		)
+	}
+	native, err := netip.ParsePrefix(nativeRoutingCIDR)
+	if err != nil || native.Addr().Is4() != isIPv4 {
+		return fmt.Errorf("%sNativeRoutingCIDR %q is not a valid %s CIDR", family, nativeRoutingCIDR, family)
+	}
+	if native.Bits() > pod.Bits() || !native.Contains(pod.Addr()) {
+		return fmt.Errorf("%sNativeRoutingCIDR %s must contain %sPodCIDR %s", family, nativeRoutingCIDR, family, podCIDR)
+	}
+	return nil
+}
+
+// mergeArgs fills unset CNI parameters with their default values and validates them, returning an error if any of
+// them is invalid.
+func mergeArgs(args *CNIArgs) error {
+	err := mergo.Merge(args, CNIDefaultArgs)
+	if err != nil {
+		return fmt.Errorf("error filling cni parameters: %w", err)
+	}
+	if args.Allocation != nil {
+		if args.IPv4PodCIDR == "" && args.Allocation.IPv4PodCIDR.IsValid() {
+			args.IPv4PodCIDR = args.Allocation.IPv4PodCIDR.String()
+		}
+		if args.IPv6PodCIDR == "" && args.Allocation.IPv6PodCIDR.IsValid() {
+			args.IPv6PodCIDR = args.Allocation.IPv6PodCIDR.String()
+		}
+	}
+	if args.IPv4NativeRoutingCIDR == "" {
+		args.IPv4NativeRoutingCIDR = args.IPv4PodCIDR
+	}
+	if args.IPv6NativeRoutingCIDR == "" {
+		args.IPv6NativeRoutingCIDR = args.IPv6PodCIDR
+	}
+	if args.ClusterMesh != nil && args.ClusterMesh.APIServerPort == 0 {
+		// Copy parameters before filling them, not to modify the caller ones
+		clusterMesh := *args.ClusterMesh
+		clusterMesh.APIServerPort = clusterMeshDefaultPort
+		args.ClusterMesh = &clusterMesh
+	}
+	err = validateArgs(*args)
+	if err != nil {
+		return fmt.Errorf("error validating cni parameters: %w", err)
+	}
+	if args.FlowExport != nil {
+		// Copy parameters before filling them, not to modify the caller ones
+		flowExport := *args.FlowExport
+		err = mergo.Merge(&flowExport, FlowExportDefaultArgs)
+		if err != nil {
+			return fmt.Errorf("error filling flow export parameters: %w", err)
+		}
+		if flowExport.AccessLog != nil {
+			accessLog := *flowExport.AccessLog
+			err = mergo.Merge(&accessLog, AccessLogDefaultArgs)
+			if err != nil {
+				return fmt.Errorf("error filling access log parameters: %w", err)
+			}
+			flowExport.AccessLog = &accessLog
+		}
+		args.FlowExport = &flowExport
+		err = validateFlowExportArgs(*args.FlowExport)
+		if err != nil {
+			return fmt.Errorf("error validating flow export parameters: %w", err)
+		}
+	}
+	return nil
+}
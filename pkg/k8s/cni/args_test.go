@@ -0,0 +1,170 @@
+package cni
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateArgsCombinations(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(args *CNIArgs)
+		wantErr bool
+	}{
+		{
+			name:    "defaults",
+			modify:  func(args *CNIArgs) {},
+			wantErr: false,
+		},
+		{
+			name: "dsr with native routing",
+			modify: func(args *CNIArgs) {
+				args.LBMode = LBModeDSR
+			},
+			wantErr: false,
+		},
+		{
+			name: "dsr with vxlan tunnel",
+			modify: func(args *CNIArgs) {
+				args.RoutingMode = RoutingModeTunnel
+				args.TunnelProtocol = TunnelProtocolVXLAN
+				args.LBMode = LBModeDSR
+			},
+			wantErr: true,
+		},
+		{
+			name: "hybrid with vxlan tunnel",
+			modify: func(args *CNIArgs) {
+				args.RoutingMode = RoutingModeTunnel
+				args.TunnelProtocol = TunnelProtocolVXLAN
+			},
+			wantErr: true,
+		},
+		{
+			name: "hybrid with geneve tunnel",
+			modify: func(args *CNIArgs) {
+				args.RoutingMode = RoutingModeTunnel
+				args.TunnelProtocol = TunnelProtocolGeneve
+			},
+			wantErr: false,
+		},
+		{
+			name: "snat with vxlan tunnel",
+			modify: func(args *CNIArgs) {
+				args.RoutingMode = RoutingModeTunnel
+				args.TunnelProtocol = TunnelProtocolVXLAN
+				args.LBMode = LBModeSNAT
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid lb mode",
+			modify: func(args *CNIArgs) {
+				args.LBMode = "random"
+			},
+			wantErr: true,
+		},
+		{
+			name: "wireguard keepalive with wireguard",
+			modify: func(args *CNIArgs) {
+				args.WireGuardPersistentKeepalive = 25 * time.Second
+			},
+			wantErr: false,
+		},
+		{
+			name: "wireguard keepalive with ipsec",
+			modify: func(args *CNIArgs) {
+				args.Encryption = EncryptionModeIPsec
+				args.WireGuardPersistentKeepalive = 25 * time.Second
+			},
+			wantErr: true,
+		},
+		{
+			name: "ipsec secret with ipsec",
+			modify: func(args *CNIArgs) {
+				args.Encryption = EncryptionModeIPsec
+				args.IPsecKeysSecret = "ipsec-keys"
+			},
+			wantErr: false,
+		},
+		{
+			name: "ipsec secret with wireguard",
+			modify: func(args *CNIArgs) {
+				args.IPsecKeysSecret = "ipsec-keys"
+			},
+			wantErr: true,
+		},
+		{
+			name: "l2 lease with l2",
+			modify: func(args *CNIArgs) {
+				args.L2LeaseDuration = 5 * time.Second
+			},
+			wantErr: false,
+		},
+		{
+			name: "l2 lease with bgp",
+			modify: func(args *CNIArgs) {
+				args.LBAnnouncement = LBAnnouncementBGP
+				args.L2LeaseDuration = 5 * time.Second
+			},
+			wantErr: true,
+		},
+		{
+			name: "bgp secrets with bgp",
+			modify: func(args *CNIArgs) {
+				args.LBAnnouncement = LBAnnouncementBGP
+				args.BGPSecretsNamespace = "bgp-secrets"
+			},
+			wantErr: false,
+		},
+		{
+			name: "bgp secrets with l2",
+			modify: func(args *CNIArgs) {
+				args.BGPSecretsNamespace = "bgp-secrets"
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := CNIDefaultArgs
+			tt.modify(&args)
+			err := validateArgs(args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMergeArgsKeepsCallerArgs(t *testing.T) {
+	clusterMesh := &ClusterMeshArgs{}
+	accessLog := &AccessLogArgs{}
+	flowExport := &FlowExportArgs{AccessLog: accessLog}
+	args := CNIArgs{
+		IPFamily:    IPFamilyIPv4,
+		IPv4PodCIDR: "10.0.0.0/16",
+		ClusterMesh: clusterMesh,
+		FlowExport:  flowExport,
+	}
+	err := mergeArgs(&args)
+	if err != nil {
+		t.Fatalf("mergeArgs() error = %v", err)
+	}
+
+	if clusterMesh.APIServerPort != 0 {
+		t.Errorf("mergeArgs() modified caller ClusterMesh APIServerPort: %d", clusterMesh.APIServerPort)
+	}
+	if flowExport.AccessLog != accessLog || flowExport.CollectorVersion != "" {
+		t.Errorf("mergeArgs() modified caller FlowExport: %+v", *flowExport)
+	}
+	if accessLog.Sink != "" {
+		t.Errorf("mergeArgs() modified caller AccessLog: %+v", *accessLog)
+	}
+	if args.ClusterMesh.APIServerPort != clusterMeshDefaultPort {
+		t.Errorf("merged ClusterMesh APIServerPort = %d, want %d", args.ClusterMesh.APIServerPort, clusterMeshDefaultPort)
+	}
+	if args.FlowExport.AccessLog.Sink != AccessLogDefaultArgs.Sink {
+		t.Errorf("merged AccessLog Sink = %q, want %q", args.FlowExport.AccessLog.Sink, AccessLogDefaultArgs.Sink)
+	}
+}
@@ -0,0 +1,207 @@
+package cni
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"regexp"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// ExportKeyClusterMesh is the name of the stack output holding the ClusterMesh registration of the cluster, read by
+	// peer clusters through stack references.
+	ExportKeyClusterMesh = "clusterMesh"
+	// clusterMeshDefaultPort is the default port of the clustermesh-apiserver.
+	clusterMeshDefaultPort = 2379
+	// maxClusterMeshID is the highest cluster ID supported by default ClusterMesh configuration, see https://docs.cilium.io/en/stable/network/clustermesh/clustermesh/#prerequisites.
+	maxClusterMeshID = 255
+)
+
+// clusterNameRegexp matches valid Cilium cluster names, see https://docs.cilium.io/en/stable/network/clustermesh/clustermesh/#prerequisites.
+var clusterNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,30}[a-z0-9])?$`)
+
+// A ClusterMeshArgs contains all the parameters needed to mesh the cluster with peer clusters, see
+// https://docs.cilium.io/en/stable/network/clustermesh/clustermesh/.
+type ClusterMeshArgs struct {
+	// ClusterID is the unique ID of the cluster in the mesh, between 1 and 255.
+	ClusterID int
+	// APIServerAddress is the address peer clusters reach the clustermesh-apiserver on, either an IP address, which is
+	// then requested from LB IPAM and must belong to the services pool, see gateway.ServicesPoolArgs, or a hostname.
+	APIServerAddress string
+	// APIServerPort is the port peer clusters reach the clustermesh-apiserver on.
+	APIServerPort int
+	// CACert is the PEM encoded certificate of the CA shared by all clusters of the mesh, signing clustermesh-apiserver
+	// certificates.
+	CACert pulumi.StringInput
+	// CAKey is the PEM encoded private key of the CA shared by all clusters of the mesh.
+	CAKey pulumi.StringInput
+	// PeerStacks are the fully qualified names of the stacks deploying peer clusters, e.g. org/project/stack. Peers are
+	// registered using their [ExportKeyClusterMesh] output.
+	PeerStacks []string
+}
+
+// A ClusterMeshPeer represents a cluster of the mesh, as exported by the stack deploying it.
+type ClusterMeshPeer struct {
+	// Name is the name of the cluster.
+	Name string
+	// ID is the unique ID of the cluster in the mesh.
+	ID int
+	// Address is the address of the clustermesh-apiserver of the cluster.
+	Address string
+	// Port is the port of the clustermesh-apiserver of the cluster.
+	Port int
+}
+
+// validateClusterMeshArgs validates the ClusterMesh parameters of the cluster, returning an error if any of them is
+// invalid.
+func validateClusterMeshArgs(clusterName string, args ClusterMeshArgs) error {
+	if !clusterNameRegexp.MatchString(clusterName) {
+		return fmt.Errorf(
+			"cluster name %q is invalid, must be at most 32 lowercase alphanumeric characters or '-'",
+			clusterName,
+		)
+	}
+	if args.ClusterID < 1 || args.ClusterID > maxClusterMeshID {
+		return fmt.Errorf("ClusterID %d is invalid, must be between 1 and %d", args.ClusterID, maxClusterMeshID)
+	}
+	if args.APIServerAddress == "" {
+		return fmt.Errorf("APIServerAddress cannot be empty")
+	}
+	if args.CACert == nil || args.CAKey == nil {
+		return fmt.Errorf("CACert and CAKey cannot be nil")
+	}
+	return nil
+}
+
+// clusterMeshPeers reads peer clusters registrations from their stacks, applying opts to created stack references, and
+// returns the peers and an error if any.
+func clusterMeshPeers(ctx *pulumi.Context, stacks []string, opts ...pulumi.ResourceOption) (pulumi.ArrayOutput, error) {
+	peers := make(pulumi.Array, 0, len(stacks))
+	for _, stack := range stacks {
+		ref, err := pulumi.NewStackReference(ctx, stack, nil, opts...)
+		if err != nil {
+			return pulumi.ArrayOutput{}, fmt.Errorf("failed to reference peer stack %s: %w", stack, err)
+		}
+		peers = append(peers, ref.GetOutput(pulumi.String(ExportKeyClusterMesh)))
+	}
+	return peers.ToArrayOutput(), nil
+}
+
+// parseClusterMeshPeer parses a peer registration read from a stack reference, returning the peer and an error if any.
+func parseClusterMeshPeer(exported any) (ClusterMeshPeer, error) {
+	m, ok := exported.(map[string]any)
+	if !ok {
+		return ClusterMeshPeer{}, fmt.Errorf("peer stack has no valid %s output", ExportKeyClusterMesh)
+	}
+	name, _ := m["name"].(string)
+	address, _ := m["address"].(string)
+	id, _ := m["id"].(float64)
+	port, _ := m["port"].(float64)
+	if name == "" || address == "" || id == 0 || port == 0 {
+		return ClusterMeshPeer{}, fmt.Errorf("peer stack %s output is incomplete: %v", ExportKeyClusterMesh, m)
+	}
+	return ClusterMeshPeer{
+		Name:    name,
+		ID:      int(id),
+		Address: address,
+		Port:    int(port),
+	}, nil
+}
+
+// exportClusterMesh exports the ClusterMesh registration of the cluster as [ExportKeyClusterMesh].
+func exportClusterMesh(ctx *pulumi.Context, clusterName string, args ClusterMeshArgs) {
+	ctx.Export(ExportKeyClusterMesh, pulumi.Map{
+		"name":    pulumi.String(clusterName),
+		"id":      pulumi.Int(args.ClusterID),
+		"address": pulumi.String(args.APIServerAddress),
+		"port":    pulumi.Int(args.APIServerPort),
+	})
+}
+
+// clusterMeshValues returns the Cilium Helm values meshing the cluster with peers, returning an error if any peer
+// conflicts with the cluster or another peer.
+func clusterMeshValues(
+	clusterName string,
+	args ClusterMeshArgs,
+	peers []ClusterMeshPeer,
+	caCert string,
+	caKey string,
+) (pulumi.Map, error) {
+	names := map[string]bool{clusterName: true}
+	ids := map[int]bool{args.ClusterID: true}
+	clusters := make(pulumi.Array, 0, len(peers))
+	for _, p := range peers {
+		if names[p.Name] {
+			return nil, fmt.Errorf("cluster name %s is not unique in the mesh", p.Name)
+		}
+		if ids[p.ID] {
+			return nil, fmt.Errorf("cluster ID %d of cluster %s is not unique in the mesh", p.ID, p.Name)
+		}
+		names[p.Name] = true
+		ids[p.ID] = true
+		c := pulumi.Map{
+			"name": pulumi.String(p.Name),
+			"port": pulumi.Int(p.Port),
+		}
+		if addr, err := netip.ParseAddr(p.Address); err == nil {
+			c["ips"] = pulumi.StringArray{
+				pulumi.String(addr.String()),
+			}
+		} else {
+			c["address"] = pulumi.String(p.Address)
+		}
+		clusters = append(clusters, c)
+	}
+
+	service := pulumi.Map{
+		// Expose clustermesh-apiserver to peer clusters
+		"type": pulumi.String("LoadBalancer"),
+	}
+	// Include the address in server certificate
+	serverCert := pulumi.Map{}
+	if addr, err := netip.ParseAddr(args.APIServerAddress); err == nil {
+		service["annotations"] = pulumi.Map{
+			// Request a stable IP from LB IPAM, see https://docs.cilium.io/en/stable/network/lb-ipam/#requesting-ips
+			"lbipam.cilium.io/ips": pulumi.String(addr.String()),
+		}
+		serverCert["extraIpAddresses"] = pulumi.StringArray{pulumi.String(addr.String())}
+	} else {
+		serverCert["extraDnsNames"] = pulumi.StringArray{pulumi.String(args.APIServerAddress)}
+	}
+
+	return pulumi.Map{
+		"tls": pulumi.Map{
+			// Use the CA shared by all clusters of the mesh
+			"ca": pulumi.Map{
+				"cert": pulumi.String(base64.StdEncoding.EncodeToString([]byte(caCert))),
+				"key":  pulumi.String(base64.StdEncoding.EncodeToString([]byte(caKey))),
+			},
+		},
+		"clustermesh": pulumi.Map{
+			// Use clustermesh-apiserver instead of exposing etcd directly
+			"useAPIServer": pulumi.Bool(true),
+			"apiserver": pulumi.Map{
+				"service": service,
+				"tls": pulumi.Map{
+					"auto": pulumi.Map{
+						// Generate certificates from the shared CA
+						"enabled": pulumi.Bool(true),
+						"method":  pulumi.String("helm"),
+					},
+					"server": serverCert,
+				},
+				"kvstoremesh": pulumi.Map{
+					// Cache peer clusters state locally, see https://docs.cilium.io/en/stable/network/clustermesh/kvstoremesh/
+					"enabled": pulumi.Bool(true),
+				},
+			},
+			"config": pulumi.Map{
+				// Register peer clusters
+				"enabled":  pulumi.Bool(true),
+				"clusters": clusters,
+			},
+		},
+	}, nil
+}
@@ -3,10 +3,12 @@ package cni
 import (
 	"fmt"
 
+	"dario.cat/mergo"
 	"github.com/kemadev/infrastructure-components/pkg/k8s/priorityclass"
 	"github.com/kemadev/infrastructure-components/pkg/k8s/pulumilabel"
 	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
 	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v3"
+	helmv4 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v4"
 	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
 	yamlv2 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml/v2"
 	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
@@ -18,28 +20,144 @@ const (
 	Namespace = "cilium"
 )
 
-// DeployCNI deploys the Cilium CNI using Helm, returning the corresponding Release object and an error if any.
+const (
+	cniName = "cilium"
+	cniRepo = "https://helm.cilium.io/"
+)
+
+// DeployCNI deploys the Cilium CNI using Helm, using the provided parameters merged with the default ones, applying
+// opts to all created resources, returning the corresponding Release object and an error if any.
 func DeployCNI(
 	ctx *pulumi.Context,
 	gwapiCrd *yamlv2.ConfigFile,
 	clusterName string,
+	args CNIArgs,
+	opts ...pulumi.ResourceOption,
 ) (*helm.Release, error) {
-	const cniName = "cilium"
-	// TODO add renovate tracking
-	const cniVersion = "1.17.4"
+	ns, values, err := prepareCNI(ctx, clusterName, &args, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := helm.NewRelease(ctx, cniName, &helm.ReleaseArgs{
+		Name:        pulumi.String(cniName),
+		Description: pulumi.String("Pretty much all the networking stuff"),
+		Namespace:   ns.Metadata.Name(),
+		Timeout:     pulumi.Int(600),
+		RepositoryOpts: &helm.RepositoryOptsArgs{
+			Repo: pulumi.String(cniRepo),
+		},
+		Chart:   pulumi.String(cniName),
+		Version: pulumi.String(args.Version),
+		Values:  values,
+	}, append([]pulumi.ResourceOption{pulumi.DependsOn([]pulumi.Resource{gwapiCrd})}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deploy cni: %w", err)
+	}
 
-	clusterNativeRoutingCIDR, err := RandomIPv6ULARoutingPrefix(ctx)
+	err = deployHostFirewallPolicies(
+		ctx,
+		args,
+		cniLabels(args),
+		append([]pulumi.ResourceOption{pulumi.DependsOn([]pulumi.Resource{release})}, opts...)...,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate random IPv6 ULA: %w", err)
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// RenderCNI renders the Cilium CNI Helm chart client-side, using the provided parameters merged with the default ones,
+// applying opts to all created resources, returning the corresponding Chart object and an error if any. As Helm releases
+// are managed by Helm itself and can't be rendered, it should be used instead of [DeployCNI] along with a provider
+// created by render.NewProvider.
+func RenderCNI(
+	ctx *pulumi.Context,
+	clusterName string,
+	args CNIArgs,
+	opts ...pulumi.ResourceOption,
+) (*helmv4.Chart, error) {
+	ns, values, err := prepareCNI(ctx, clusterName, &args, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	chart, err := helmv4.NewChart(ctx, cniName, &helmv4.ChartArgs{
+		Name:      pulumi.String(cniName),
+		Namespace: ns.Metadata.Name(),
+		RepositoryOpts: &helmv4.RepositoryOptsArgs{
+			Repo: pulumi.String(cniRepo),
+		},
+		Chart:   pulumi.String(cniName),
+		Version: pulumi.String(args.Version),
+		Values:  values,
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render cni: %w", err)
+	}
+
+	err = deployHostFirewallPolicies(
+		ctx,
+		args,
+		cniLabels(args),
+		append([]pulumi.ResourceOption{pulumi.DependsOn([]pulumi.Resource{chart})}, opts...)...,
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	sharedLabels := pulumilabel.DefaultLabels(
+	return chart, nil
+}
+
+// cniLabels returns the labels shared by all CNI resources.
+func cniLabels(args CNIArgs) pulumi.StringMap {
+	return pulumilabel.DefaultLabels(
 		pulumi.String(cniName),
 		pulumi.String(cniName),
-		pulumi.String(cniVersion),
+		pulumi.String(args.Version),
 		pulumi.String("cni"),
 		pulumi.String("network"),
 	)
+}
+
+// prepareCNI merges the CNI parameters with the default ones, creates the CNI namespace and computes Helm values,
+// returning the namespace, the values and an error if any.
+func prepareCNI(
+	ctx *pulumi.Context,
+	clusterName string,
+	args *CNIArgs,
+	opts ...pulumi.ResourceOption,
+) (*corev1.Namespace, pulumi.MapOutput, error) {
+	err := mergeArgs(args)
+	if err != nil {
+		return nil, pulumi.MapOutput{}, fmt.Errorf("failed to apply default cni parameters: %w", err)
+	}
+
+	var clusterNativeRoutingCIDR pulumi.StringInput = pulumi.String("")
+	if args.IPFamily.HasIPv6() && args.IPv6PodCIDR == "" {
+		clusterNativeRoutingCIDR, err = RandomIPv6ULARoutingPrefix(ctx, opts...)
+		if err != nil {
+			return nil, pulumi.MapOutput{}, fmt.Errorf("failed to generate random IPv6 ULA: %w", err)
+		}
+	}
+
+	var caCert, caKey pulumi.StringInput = pulumi.String(""), pulumi.String("")
+	peers := pulumi.Array{}.ToArrayOutput()
+	if args.ClusterMesh != nil {
+		err = validateClusterMeshArgs(clusterName, *args.ClusterMesh)
+		if err != nil {
+			return nil, pulumi.MapOutput{}, fmt.Errorf("error validating clustermesh parameters: %w", err)
+		}
+		caCert, caKey = args.ClusterMesh.CACert, args.ClusterMesh.CAKey
+		peers, err = clusterMeshPeers(ctx, args.ClusterMesh.PeerStacks, opts...)
+		if err != nil {
+			return nil, pulumi.MapOutput{}, err
+		}
+		exportClusterMesh(ctx, clusterName, *args.ClusterMesh)
+	}
+
+	sharedLabels := cniLabels(*args)
 
 	ns, err := corev1.NewNamespace(ctx, Namespace, &corev1.NamespaceArgs{
 		Metadata: &metav1.ObjectMetaArgs{
@@ -47,260 +165,405 @@ func DeployCNI(
 			Namespace: pulumi.String(Namespace),
 			Labels:    sharedLabels,
 		},
-	})
+	}, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create namespace %s: %w", cniName, err)
+		return nil, pulumi.MapOutput{}, fmt.Errorf("failed to create namespace %s: %w", cniName, err)
 	}
 
-	release, err := helm.NewRelease(ctx, cniName, &helm.ReleaseArgs{
-		Name:        pulumi.String(cniName),
-		Description: pulumi.String("Pretty much all the networking stuff"),
-		Namespace:   ns.Metadata.Name(),
-		Timeout:     pulumi.Int(600),
-		RepositoryOpts: &helm.RepositoryOptsArgs{
-			Repo: pulumi.String("https://helm.cilium.io/"),
+	if args.FlowExport != nil && flowCollectorEnabled(*args.FlowExport) {
+		err = deployFlowCollector(ctx, ns, *args.FlowExport, sharedLabels, opts...)
+		if err != nil {
+			return nil, pulumi.MapOutput{}, err
+		}
+	}
+
+	cniArgs := *args
+	values := pulumi.All(
+		clusterNativeRoutingCIDR,
+		peers,
+		caCert,
+		caKey,
+	).ApplyT(func(all []interface{}) (pulumi.Map, error) {
+		v := helmValues(cniArgs, clusterName, sharedLabels, all[0].(string))
+		if cniArgs.ClusterMesh != nil {
+			meshPeers := make([]ClusterMeshPeer, 0, len(all[1].([]interface{})))
+			for _, exported := range all[1].([]interface{}) {
+				p, err := parseClusterMeshPeer(exported)
+				if err != nil {
+					return nil, err
+				}
+				meshPeers = append(meshPeers, p)
+			}
+			mesh, err := clusterMeshValues(
+				clusterName,
+				*cniArgs.ClusterMesh,
+				meshPeers,
+				all[2].(string),
+				all[3].(string),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("error computing clustermesh values: %w", err)
+			}
+			err = mergo.Merge(&v, mesh, mergo.WithOverride)
+			if err != nil {
+				return nil, fmt.Errorf("error merging clustermesh values: %w", err)
+			}
+		}
+		if cniArgs.Values != nil {
+			err := mergo.Merge(&v, cniArgs.Values, mergo.WithOverride)
+			if err != nil {
+				return nil, fmt.Errorf("error merging cni values: %w", err)
+			}
+		}
+		return v, nil
+	}).(pulumi.MapOutput)
+
+	return ns, values, nil
+}
+
+// helmValues returns the Cilium Helm values matching the CNI parameters for the cluster, nativeRoutingSubnet being the random IPv6 routing
+// prefix, only used when IPv6 is enabled without IPv6PodCIDR.
+func helmValues(args CNIArgs, clusterName string, sharedLabels pulumi.StringMap, nativeRoutingSubnet string) pulumi.Map {
+	values := pulumi.Map{
+		"cluster": pulumi.Map{
+			// Set cluster name and ID, unique in the mesh, see https://docs.cilium.io/en/stable/network/clustermesh/clustermesh/
+			"name": pulumi.String(clusterName),
+			"id": func() pulumi.Int {
+				if args.ClusterMesh == nil {
+					return pulumi.Int(0)
+				}
+				return pulumi.Int(args.ClusterMesh.ClusterID)
+			}(),
 		},
-		Chart:   pulumi.String(cniName),
-		Version: pulumi.String(cniVersion),
-		Values: pulumi.All(
-			clusterNativeRoutingCIDR,
-		).ApplyT(func(cidr interface{}) pulumi.Map {
-			nativeRoutingSubnet := cidr.(string)
+		// Add labels to all resources
+		"commonLabels": sharedLabels,
+		"image": pulumi.Map{
+			// Don't pull if image already present
+			"pullPolicy": pulumi.String("IfNotPresent"),
+		},
+		// Replace kube-proxy
+		"kubeProxyReplacement": pulumi.Bool(true),
+		// Enable L7 Gateway API capabilities
+		"l7Proxy": pulumi.Bool(true),
+		"encryption": func() pulumi.Map {
+			if args.Encryption == EncryptionModeNone {
+				return pulumi.Map{
+					"enabled": pulumi.Bool(false),
+				}
+			}
 			return pulumi.Map{
-				// Add labels to all resources
-				"commonLabels": sharedLabels,
-				"image": pulumi.Map{
-					// Don't pull if image already present
-					"pullPolicy": pulumi.String("IfNotPresent"),
-				},
-				// Replace kube-proxy
-				"kubeProxyReplacement": pulumi.Bool(true),
-				// Enable L7 Gateway API capabilities
-				"l7Proxy": pulumi.Bool(true),
-				"encryption": pulumi.Map{
-					// Enable transparent pod-to-pod encryption
-					"enabled": pulumi.Bool(true),
-					// Use WireGuard as encryption method
-					"type": pulumi.String("wireguard"),
-					// Encrypt pure node-to-node traffic
-					"nodeEncryption": pulumi.Bool(true),
-					// TODO Force pod-to-pod encrpytion in all case, see https://docs.cilium.io/en/stable/security/network/encryption/#egress-traffic-to-not-yet-discovered-remote-endpoints-may-be-unencrypted (IPv6 not supported)
-					// "strictMode":     pulumi.String("enabled"),
-				},
-				"externalIPs": pulumi.Map{
-					// Enable ExternalIPs, see https://docs.cilium.io/en/stable/network/kubernetes/external-ips/
-					"enabled": pulumi.Bool(true),
-				},
-				"gatewayAPI": pulumi.Map{
-					// Enable cilium Gateway API
-					"enabled": pulumi.Bool(true),
-					"gatewayClass": pulumi.Map{
-						// Create Cilium's GatewayClass
-						"create": pulumi.String("true"),
-					},
-					// Enable ALPN
-					"enableAlpn": pulumi.Bool(true),
-					// Enable appProtocol, see https://kubernetes.io/docs/concepts/services-networking/service/#application-protocol
-					"enableAppProtocol": pulumi.Bool(true),
-				},
-				"hubble": pulumi.Map{
-					// Enable Hubble
-					"enabled": pulumi.Bool(true),
-					"relay": pulumi.Map{
-						// Enable Hubble relay
-						"enabled": pulumi.Bool(true),
-						// Rollout pods on ConfigMap change
-						"rollOutPods": pulumi.Bool(true),
-						// Set Hubble as moderate priority
-						"priorityClassName": pulumi.String(priorityclass.PriorityClassModerate),
-						"prometheus": pulumi.Map{
-							// Expose Hubble relay metrics
-							"enabled": pulumi.Bool(true),
-						},
-					},
-					"ui": pulumi.Map{
-						// Enable Hubble UI
-						"enabled": pulumi.Bool(true),
-						// Rollout pods on ConfigMap change
-						"rollOutPods": pulumi.Bool(true),
-						// Set Hubble as moderate priority
-						"priorityClassName": pulumi.String(priorityclass.PriorityClassModerate),
-						"livenessProbe": pulumi.Map{
-							// Enable Hubble UI liveness probe
-							"enabled": pulumi.Bool(true),
-						},
-						"readinessProbe": pulumi.Map{
-							// Enable Hubble UI readiness probe
-							"enabled": pulumi.Bool(true),
-						},
-					},
-					"metrics": pulumi.Map{
-						// Expose Hubble metrics
-						"enabled": pulumi.Array{
-							pulumi.String("tcp"),
-							pulumi.String("flow"),
-							pulumi.String("port-distribution"),
-							pulumi.String("icmp"),
-							pulumi.String("dns:labelsContext=source_namespace,destination_namespace"),
-							pulumi.String("drop:labelsContext=source_namespace,destination_namespace"),
-							pulumi.String(
-								"httpV2:exemplars=true;sourceContext=workload-name|pod-name|reserved-identity;destinationContext=workload-name|pod-name|reserved-identity;labelsContext=source_namespace,destination_namespace,traffic_direction",
-							),
-						},
-						// Also expose as OpenMetrics format
-						"enableOpenMetrics": pulumi.Bool(true),
-					},
+				// Enable transparent pod-to-pod encryption
+				"enabled": pulumi.Bool(true),
+				// Set encryption method
+				"type": pulumi.String(string(args.Encryption)),
+				// Encrypt pure node-to-node traffic, only supported with WireGuard
+				"nodeEncryption": pulumi.Bool(args.Encryption == EncryptionModeWireGuard),
+				"wireguard": pulumi.Map{
+					// Send keepalives if requested, see https://docs.cilium.io/en/stable/security/network/encryption-wireguard/
+					"persistentKeepalive": pulumi.String(args.WireGuardPersistentKeepalive.String()),
 				},
+				"ipsec": func() pulumi.Map {
+					if args.IPsecKeysSecret == "" {
+						return pulumi.Map{}
+					}
+					return pulumi.Map{
+						// Use keys secret, see https://docs.cilium.io/en/stable/security/network/encryption-ipsec/
+						"secretName": pulumi.String(args.IPsecKeysSecret),
+					}
+				}(),
+				// TODO Force pod-to-pod encrpytion in all case, see https://docs.cilium.io/en/stable/security/network/encryption/#egress-traffic-to-not-yet-discovered-remote-endpoints-may-be-unencrypted (IPv6 not supported)
+				// "strictMode":     pulumi.String("enabled"),
+			}
+		}(),
+		"externalIPs": pulumi.Map{
+			// Enable ExternalIPs, see https://docs.cilium.io/en/stable/network/kubernetes/external-ips/
+			"enabled": pulumi.Bool(true),
+		},
+		"gatewayAPI": pulumi.Map{
+			// Enable cilium Gateway API
+			"enabled": pulumi.Bool(true),
+			"gatewayClass": pulumi.Map{
+				// Create Cilium's GatewayClass
+				"create": pulumi.String("true"),
+			},
+			// Enable ALPN
+			"enableAlpn": pulumi.Bool(true),
+			// Enable appProtocol, see https://kubernetes.io/docs/concepts/services-networking/service/#application-protocol
+			"enableAppProtocol": pulumi.Bool(true),
+		},
+		"hubble": pulumi.Map{
+			// Enable Hubble
+			"enabled": pulumi.Bool(true),
+			"relay": pulumi.Map{
+				// Enable Hubble relay
+				"enabled": pulumi.Bool(true),
+				// Rollout pods on ConfigMap change
+				"rollOutPods": pulumi.Bool(true),
+				// Set Hubble as moderate priority
+				"priorityClassName": pulumi.String(priorityclass.PriorityClassModerate),
 				"prometheus": pulumi.Map{
-					// Expose cilium-envoy metrics
+					// Expose Hubble relay metrics
 					"enabled": pulumi.Bool(true),
 				},
-				"operator": pulumi.Map{
-					"prometheus": pulumi.Map{
-						// Expose cilium-operator metrics
-						"enabled": pulumi.Bool(true),
-					},
-					// Rollout pods on ConfigMap change
-					"rollOutPods": pulumi.Bool(true),
-				},
+			},
+			"ui": pulumi.Map{
+				// Enable Hubble UI
+				"enabled": pulumi.Bool(true),
 				// Rollout pods on ConfigMap change
-				"rollOutCiliumPods": pulumi.Bool(true),
-				"envoyConfig": pulumi.Map{
-					// Enable CiliumEnvoyConfig CRD
-					"enabled": pulumi.Bool(true),
-				},
-				"nodePort": pulumi.Map{
-					// Enable NoodePort, required for Gateway API Support
-					"enabled": pulumi.Bool(true),
-				},
-				"envoy": pulumi.Map{
-					// Rollout pods on ConfigMap change
-					"rollOutPods": pulumi.Bool(true),
-					"prometheus": pulumi.Map{
-						// Expose envoy metrics
-						"enabled": pulumi.Bool(true),
-					},
-					"log": pulumi.Map{
-						// Enable Envoy structured logging, see https://www.envoyproxy.io/docs/envoy/latest/operations/cli#cmdoption-log-format & https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/bootstrap/v3/bootstrap.proto#envoy-v3-api-field-config-bootstrap-v3-bootstrap-applicationlogconfig-logformat-json-format
-						// Inspired from OpenTelemetry format
-						"format_json": pulumi.Map{
-							"Timestamp":                       pulumi.String("%Y-%m-%dT%T.%e%z"),
-							"SeverityText":                    pulumi.String("%l"),
-							"Resource":                        pulumi.String("%n"),
-							"Body":                            pulumi.String("%j"),
-							string(semconv.CodeFilepathKey):   pulumi.String("%g"),
-							string(semconv.CodeLineNumberKey): pulumi.String("%#"),
-							string(semconv.CodeFunctionKey):   pulumi.String("%!"),
-							string(semconv.ThreadIDKey):       pulumi.String("%t"),
-						},
-						"format": nil,
-					},
-				},
-				"loadBalancer": pulumi.Map{
-					"l7": pulumi.Map{
-						// Use Envoy as L7 load balancer
-						"backend": pulumi.String("envoy"),
-					},
-					// Use native mode XDP acceleration on devices that support it, see https://docs.cilium.io/en/stable/operations/performance/tuning/#xdp-acceleration
-					"acceleration": pulumi.String("best-effort"),
-					// Use hybrid DSR / SNAT, see https://docs.cilium.io/en/stable/network/kubernetes/kubeproxy-free/#hybrid-dsr-and-snat-mode
-					"mode": pulumi.String("hybrid"),
-					// Use Maglev consistent hashing, see https://docs.cilium.io/en/stable/network/kubernetes/kubeproxy-free/#maglev-consistent-hashing
-					"algorithm": pulumi.String("maglev"),
-				},
-				// TODO enable mTLS
-				// "authentication": pulumi.Map{
-				// 	"mutual": pulumi.Map{
-				// 		"spire": pulumi.Map{
-				// 			// Enable SPIRE integration for mTLS, see https://docs.cilium.io/en/stable/security/network/encryption-wireguard/
-				// 			"enabled": pulumi.Bool(true),
-				// 			"install": pulumi.Map{
-				// 				"server": pulumi.Map{
-				// 					"ca": pulumi.Map{
-				// 						// Set CA key algorithm, see https://spiffe.io/docs/latest/deploying/spire_server/#server-configuration-file
-				// 						"keyType": pulumi.String("ec-p384"),
-				// 					},
-				// 				},
-				// 			},
-				// 		},
-				// 	},
-				// },
-				"l2announcements": pulumi.Map{
-					// Enable L2 announcements (see https://docs.cilium.io/en/stable/network/l2-announcements/), enabling LB IPAM, see https://docs.cilium.io/en/stable/network/lb-ipam/
+				"rollOutPods": pulumi.Bool(true),
+				// Set Hubble as moderate priority
+				"priorityClassName": pulumi.String(priorityclass.PriorityClassModerate),
+				"livenessProbe": pulumi.Map{
+					// Enable Hubble UI liveness probe
 					"enabled": pulumi.Bool(true),
 				},
-				"bpf": pulumi.Map{
-					// Enable masquerading, see https://docs.cilium.io/en/stable/network/concepts/masquerading/
-					// "masquerade": pulumi.Bool(true),
-					// Mode for Pod devices for the core datapath
-					"dataPathMode": pulumi.String("netkit"),
-					// Enables pre-allocation of eBPF map values
-					"preallocateMaps": pulumi.Bool(true),
-					// Enable eBPF-based TPROXY
-					"tproxy": pulumi.Bool(true),
-				},
-				"bandwidthManager": pulumi.Map{
-					// Enable Cilium’s bandwidth manager, see https://docs.cilium.io/en/stable/network/kubernetes/bandwidth-manager/
-					"enabled": pulumi.Bool(true),
-					// Enable BBR congestion control, see https://docs.cilium.io/en/stable/network/kubernetes/bandwidth-manager/#bbr-for-pods
-					"bbr": pulumi.Bool(true),
-				},
-				// Enable local redirect, see https://docs.cilium.io/en/stable/network/kubernetes/local-redirect-policy/
-				"localRedirectPolicy": pulumi.Bool(true),
-				// Enable synchronizing Kubernetes EndpointSlice
-				"ciliumEndpointSlice": pulumi.Map{
-					"enabled": pulumi.Bool(true),
-				},
-				"hostFirewall": pulumi.Map{
-					// Enable cilium host firewall
+				"readinessProbe": pulumi.Map{
+					// Enable Hubble UI readiness probe
 					"enabled": pulumi.Bool(true),
 				},
-				"maglev": pulumi.Map{
-					// Set Maglev table size, see https://docs.cilium.io/en/latest/network/kubernetes/kubeproxy-free/#maglev-consistent-hashing
-					"tableSize": pulumi.Int(16381),
+			},
+			"metrics": pulumi.Map{
+				// Expose Hubble metrics
+				"enabled": pulumi.Array{
+					pulumi.String("tcp"),
+					pulumi.String("flow"),
+					pulumi.String("port-distribution"),
+					pulumi.String("icmp"),
+					pulumi.String("dns:labelsContext=source_namespace,destination_namespace"),
+					pulumi.String("drop:labelsContext=source_namespace,destination_namespace"),
+					pulumi.String(
+						"httpV2:exemplars=true;sourceContext=workload-name|pod-name|reserved-identity;destinationContext=workload-name|pod-name|reserved-identity;labelsContext=source_namespace,destination_namespace,traffic_direction",
+					),
 				},
-				// Use packet forwarding instead of encapsulation, see https://docs.cilium.io/en/stable/network/concepts/routing/#native-routing
-				"routingMode": pulumi.String("native"),
-				// Load routes in Linux kernel, see https://docs.cilium.io/en/stable/network/concepts/routing/#native-routing
-				"autoDirectNodeRoutes": pulumi.Bool(true),
-				"ipv4": pulumi.Map{
-					// Disable IPv4
-					"enabled": pulumi.Bool(false),
-				},
-				// "ipv4NativeRoutingCIDR": pulumi.String(nativeIPv4CIDR.String()),
-				"ipv6": pulumi.Map{
-					// Enable IPv6
-					"enabled": pulumi.Bool(true),
-				},
-				"k8s": pulumi.Map{
-					// Wait for PodCIDR allocation
-					"requireIPv6PodCIDR": pulumi.Bool(true),
+				// Also expose as OpenMetrics format
+				"enableOpenMetrics": pulumi.Bool(true),
+			},
+		},
+		"prometheus": pulumi.Map{
+			// Expose cilium-envoy metrics
+			"enabled": pulumi.Bool(true),
+		},
+		"operator": pulumi.Map{
+			"prometheus": pulumi.Map{
+				// Expose cilium-operator metrics
+				"enabled": pulumi.Bool(true),
+			},
+			// Rollout pods on ConfigMap change
+			"rollOutPods": pulumi.Bool(true),
+		},
+		// Rollout pods on ConfigMap change
+		"rollOutCiliumPods": pulumi.Bool(true),
+		"envoyConfig": pulumi.Map{
+			// Enable CiliumEnvoyConfig CRD
+			"enabled": pulumi.Bool(true),
+		},
+		"nodePort": pulumi.Map{
+			// Enable NoodePort, required for Gateway API Support
+			"enabled": pulumi.Bool(true),
+		},
+		"envoy": pulumi.Map{
+			// Rollout pods on ConfigMap change
+			"rollOutPods": pulumi.Bool(true),
+			"prometheus": pulumi.Map{
+				// Expose envoy metrics
+				"enabled": pulumi.Bool(true),
+			},
+			"log": pulumi.Map{
+				// Enable Envoy structured logging, see https://www.envoyproxy.io/docs/envoy/latest/operations/cli#cmdoption-log-format & https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/bootstrap/v3/bootstrap.proto#envoy-v3-api-field-config-bootstrap-v3-bootstrap-applicationlogconfig-logformat-json-format
+				// Inspired from OpenTelemetry format
+				"format_json": pulumi.Map{
+					"Timestamp":                       pulumi.String("%Y-%m-%dT%T.%e%z"),
+					"SeverityText":                    pulumi.String("%l"),
+					"Resource":                        pulumi.String("%n"),
+					"Body":                            pulumi.String("%j"),
+					string(semconv.CodeFilepathKey):   pulumi.String("%g"),
+					string(semconv.CodeLineNumberKey): pulumi.String("%#"),
+					string(semconv.CodeFunctionKey):   pulumi.String("%!"),
+					string(semconv.ThreadIDKey):       pulumi.String("%t"),
 				},
-				// Set cluster network CIDR, see https://docs.cilium.io/en/stable/network/concepts/routing/#native-routing
-				"ipv6NativeRoutingCIDR": pulumi.String(nativeRoutingSubnet + "::/64"),
-				"ipam": pulumi.Map{
-					"operator": pulumi.Map{
-						// Use cilium managed native routing
-						"clusterPoolIPv6PodCIDRList": pulumi.StringArray{
-							pulumi.String(nativeRoutingSubnet + "::/104"),
+				"format": nil,
+			},
+		},
+		"loadBalancer": pulumi.Map{
+			"l7": pulumi.Map{
+				// Use Envoy as L7 load balancer
+				"backend": pulumi.String("envoy"),
+			},
+			// Set XDP acceleration mode, see https://docs.cilium.io/en/stable/operations/performance/tuning/#xdp-acceleration
+			"acceleration": pulumi.String(string(args.LBAcceleration)),
+			// Set load balancing mode, see https://docs.cilium.io/en/stable/network/kubernetes/kubeproxy-free/#hybrid-dsr-and-snat-mode
+			"mode": pulumi.String(string(args.LBMode)),
+			// Use Maglev consistent hashing, see https://docs.cilium.io/en/stable/network/kubernetes/kubeproxy-free/#maglev-consistent-hashing
+			"algorithm": pulumi.String("maglev"),
+		},
+		"authentication": pulumi.Map{
+			"mutual": pulumi.Map{
+				"spire": func() pulumi.Map {
+					if !args.MutualAuthentication {
+						return pulumi.Map{
+							"enabled": pulumi.Bool(false),
+						}
+					}
+					return pulumi.Map{
+						// Enable SPIRE integration for mutual authentication, see https://docs.cilium.io/en/stable/network/servicemesh/mutual-authentication/mutual-authentication/
+						"enabled": pulumi.Bool(true),
+						// Set SPIFFE trust domain
+						"trustDomain": pulumi.String(args.SPIRETrustDomain),
+						"install": pulumi.Map{
+							// Install SPIRE server and agents along with Cilium
+							"enabled": pulumi.Bool(true),
+							"server": pulumi.Map{
+								"ca": pulumi.Map{
+									// Set CA key algorithm, see https://spiffe.io/docs/latest/deploying/spire_server/#server-configuration-file
+									"keyType": pulumi.String(string(args.SPIRECAKeyType)),
+								},
+								// Set SPIRE server as high priority, as workloads can't authenticate without it
+								"priorityClassName": pulumi.String(priorityclass.PriorityClassHigh),
+							},
 						},
-					},
-				},
+					}
+				}(),
+			},
+		},
+		"l2announcements": pulumi.Map{
+			// Enable L2 announcements (see https://docs.cilium.io/en/stable/network/l2-announcements/), enabling LB IPAM, see https://docs.cilium.io/en/stable/network/lb-ipam/
+			"enabled": pulumi.Bool(args.LBAnnouncement == LBAnnouncementL2),
+		},
+		"bgpControlPlane": pulumi.Map{
+			// Enable BGP control plane (see https://docs.cilium.io/en/stable/network/bgp-control-plane/bgp-control-plane/), enabling LB IPAM as well
+			"enabled": pulumi.Bool(args.LBAnnouncement == LBAnnouncementBGP),
+			"secretsNamespace": func() pulumi.Map {
+				if args.BGPSecretsNamespace == "" {
+					return pulumi.Map{}
+				}
+				return pulumi.Map{
+					// Use existing namespace, see https://docs.cilium.io/en/stable/network/bgp-control-plane/bgp-control-plane-v2/#md5-password
+					"create": pulumi.Bool(false),
+					"name":   pulumi.String(args.BGPSecretsNamespace),
+				}
+			}(),
+		},
+		"bpf": pulumi.Map{
+			// Enable masquerading if requested, see https://docs.cilium.io/en/stable/network/concepts/masquerading/
+			"masquerade": pulumi.Bool(args.BPFMasquerade),
+			// Mode for Pod devices for the core datapath
+			"datapathMode": pulumi.String(string(args.DatapathMode)),
+			// Enables pre-allocation of eBPF map values
+			"preallocateMaps": pulumi.Bool(true),
+			// Enable eBPF-based TPROXY
+			"tproxy": pulumi.Bool(true),
+		},
+		"bandwidthManager": pulumi.Map{
+			// Enable Cilium’s bandwidth manager, see https://docs.cilium.io/en/stable/network/kubernetes/bandwidth-manager/
+			"enabled": pulumi.Bool(true),
+			// Enable BBR congestion control, see https://docs.cilium.io/en/stable/network/kubernetes/bandwidth-manager/#bbr-for-pods
+			"bbr": pulumi.Bool(true),
+		},
+		// Enable local redirect, see https://docs.cilium.io/en/stable/network/kubernetes/local-redirect-policy/
+		"localRedirectPolicy": pulumi.Bool(true),
+		// Enable synchronizing Kubernetes EndpointSlice
+		"ciliumEndpointSlice": pulumi.Map{
+			"enabled": pulumi.Bool(true),
+		},
+		"hostFirewall": pulumi.Map{
+			// Enable cilium host firewall
+			"enabled": pulumi.Bool(true),
+		},
+		"egressGateway": pulumi.Map{
+			// Enable egress gateway if requested, see https://docs.cilium.io/en/stable/network/egress-gateway/egress-gateway/
+			"enabled": pulumi.Bool(args.EgressGateway),
+		},
+		// Never audit all endpoints, which would stop enforcing all network policies, host firewall audit being handled by
+		// its policies
+		"policyAuditMode": pulumi.Bool(false),
+		"maglev": pulumi.Map{
+			// Set Maglev table size, see https://docs.cilium.io/en/latest/network/kubernetes/kubeproxy-free/#maglev-consistent-hashing
+			"tableSize": pulumi.Int(args.MaglevTableSize),
+		},
+		// Set routing mode, see https://docs.cilium.io/en/stable/network/concepts/routing/
+		"routingMode": pulumi.String(string(args.RoutingMode)),
+		"ipv4": pulumi.Map{
+			// Enable IPv4 if requested
+			"enabled": pulumi.Bool(args.IPFamily.HasIPv4()),
+		},
+		"ipv6": pulumi.Map{
+			// Enable IPv6 if requested
+			"enabled": pulumi.Bool(args.IPFamily.HasIPv6()),
+		},
+	}
+
+	if args.FlowExport != nil {
+		// Export flows, see https://docs.cilium.io/en/stable/observability/hubble/configuration/export/
+		values["hubble"].(pulumi.Map)["export"] = flowExportValues(*args.FlowExport)
+	}
+
+	if args.L2LeaseDuration != 0 {
+		// Set L2 announcement leases duration, see https://docs.cilium.io/en/stable/network/l2-announcements/#sizing-client-rate-limit
+		values["l2announcements"].(pulumi.Map)["leaseDuration"] = pulumi.String(args.L2LeaseDuration.String())
+	}
+
+	if args.RoutingMode == RoutingModeNative {
+		// Load routes in Linux kernel, see https://docs.cilium.io/en/stable/network/concepts/routing/#native-routing
+		values["autoDirectNodeRoutes"] = pulumi.Bool(true)
+	} else {
+		// Set encapsulation protocol, see https://docs.cilium.io/en/stable/network/concepts/routing/#encapsulation
+		values["tunnelProtocol"] = pulumi.String(string(args.TunnelProtocol))
+		if args.LBMode != LBModeSNAT {
+			// Dispatch DSR traffic through Geneve, the only protocol supporting it as validated, see https://docs.cilium.io/en/stable/network/kubernetes/kubeproxy-free/#hybrid-dsr-and-snat-mode
+			values["loadBalancer"].(pulumi.Map)["dsrDispatch"] = pulumi.String("geneve")
+		}
+	}
+
+	ipamOperator := pulumi.Map{}
+	if args.IPFamily.HasIPv4() {
+		// Set cluster network CIDR, see https://docs.cilium.io/en/stable/network/concepts/routing/#native-routing
+		values["ipv4NativeRoutingCIDR"] = pulumi.String(args.IPv4NativeRoutingCIDR)
+		// Use cilium managed pod CIDRs
+		ipamOperator["clusterPoolIPv4PodCIDRList"] = pulumi.StringArray{
+			pulumi.String(args.IPv4PodCIDR),
+		}
+		ipamOperator["clusterPoolIPv4MaskSize"] = pulumi.Int(args.IPv4PodCIDRMaskSize)
+	}
+	if args.IPFamily.HasIPv6() {
+		values["k8s"] = pulumi.Map{
+			// Wait for PodCIDR allocation
+			"requireIPv6PodCIDR": pulumi.Bool(true),
+		}
+		if args.IPv6PodCIDR != "" {
+			// Set cluster network CIDR, see https://docs.cilium.io/en/stable/network/concepts/routing/#native-routing
+			values["ipv6NativeRoutingCIDR"] = pulumi.String(args.IPv6NativeRoutingCIDR)
+			// Use cilium managed pod CIDRs
+			ipamOperator["clusterPoolIPv6PodCIDRList"] = pulumi.StringArray{
+				pulumi.String(args.IPv6PodCIDR),
 			}
-		}).(pulumi.MapOutput),
-	}, pulumi.DependsOn([]pulumi.Resource{gwapiCrd}))
-	if err != nil {
-		return nil, fmt.Errorf("failed to deploy cni: %w", err)
+			ipamOperator["clusterPoolIPv6MaskSize"] = pulumi.Int(args.IPv6PodCIDRMaskSize)
+		} else {
+			// Set cluster network CIDR, see https://docs.cilium.io/en/stable/network/concepts/routing/#native-routing
+			values["ipv6NativeRoutingCIDR"] = pulumi.String(nativeRoutingSubnet + "::/64")
+			// Use cilium managed native routing
+			ipamOperator["clusterPoolIPv6PodCIDRList"] = pulumi.StringArray{
+				pulumi.String(nativeRoutingSubnet + "::/104"),
+			}
+		}
+	}
+	values["ipam"] = pulumi.Map{
+		"operator": ipamOperator,
 	}
 
-	return release, nil
+	return values
 }
 
 // RandomIPv6ULARoutingPrefix generates a random IPv6 Unique Local Address (ULA) routing prefix, 64 bits masked.
-func RandomIPv6ULARoutingPrefix(ctx *pulumi.Context) (pulumi.StringInput, error) {
+//
+// Deprecated: random prefixes may collide across clusters, allocate pod CIDRs using the ipam package and
+// CNIArgs.Allocation instead.
+func RandomIPv6ULARoutingPrefix(
+	ctx *pulumi.Context,
+	opts ...pulumi.ResourceOption,
+) (pulumi.StringInput, error) {
 	ula, err := random.NewRandomId(ctx, "ipv6-ula", &random.RandomIdArgs{
 		ByteLength: pulumi.Int(7),
-	})
+	}, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate random IPv6 ULA: %w", err)
 	}
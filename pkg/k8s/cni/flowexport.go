@@ -0,0 +1,393 @@
+package cni
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/priorityclass"
+	appsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apps/v1"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// A FlowExportMode represents how Hubble exports flows, see https://docs.cilium.io/en/stable/observability/hubble/configuration/export/.
+type FlowExportMode string
+
+const (
+	// FlowExportModeStatic exports flows using a static configuration, changes requiring agents restart.
+	FlowExportModeStatic FlowExportMode = "static"
+	// FlowExportModeDynamic exports flows using a configuration reloaded by agents on change.
+	FlowExportModeDynamic FlowExportMode = "dynamic"
+)
+
+const (
+	// flowCollectorName is the name of the OpenTelemetry collector shipping flows.
+	flowCollectorName = "hubble-otel-collector"
+	// flowExportDir is the node directory Hubble exports flows to.
+	flowExportDir = "/var/run/cilium/hubble"
+	// podLogsDir is the node directory holding pods logs.
+	podLogsDir = "/var/log/pods"
+)
+
+// A FlowExportArgs contains all the parameters needed to export Hubble flows. As Envoy access logs are reported to
+// Hubble as L7 flows, they are exported along with other flows.
+type FlowExportArgs struct {
+	// Mode is how Hubble exports flows.
+	Mode FlowExportMode
+	// FileName is the name of the file flows are exported to, in Hubble run directory on each node.
+	FileName string
+	// FieldMask is the list of flow fields to export, all fields are exported if empty.
+	FieldMask []string
+	// IncludeFilters are the Hubble flow filters flows must match to be exported, see
+	// https://docs.cilium.io/en/stable/observability/hubble/configuration/export/#filters.
+	IncludeFilters pulumi.Array
+	// ExcludeFilters are the Hubble flow filters flows must not match to be exported.
+	ExcludeFilters pulumi.Array
+	// OTelEndpointUrl is the OpenTelemetry collector endpoint URL exported flows and Envoy logs are shipped to, e.g. the
+	// same as basichttpapp.AppParms.OTelEndpointUrl. Exported flows are only written to nodes if unset.
+	OTelEndpointUrl url.URL
+	// OtelExporterCompression is the OpenTelemetry exporter compression method.
+	OtelExporterCompression string
+	// CollectorVersion is the version of the OpenTelemetry collector image shipping logs.
+	CollectorVersion string
+	// AccessLog contains the parameters needed to log requests served by gateways. Requests are not logged if nil.
+	AccessLog *AccessLogArgs
+}
+
+// FlowExportDefaultArgs are the default flow export parameters.
+var FlowExportDefaultArgs = FlowExportArgs{
+	Mode:                    FlowExportModeDynamic,
+	FileName:                "events.log",
+	OtelExporterCompression: "gzip",
+	// TODO add renovate tracking
+	CollectorVersion: "0.128.0",
+}
+
+// validateFlowExportArgs validates the flow export parameters, returning an error if any of them is invalid.
+func validateFlowExportArgs(args FlowExportArgs) error {
+	if !slices.Contains([]FlowExportMode{FlowExportModeStatic, FlowExportModeDynamic}, args.Mode) {
+		return fmt.Errorf("Mode %q is invalid", args.Mode)
+	}
+	if args.FileName == "" {
+		return fmt.Errorf("FileName cannot be empty")
+	}
+	if args.Mode == FlowExportModeStatic && len(args.IncludeFilters) > 0 && len(args.ExcludeFilters) > 0 {
+		return fmt.Errorf("static mode supports either IncludeFilters or ExcludeFilters, not both")
+	}
+	if args.OTelEndpointUrl.String() != "" && args.OTelEndpointUrl.Host == "" {
+		return fmt.Errorf("OTelEndpointUrl %s has no host", args.OTelEndpointUrl.String())
+	}
+	if args.AccessLog != nil {
+		err := validateAccessLogArgs(*args.AccessLog, args)
+		if err != nil {
+			return fmt.Errorf("error validating access log parameters: %w", err)
+		}
+	}
+	return nil
+}
+
+// flowExportValues returns the Hubble Helm values exporting flows.
+func flowExportValues(args FlowExportArgs) pulumi.Map {
+	filePath := flowExportDir + "/" + args.FileName
+	fieldMask := pulumi.StringArray{}
+	for _, f := range args.FieldMask {
+		fieldMask = append(fieldMask, pulumi.String(f))
+	}
+	filters := func(f pulumi.Array) pulumi.Array {
+		if f == nil {
+			return pulumi.Array{}
+		}
+		return f
+	}
+
+	if args.Mode == FlowExportModeStatic {
+		return pulumi.Map{
+			"static": pulumi.Map{
+				"enabled":   pulumi.Bool(true),
+				"filePath":  pulumi.String(filePath),
+				"fieldMask": fieldMask,
+				"allowList": filters(args.IncludeFilters),
+				"denyList":  filters(args.ExcludeFilters),
+			},
+		}
+	}
+	content := pulumi.Array{
+		pulumi.Map{
+			"name":           pulumi.String("flows"),
+			"filePath":       pulumi.String(filePath),
+			"fieldMask":      fieldMask,
+			"includeFilters": filters(args.IncludeFilters),
+			"excludeFilters": filters(args.ExcludeFilters),
+		},
+	}
+	if args.AccessLog != nil {
+		content = append(content, accessLogExport(*args.AccessLog))
+	}
+	return pulumi.Map{
+		"dynamic": pulumi.Map{
+			"enabled": pulumi.Bool(true),
+			"config": pulumi.Map{
+				"content": content,
+			},
+		},
+	}
+}
+
+// flowCollectorEnabled returns whether the flow collector is needed, i.e. if flows are shipped to an endpoint or
+// access logs are enabled.
+func flowCollectorEnabled(args FlowExportArgs) bool {
+	return args.OTelEndpointUrl.String() != "" || args.AccessLog != nil
+}
+
+// flowCollectorConfig returns the OpenTelemetry collector configuration shipping exported flows and Envoy logs, along
+// with access logs, and an error if any. Kubernetes fields are mapped to semantic conventions attributes.
+func flowCollectorConfig(args FlowExportArgs) (string, error) {
+	exporter := map[string]any{
+		"endpoint":    args.OTelEndpointUrl.Host,
+		"compression": args.OtelExporterCompression,
+	}
+	exporterName := "otlp"
+	if args.OTelEndpointUrl.Scheme == "http" || args.OTelEndpointUrl.Scheme == "https" {
+		exporterName = "otlphttp"
+		exporter["endpoint"] = args.OTelEndpointUrl.String()
+	}
+
+	receivers := map[string]any{}
+	exporters := map[string]any{}
+	pipelines := map[string]any{}
+
+	if args.OTelEndpointUrl.String() != "" {
+		exporters[exporterName] = exporter
+		var redaction *AccessLogRedaction
+		if args.AccessLog != nil {
+			redaction = args.AccessLog.Redaction
+		}
+		// Flows include L7 flows of gateways and sidecar proxies, that are redacted as access logs are
+		flowOperators := []map[string]any{
+			{
+				"type":     "json_parser",
+				"parse_to": "body",
+				"timestamp": map[string]any{
+					"parse_from":  "body.time",
+					"layout_type": "gotime",
+					"layout":      "2006-01-02T15:04:05.999999999Z07:00",
+				},
+			},
+		}
+		flowOperators = append(flowOperators, redactionOperators(redaction)...)
+		flowOperators = append(flowOperators,
+			flowAttribute("body.flow.node_name", string(semconv.K8SNodeNameKey)),
+			flowAttribute("body.flow.source.namespace", string(semconv.K8SNamespaceNameKey)),
+			flowAttribute("body.flow.source.pod_name", string(semconv.K8SPodNameKey)),
+		)
+		receivers["filelog/flows"] = map[string]any{
+			"include":   []string{flowExportDir + "/" + args.FileName},
+			"start_at":  "end",
+			"operators": flowOperators,
+		}
+		envoyOperators := []map[string]any{
+			{"type": "container"},
+			// Envoy logs already use OpenTelemetry field names, see envoy.log.format_json values
+			{"type": "json_parser", "parse_from": "body", "parse_to": "body"},
+		}
+		if redaction != nil {
+			// Envoy logs cannot be attributed to applications, and dump requests at debug and trace levels, so drop them
+			envoyOperators = append(envoyOperators, map[string]any{
+				"type": "filter",
+				"expr": `body.SeverityText in ["debug", "trace"]`,
+			})
+		}
+		receivers["filelog/envoy"] = map[string]any{
+			"include":   []string{podLogsDir + "/" + Namespace + "_cilium-envoy-*/*/*.log"},
+			"start_at":  "end",
+			"operators": envoyOperators,
+		}
+		pipelines["logs"] = map[string]any{
+			"receivers":  []string{"filelog/flows", "filelog/envoy"},
+			"processors": []string{"resource", "batch"},
+			"exporters":  []string{exporterName},
+		}
+	}
+
+	if args.AccessLog != nil {
+		receivers[accessLogReceiver] = accessLogReceiverConfig(*args.AccessLog)
+		accessLogExporter := exporterName
+		if args.AccessLog.Sink == AccessLogSinkStdout {
+			accessLogExporter = "file/stdout"
+			exporters[accessLogExporter] = map[string]any{
+				"path": "/dev/stdout",
+			}
+		}
+		pipelines["logs/access"] = map[string]any{
+			"receivers":  []string{accessLogReceiver},
+			"processors": []string{"resource", "batch"},
+			"exporters":  []string{accessLogExporter},
+		}
+	}
+
+	config := map[string]any{
+		"receivers": receivers,
+		"processors": map[string]any{
+			"batch": map[string]any{},
+			"resource": map[string]any{
+				"attributes": []map[string]any{
+					{"key": string(semconv.ServiceNameKey), "value": cniName, "action": "upsert"},
+				},
+			},
+		},
+		"exporters": exporters,
+		"service": map[string]any{
+			"pipelines": pipelines,
+		},
+	}
+
+	// JSON being valid YAML, it can be used as collector configuration
+	b, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling collector configuration: %w", err)
+	}
+	return string(b), nil
+}
+
+// flowAttribute returns a collector operator copying the flow field to the attribute, if the field is set.
+func flowAttribute(field string, attribute string) map[string]any {
+	return map[string]any{
+		"type": "copy",
+		"from": field,
+		"to":   `attributes["` + attribute + `"]`,
+		"if":   field + " != nil",
+	}
+}
+
+// deployFlowCollector deploys an OpenTelemetry collector on each node, shipping exported flows and Envoy logs to the
+// configured endpoint, applying opts to all created resources, and returns an error if any.
+func deployFlowCollector(
+	ctx *pulumi.Context,
+	ns *corev1.Namespace,
+	args FlowExportArgs,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	config, err := flowCollectorConfig(args)
+	if err != nil {
+		return err
+	}
+
+	cm, err := corev1.NewConfigMap(ctx, flowCollectorName, &corev1.ConfigMapArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String(flowCollectorName),
+			Namespace: ns.Metadata.Name(),
+			Labels:    sharedLabels,
+		},
+		Data: pulumi.StringMap{
+			"config.yaml": pulumi.String(config),
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create flow collector configmap: %w", err)
+	}
+
+	selector := pulumi.StringMap{
+		"app.kubernetes.io/name": pulumi.String(flowCollectorName),
+	}
+	_, err = appsv1.NewDaemonSet(ctx, flowCollectorName, &appsv1.DaemonSetArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String(flowCollectorName),
+			Namespace: ns.Metadata.Name(),
+			Labels:    sharedLabels,
+		},
+		Spec: &appsv1.DaemonSetSpecArgs{
+			Selector: &metav1.LabelSelectorArgs{
+				MatchLabels: selector,
+			},
+			Template: &corev1.PodTemplateSpecArgs{
+				Metadata: &metav1.ObjectMetaArgs{
+					Labels: selector,
+					Annotations: pulumi.StringMap{
+						// Rollout pods on ConfigMap change
+						"checksum/config": pulumi.String(fmt.Sprintf("%x", sha256.Sum256([]byte(config)))),
+					},
+				},
+				Spec: &corev1.PodSpecArgs{
+					// Set collector as moderate priority, as Hubble
+					PriorityClassName: pulumi.String(priorityclass.PriorityClassModerate),
+					// Run on all nodes
+					Tolerations: corev1.TolerationArray{
+						corev1.TolerationArgs{
+							Operator: pulumi.String("Exists"),
+						},
+					},
+					Containers: corev1.ContainerArray{
+						&corev1.ContainerArgs{
+							Name:  pulumi.String("collector"),
+							Image: pulumi.String("otel/opentelemetry-collector-contrib:" + args.CollectorVersion),
+							Args: pulumi.StringArray{
+								pulumi.String("--config=/etc/otelcol/config.yaml"),
+							},
+							SecurityContext: corev1.SecurityContextArgs{
+								// Reading node files requires root
+								RunAsUser:                pulumi.Int(0),
+								ReadOnlyRootFilesystem:   pulumi.Bool(true),
+								AllowPrivilegeEscalation: pulumi.Bool(false),
+								Capabilities: corev1.CapabilitiesArgs{
+									Drop: pulumi.StringArray{
+										pulumi.String("ALL"),
+									},
+								},
+							},
+							VolumeMounts: corev1.VolumeMountArray{
+								corev1.VolumeMountArgs{
+									Name:      pulumi.String("config"),
+									MountPath: pulumi.String("/etc/otelcol"),
+									ReadOnly:  pulumi.Bool(true),
+								},
+								corev1.VolumeMountArgs{
+									Name:      pulumi.String("flows"),
+									MountPath: pulumi.String(flowExportDir),
+									ReadOnly:  pulumi.Bool(true),
+								},
+								corev1.VolumeMountArgs{
+									Name:      pulumi.String("pod-logs"),
+									MountPath: pulumi.String(podLogsDir),
+									ReadOnly:  pulumi.Bool(true),
+								},
+							},
+						},
+					},
+					Volumes: corev1.VolumeArray{
+						corev1.VolumeArgs{
+							Name: pulumi.String("config"),
+							ConfigMap: corev1.ConfigMapVolumeSourceArgs{
+								Name: cm.Metadata.Name(),
+							},
+						},
+						corev1.VolumeArgs{
+							Name: pulumi.String("flows"),
+							HostPath: corev1.HostPathVolumeSourceArgs{
+								Path: pulumi.String(flowExportDir),
+								Type: pulumi.String("DirectoryOrCreate"),
+							},
+						},
+						corev1.VolumeArgs{
+							Name: pulumi.String("pod-logs"),
+							HostPath: corev1.HostPathVolumeSourceArgs{
+								Path: pulumi.String(podLogsDir),
+								Type: pulumi.String("Directory"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to deploy flow collector: %w", err)
+	}
+
+	return nil
+}
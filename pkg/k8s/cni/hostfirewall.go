@@ -0,0 +1,256 @@
+package cni
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	yamlv2 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml/v2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// A HostFirewallMode represents how host firewall policies are applied, see https://docs.cilium.io/en/stable/security/host-firewall/.
+type HostFirewallMode string
+
+const (
+	// HostFirewallModeAudit deploys host firewall policies without default deny, so that traffic they do not allow
+	// still reaches nodes, and can be reviewed using Hubble policy verdicts before policies are enforced. Only host
+	// endpoints are affected, other network policies being enforced.
+	HostFirewallModeAudit HostFirewallMode = "audit"
+	// HostFirewallModeEnforce drops traffic to nodes that is not allowed by host firewall policies.
+	HostFirewallModeEnforce HostFirewallMode = "enforce"
+)
+
+const (
+	// hostFirewallPortKubeAPIServer is the kube-apiserver port.
+	hostFirewallPortKubeAPIServer = 6443
+	// hostFirewallPortEtcd is the etcd client port, the peer port being the next one.
+	hostFirewallPortEtcd = 2379
+	// hostFirewallPortKubelet is the kubelet API port.
+	hostFirewallPortKubelet = 10250
+	// hostFirewallPortWireGuard is the Cilium WireGuard port.
+	hostFirewallPortWireGuard = 51871
+	// hostFirewallPortHealth is the cilium-health port.
+	hostFirewallPortHealth = 4240
+	// hostFirewallPortHubble is the Hubble peer port.
+	hostFirewallPortHubble = 4244
+	// hostFirewallPortNodeExporter is the node-exporter metrics port.
+	hostFirewallPortNodeExporter = 9100
+	// hostFirewallPortVXLAN is the VXLAN port used by Cilium.
+	hostFirewallPortVXLAN = 8472
+	// hostFirewallPortGeneve is the Geneve port used by Cilium.
+	hostFirewallPortGeneve = 6081
+	// hostFirewallPortBGP is the BGP port.
+	hostFirewallPortBGP = 179
+	// hostFirewallPortIPsecNATT is the IPsec NAT traversal port, encapsulating ESP in UDP.
+	hostFirewallPortIPsecNATT = 4500
+	// hostFirewallPortSSH is the SSH port.
+	hostFirewallPortSSH = 22
+	// maxPort is the highest port number.
+	maxPort = 65535
+)
+
+// A HostFirewallIngress represents extra traffic allowed to reach all nodes, e.g. from monitoring or backup hosts.
+type HostFirewallIngress struct {
+	// CIDRs are the CIDRs traffic is allowed from.
+	CIDRs []string
+	// Protocol is the protocol of allowed traffic, either TCP, UDP or SCTP.
+	Protocol string
+	// Port is the destination port of allowed traffic.
+	Port int
+	// EndPort is the last destination port of allowed traffic, allowing the range starting at Port, if not zero.
+	EndPort int
+}
+
+// validateHostFirewallIngress validates the extra host firewall ingress, returning an error if it is invalid.
+func validateHostFirewallIngress(ingress HostFirewallIngress) error {
+	if len(ingress.CIDRs) == 0 {
+		return fmt.Errorf("CIDRs cannot be empty")
+	}
+	for _, c := range ingress.CIDRs {
+		_, err := netip.ParsePrefix(c)
+		if err != nil {
+			return fmt.Errorf("CIDR %q is invalid: %w", c, err)
+		}
+	}
+	if !slices.Contains([]string{"TCP", "UDP", "SCTP"}, ingress.Protocol) {
+		return fmt.Errorf("Protocol %q is invalid", ingress.Protocol)
+	}
+	if ingress.Port < 1 || ingress.Port > maxPort {
+		return fmt.Errorf("Port %d is invalid", ingress.Port)
+	}
+	if ingress.EndPort != 0 && (ingress.EndPort < ingress.Port || ingress.EndPort > maxPort) {
+		return fmt.Errorf("EndPort %d is invalid, must be between Port and %d", ingress.EndPort, maxPort)
+	}
+	return nil
+}
+
+// hostFirewallPorts returns the ports of an ingress rule allowing traffic to the port, up to endPort if not zero.
+func hostFirewallPorts(protocol string, port int, endPort int) pulumi.Array {
+	p := pulumi.Map{
+		"port":     pulumi.String(strconv.Itoa(port)),
+		"protocol": pulumi.String(protocol),
+	}
+	if endPort != 0 {
+		p["endPort"] = pulumi.Int(endPort)
+	}
+	return pulumi.Array{
+		pulumi.Map{
+			"ports": pulumi.Array{p},
+		},
+	}
+}
+
+// hostFirewallRule returns an ingress rule allowing traffic from entities to the port, up to endPort if not zero.
+func hostFirewallRule(entities []string, protocol string, port int, endPort int) pulumi.Map {
+	return pulumi.Map{
+		"fromEntities": pulumi.ToStringArray(entities),
+		"toPorts":      hostFirewallPorts(protocol, port, endPort),
+	}
+}
+
+// hostFirewallCIDRRule returns an ingress rule allowing traffic from cidrs to the port, up to endPort if not zero.
+func hostFirewallCIDRRule(cidrs []string, protocol string, port int, endPort int) pulumi.Map {
+	return pulumi.Map{
+		"fromCIDR": pulumi.ToStringArray(cidrs),
+		"toPorts":  hostFirewallPorts(protocol, port, endPort),
+	}
+}
+
+// hostFirewallPolicies returns the baseline host firewall policies, allowing only the traffic required by the cluster to
+// reach nodes.
+func hostFirewallPolicies(args CNIArgs, sharedLabels pulumi.StringMap) pulumi.Array {
+	// Only deny traffic that is not allowed once policies are enforced, see https://docs.cilium.io/en/stable/security/policy/language/#selective-policy-enforcement
+	defaultDeny := pulumi.Map{
+		"ingress": pulumi.Bool(args.HostFirewall == HostFirewallModeEnforce),
+		// Nodes egress traffic is not filtered
+		"egress": pulumi.Bool(false),
+	}
+	nodeRules := pulumi.Array{
+		// Allow kubelet API, e.g. logs and exec
+		hostFirewallRule([]string{"remote-node", "kube-apiserver"}, "TCP", hostFirewallPortKubelet, 0),
+		// Allow health checks, see https://docs.cilium.io/en/stable/operations/system_requirements/#firewall-rules
+		hostFirewallRule([]string{"remote-node", "health"}, "TCP", hostFirewallPortHealth, 0),
+		pulumi.Map{
+			"fromEntities": pulumi.StringArray{
+				pulumi.String("remote-node"),
+				pulumi.String("health"),
+			},
+			"icmps": pulumi.Array{
+				pulumi.Map{
+					"fields": pulumi.Array{
+						pulumi.Map{"type": pulumi.String("EchoRequest"), "family": pulumi.String("IPv4")},
+						pulumi.Map{"type": pulumi.String("EchoRequest"), "family": pulumi.String("IPv6")},
+					},
+				},
+			},
+		},
+		// Allow Hubble relay to reach Hubble peers
+		hostFirewallRule([]string{"cluster"}, "TCP", hostFirewallPortHubble, 0),
+		// Allow node-exporter metrics scraping
+		hostFirewallRule([]string{"cluster"}, "TCP", hostFirewallPortNodeExporter, 0),
+	}
+	if args.Encryption == EncryptionModeWireGuard {
+		// Allow WireGuard tunnels between nodes
+		nodeRules = append(
+			nodeRules,
+			hostFirewallRule([]string{"remote-node"}, "UDP", hostFirewallPortWireGuard, 0),
+		)
+	}
+	if args.Encryption == EncryptionModeIPsec {
+		// Allow IPsec between nodes, ESP being handed to decryption by the datapath before host policies apply, as
+		// policies cannot match it, while ESP encapsulated in UDP is matched
+		nodeRules = append(
+			nodeRules,
+			hostFirewallRule([]string{"remote-node"}, "UDP", hostFirewallPortIPsecNATT, 0),
+		)
+	}
+	if args.RoutingMode == RoutingModeTunnel {
+		// Allow encapsulated traffic between nodes
+		port := hostFirewallPortVXLAN
+		if args.TunnelProtocol == TunnelProtocolGeneve {
+			port = hostFirewallPortGeneve
+		}
+		nodeRules = append(nodeRules, hostFirewallRule([]string{"remote-node"}, "UDP", port, 0))
+	}
+	if args.LBAnnouncement == LBAnnouncementBGP {
+		// Allow BGP sessions from peer routers, outside of the cluster
+		nodeRules = append(nodeRules, hostFirewallRule([]string{"world"}, "TCP", hostFirewallPortBGP, 0))
+	}
+	if len(args.HostFirewallManagementCIDRs) > 0 {
+		// Allow SSH from management networks
+		nodeRules = append(
+			nodeRules,
+			hostFirewallCIDRRule(args.HostFirewallManagementCIDRs, "TCP", hostFirewallPortSSH, 0),
+		)
+	}
+	for _, i := range args.HostFirewallExtraIngress {
+		nodeRules = append(nodeRules, hostFirewallCIDRRule(i.CIDRs, i.Protocol, i.Port, i.EndPort))
+	}
+
+	return pulumi.Array{
+		pulumi.Map{
+			"apiVersion": pulumi.String("cilium.io/v2"),
+			"kind":       pulumi.String("CiliumClusterwideNetworkPolicy"),
+			"metadata": pulumi.Map{
+				"name":   pulumi.String("host-firewall-nodes"),
+				"labels": sharedLabels,
+			},
+			"spec": pulumi.Map{
+				// Select all nodes
+				"nodeSelector":      pulumi.Map{},
+				"enableDefaultDeny": defaultDeny,
+				"ingress":           nodeRules,
+			},
+		},
+		pulumi.Map{
+			"apiVersion": pulumi.String("cilium.io/v2"),
+			"kind":       pulumi.String("CiliumClusterwideNetworkPolicy"),
+			"metadata": pulumi.Map{
+				"name":   pulumi.String("host-firewall-control-plane"),
+				"labels": sharedLabels,
+			},
+			"spec": pulumi.Map{
+				"nodeSelector": pulumi.Map{
+					"matchExpressions": pulumi.Array{
+						pulumi.Map{
+							"key":      pulumi.String(label.NodeRoleControlPlaneLabelKey),
+							"operator": pulumi.String("Exists"),
+						},
+					},
+				},
+				"enableDefaultDeny": defaultDeny,
+				"ingress": pulumi.Array{
+					// Allow kube-apiserver clients, including the ones outside of the cluster
+					hostFirewallRule([]string{"all"}, "TCP", hostFirewallPortKubeAPIServer, 0),
+					// Allow etcd clients and peers
+					hostFirewallRule(
+						[]string{"host", "remote-node"},
+						"TCP",
+						hostFirewallPortEtcd,
+						hostFirewallPortEtcd+1,
+					),
+				},
+			},
+		},
+	}
+}
+
+// deployHostFirewallPolicies deploys the baseline host firewall policies, applying opts to all created resources, and
+// returns an error if any.
+func deployHostFirewallPolicies(
+	ctx *pulumi.Context,
+	args CNIArgs,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	_, err := yamlv2.NewConfigGroup(ctx, "host-firewall", &yamlv2.ConfigGroupArgs{
+		Objs: hostFirewallPolicies(args, sharedLabels),
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to deploy host firewall policies: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package cni
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// A hostFirewallPort represents a port allowed by host firewall rules.
+type hostFirewallPort struct {
+	protocol string
+	port     int
+}
+
+// allowedNodePorts returns the ports allowed to reach all nodes, along with the sources of their rules.
+func allowedNodePorts(t *testing.T, args CNIArgs) map[hostFirewallPort]pulumi.Map {
+	t.Helper()
+	policies := hostFirewallPolicies(args, pulumi.StringMap{})
+	rules := policies[0].(pulumi.Map)["spec"].(pulumi.Map)["ingress"].(pulumi.Array)
+	allowed := map[hostFirewallPort]pulumi.Map{}
+	for _, r := range rules {
+		rule := r.(pulumi.Map)
+		toPorts, ok := rule["toPorts"].(pulumi.Array)
+		if !ok {
+			continue
+		}
+		for _, p := range toPorts[0].(pulumi.Map)["ports"].(pulumi.Array) {
+			port, err := strconv.Atoi(string(p.(pulumi.Map)["port"].(pulumi.String)))
+			if err != nil {
+				t.Fatalf("rule port is not a number: %v", err)
+			}
+			allowed[hostFirewallPort{string(p.(pulumi.Map)["protocol"].(pulumi.String)), port}] = rule
+		}
+	}
+	return allowed
+}
+
+func TestHostFirewallPolicies(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(args *CNIArgs)
+		wantPorts  []hostFirewallPort
+		wantDenied []hostFirewallPort
+	}{
+		{
+			name:   "defaults",
+			modify: func(args *CNIArgs) {},
+			wantPorts: []hostFirewallPort{
+				{"TCP", hostFirewallPortKubelet},
+				{"UDP", hostFirewallPortWireGuard},
+			},
+			wantDenied: []hostFirewallPort{
+				{"UDP", hostFirewallPortIPsecNATT},
+				{"TCP", hostFirewallPortBGP},
+				{"UDP", hostFirewallPortVXLAN},
+				{"TCP", hostFirewallPortSSH},
+			},
+		},
+		{
+			name: "ipsec",
+			modify: func(args *CNIArgs) {
+				args.Encryption = EncryptionModeIPsec
+			},
+			wantPorts: []hostFirewallPort{
+				{"UDP", hostFirewallPortIPsecNATT},
+			},
+			wantDenied: []hostFirewallPort{
+				{"UDP", hostFirewallPortWireGuard},
+			},
+		},
+		{
+			name: "bgp",
+			modify: func(args *CNIArgs) {
+				args.LBAnnouncement = LBAnnouncementBGP
+			},
+			wantPorts: []hostFirewallPort{
+				{"TCP", hostFirewallPortBGP},
+			},
+		},
+		{
+			name: "vxlan tunnel",
+			modify: func(args *CNIArgs) {
+				args.RoutingMode = RoutingModeTunnel
+				args.TunnelProtocol = TunnelProtocolVXLAN
+			},
+			wantPorts: []hostFirewallPort{
+				{"UDP", hostFirewallPortVXLAN},
+			},
+			wantDenied: []hostFirewallPort{
+				{"UDP", hostFirewallPortGeneve},
+			},
+		},
+		{
+			name: "geneve tunnel with ipsec and bgp",
+			modify: func(args *CNIArgs) {
+				args.RoutingMode = RoutingModeTunnel
+				args.TunnelProtocol = TunnelProtocolGeneve
+				args.Encryption = EncryptionModeIPsec
+				args.LBAnnouncement = LBAnnouncementBGP
+			},
+			wantPorts: []hostFirewallPort{
+				{"UDP", hostFirewallPortGeneve},
+				{"UDP", hostFirewallPortIPsecNATT},
+				{"TCP", hostFirewallPortBGP},
+			},
+			wantDenied: []hostFirewallPort{
+				{"UDP", hostFirewallPortVXLAN},
+				{"UDP", hostFirewallPortWireGuard},
+			},
+		},
+		{
+			name: "management and extra ingress",
+			modify: func(args *CNIArgs) {
+				args.HostFirewallManagementCIDRs = []string{"192.0.2.0/24"}
+				args.HostFirewallExtraIngress = []HostFirewallIngress{
+					{CIDRs: []string{"198.51.100.0/24"}, Protocol: "UDP", Port: 161},
+				}
+			},
+			wantPorts: []hostFirewallPort{
+				{"TCP", hostFirewallPortSSH},
+				{"UDP", 161},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := CNIDefaultArgs
+			args.HostFirewall = HostFirewallModeEnforce
+			tt.modify(&args)
+			allowed := allowedNodePorts(t, args)
+			for _, p := range tt.wantPorts {
+				if _, ok := allowed[p]; !ok {
+					t.Errorf("%s port %d is not allowed", p.protocol, p.port)
+				}
+			}
+			for _, p := range tt.wantDenied {
+				if _, ok := allowed[p]; ok {
+					t.Errorf("%s port %d is allowed", p.protocol, p.port)
+				}
+			}
+		})
+	}
+}
+
+func TestHostFirewallManagementCIDRs(t *testing.T) {
+	args := CNIDefaultArgs
+	args.HostFirewallManagementCIDRs = []string{"192.0.2.0/24"}
+	rule := allowedNodePorts(t, args)[hostFirewallPort{"TCP", hostFirewallPortSSH}]
+	from, ok := rule["fromCIDR"].(pulumi.StringArray)
+	if !ok || !slices.Equal(from, pulumi.StringArray{pulumi.String("192.0.2.0/24")}) {
+		t.Errorf("SSH rule = %v, want from management CIDRs only", rule)
+	}
+}
+
+func TestValidateHostFirewallIngress(t *testing.T) {
+	tests := []struct {
+		name    string
+		ingress HostFirewallIngress
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			ingress: HostFirewallIngress{CIDRs: []string{"192.0.2.0/24"}, Protocol: "TCP", Port: 8000, EndPort: 8010},
+			wantErr: false,
+		},
+		{
+			name:    "no CIDRs",
+			ingress: HostFirewallIngress{Protocol: "TCP", Port: 8000},
+			wantErr: true,
+		},
+		{
+			name:    "invalid CIDR",
+			ingress: HostFirewallIngress{CIDRs: []string{"192.0.2.0"}, Protocol: "TCP", Port: 8000},
+			wantErr: true,
+		},
+		{
+			name:    "invalid protocol",
+			ingress: HostFirewallIngress{CIDRs: []string{"192.0.2.0/24"}, Protocol: "ESP", Port: 8000},
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			ingress: HostFirewallIngress{CIDRs: []string{"192.0.2.0/24"}, Protocol: "TCP", Port: 0},
+			wantErr: true,
+		},
+		{
+			name:    "end port before port",
+			ingress: HostFirewallIngress{CIDRs: []string{"192.0.2.0/24"}, Protocol: "TCP", Port: 8000, EndPort: 7000},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHostFirewallIngress(tt.ingress)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateHostFirewallIngress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
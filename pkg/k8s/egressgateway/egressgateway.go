@@ -0,0 +1,156 @@
+/*
+Package egressgateway provides egress gateways, giving pods stable outbound IPs.
+
+Pods opt in by carrying the [label.EgressGatewayLabelKey] label, set to the gateway name. Their
+outbound traffic is then routed through dedicated gateway nodes and masqueraded with the gateway
+egress IP, so that it can be allowlisted by third parties, see
+https://docs.cilium.io/en/stable/network/egress-gateway/egress-gateway/.
+*/
+package egressgateway
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/cni"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/pulumilabel"
+	yamlv2 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml/v2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// An EgressGateway represents a set of gateway nodes masquerading pods outbound traffic with a stable IP.
+type EgressGateway struct {
+	// Name is the name of the gateway, used by pods to opt in.
+	Name string
+	// EgressIP is the IP outbound traffic is masqueraded with. It must be assigned to an interface of gateway nodes.
+	EgressIP netip.Addr
+	// NodeRole is the value of the [label.NodeRoleNetworkIntensiveLabelKey] label selecting gateway nodes. Defaults
+	// to [label.NodeRoleComputeNetworkIntensiveGeneric].
+	NodeRole string
+	// DestinationCIDRs are the destinations routed through the gateway. Defaults to all IPv4 destinations.
+	DestinationCIDRs []netip.Prefix
+	// ExcludedCIDRs are the destinations not routed through the gateway, among DestinationCIDRs.
+	ExcludedCIDRs []netip.Prefix
+}
+
+// validateCNI validates that the CNI parameters enable the features egress gateways require, returning an error if not.
+func validateCNI(args cni.CNIArgs) error {
+	if !args.EgressGateway {
+		return fmt.Errorf("cni EgressGateway must be enabled")
+	}
+	if !args.BPFMasquerade {
+		return fmt.Errorf("cni BPFMasquerade must be enabled")
+	}
+	return nil
+}
+
+// validateGateway validates the gateway, returning an error if it is invalid.
+func validateGateway(gw EgressGateway) error {
+	if gw.Name == "" {
+		return fmt.Errorf("gateway name cannot be empty")
+	}
+	if !gw.EgressIP.Is4() {
+		return fmt.Errorf("gateway %s EgressIP must be an IPv4 address", gw.Name)
+	}
+	for _, p := range append(append([]netip.Prefix{}, gw.DestinationCIDRs...), gw.ExcludedCIDRs...) {
+		if !p.IsValid() || !p.Addr().Is4() {
+			return fmt.Errorf("gateway %s CIDR %s must be an IPv4 CIDR", gw.Name, p)
+		}
+	}
+	return nil
+}
+
+// prefixes returns the string representations of the prefixes.
+func prefixes(p []netip.Prefix) pulumi.StringArray {
+	s := make(pulumi.StringArray, len(p))
+	for i, prefix := range p {
+		s[i] = pulumi.String(prefix.Masked().String())
+	}
+	return s
+}
+
+// DeployEgressGateways deploys the egress gateway policies, applying opts to all created resources, and returns an
+// error if any. cniArgs are the parameters the CNI is deployed with, validated to support egress gateways.
+func DeployEgressGateways(
+	ctx *pulumi.Context,
+	cniArgs cni.CNIArgs,
+	gateways []EgressGateway,
+	opts ...pulumi.ResourceOption,
+) error {
+	err := validateCNI(cniArgs)
+	if err != nil {
+		return fmt.Errorf("error validating cni parameters for egress gateways: %w", err)
+	}
+
+	sharedLabels := pulumilabel.DefaultLabels(
+		pulumi.String("egress-gateway"),
+		pulumi.String("egress-gateway"),
+		pulumi.String("1"),
+		pulumi.String("gateway"),
+		pulumi.String("network"),
+	)
+
+	names := map[string]bool{}
+	for _, gw := range gateways {
+		err := validateGateway(gw)
+		if err != nil {
+			return fmt.Errorf("error validating egress gateway: %w", err)
+		}
+		if names[gw.Name] {
+			return fmt.Errorf("egress gateway %s is declared more than once", gw.Name)
+		}
+		names[gw.Name] = true
+
+		nodeRole := gw.NodeRole
+		if nodeRole == "" {
+			nodeRole = label.NodeRoleComputeNetworkIntensiveGeneric
+		}
+		destinations := gw.DestinationCIDRs
+		if len(destinations) == 0 {
+			destinations = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}
+		}
+
+		name := "egress-gateway-" + gw.Name
+		_, err = yamlv2.NewConfigGroup(ctx, name, &yamlv2.ConfigGroupArgs{
+			Objs: pulumi.Array{
+				pulumi.Map{
+					"apiVersion": pulumi.String("cilium.io/v2"),
+					"kind":       pulumi.String("CiliumEgressGatewayPolicy"),
+					"metadata": pulumi.Map{
+						"name":   pulumi.String(name),
+						"labels": sharedLabels,
+					},
+					"spec": pulumi.Map{
+						// Select opted in pods of all namespaces
+						"selectors": pulumi.Array{
+							pulumi.Map{
+								"podSelector": pulumi.Map{
+									"matchLabels": pulumi.StringMap{
+										label.EgressGatewayLabelKey: pulumi.String(gw.Name),
+									},
+								},
+							},
+						},
+						"destinationCIDRs": prefixes(destinations),
+						"excludedCIDRs":    prefixes(gw.ExcludedCIDRs),
+						"egressGateway": pulumi.Map{
+							// Use dedicated network intensive nodes as gateways
+							"nodeSelector": pulumi.Map{
+								"matchLabels": pulumi.StringMap{
+									label.NodeRoleNetworkIntensiveLabelKey: pulumi.String(nodeRole),
+								},
+							},
+							"egressIP": pulumi.String(gw.EgressIP.String()),
+						},
+					},
+				},
+			},
+		}, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to deploy egress gateway %s: %w", gw.Name, err)
+		}
+	}
+
+	return nil
+}
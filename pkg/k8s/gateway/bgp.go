@@ -0,0 +1,334 @@
+package gateway
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	yamlv2 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml/v2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// bgpPeerConfigName is the name of the BGP peer configuration shared by peers all tiers are advertised to.
+	bgpPeerConfigName = "bgp-peer-config"
+	// bgpAdvertisementNamePrefix is the name prefix of the BGP advertisements of tiers load balancer IPs.
+	bgpAdvertisementNamePrefix = "bgp-advertisement-"
+	// bgpAdvertisementLabelKey is the label key used by peer configurations to select advertisements.
+	bgpAdvertisementLabelKey = "advertise"
+	// bgpAdvertisementLabelValue is the label value used by peer configurations to select advertisements.
+	bgpAdvertisementLabelValue = "bgp"
+	// maxASN is the highest 4-byte autonomous system number.
+	maxASN = 4294967295
+)
+
+// A BGPPeer represents a BGP router nodes peer with, e.g. a top-of-rack router.
+type BGPPeer struct {
+	// Name is the name of the peer, e.g. tor-1.
+	Name string
+	// Address is the IP address of the peer.
+	Address netip.Addr
+	// ASN is the autonomous system number of the peer.
+	ASN int64
+	// Tiers are the tiers whose load balancer IPs are advertised to the peer, e.g. only private tiers for an internal
+	// router. All tiers are advertised if empty.
+	Tiers []Tier
+}
+
+// A BGPNodeGroup represents a group of nodes peering with the same routers, selected by a topology label, e.g. all the
+// nodes of a rack using [label.LabelTopologyDatacenterRackKey].
+type BGPNodeGroup struct {
+	// Name is the name of the group, e.g. the rack name.
+	Name string
+	// TopologyKey is the node label key selecting the nodes of the group. Defaults to
+	// [label.LabelTopologyDatacenterRackKey].
+	TopologyKey string
+	// TopologyValue is the node label value selecting the nodes of the group.
+	TopologyValue string
+	// LocalASN is the autonomous system number of the nodes of the group.
+	LocalASN int64
+	// Peers are the routers nodes of the group peer with.
+	Peers []BGPPeer
+}
+
+// A BGPArgs contains all the parameters needed to announce load balancer IPs over BGP, using Cilium BGP control plane,
+// see https://docs.cilium.io/en/stable/network/bgp-control-plane/bgp-control-plane-v2/. It requires cni.CNIArgs.LBAnnouncement
+// to be set to cni.LBAnnouncementBGP.
+type BGPArgs struct {
+	// NodeGroups are the groups of nodes peering with routers. Nodes that don't belong to any group don't announce IPs.
+	NodeGroups []BGPNodeGroup
+}
+
+// validateBGPArgs validates the BGP parameters against the deployed tiers, returning an error if any of them is invalid.
+func validateBGPArgs(args BGPArgs, tiers []TierArgs) error {
+	if len(args.NodeGroups) == 0 {
+		return fmt.Errorf("NodeGroups cannot be empty")
+	}
+	names := map[string]bool{}
+	for _, g := range args.NodeGroups {
+		if g.Name == "" {
+			return fmt.Errorf("node group name cannot be empty")
+		}
+		if names[g.Name] {
+			return fmt.Errorf("node group %s is declared more than once", g.Name)
+		}
+		names[g.Name] = true
+		if g.TopologyValue == "" {
+			return fmt.Errorf("node group %s TopologyValue cannot be empty", g.Name)
+		}
+		if g.LocalASN < 1 || g.LocalASN > maxASN {
+			return fmt.Errorf("node group %s LocalASN %d is invalid", g.Name, g.LocalASN)
+		}
+		if len(g.Peers) == 0 {
+			return fmt.Errorf("node group %s Peers cannot be empty", g.Name)
+		}
+		for _, p := range g.Peers {
+			if p.Name == "" {
+				return fmt.Errorf("node group %s peer name cannot be empty", g.Name)
+			}
+			if !p.Address.IsValid() {
+				return fmt.Errorf("node group %s peer %s address is invalid", g.Name, p.Name)
+			}
+			if p.ASN < 1 || p.ASN > maxASN {
+				return fmt.Errorf("node group %s peer %s ASN %d is invalid", g.Name, p.Name, p.ASN)
+			}
+			for _, t := range p.Tiers {
+				if !slices.ContainsFunc(tiers, func(a TierArgs) bool { return a.Tier == t }) {
+					return fmt.Errorf("node group %s peer %s tier %s is not deployed", g.Name, p.Name, t)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// bgpFamilies returns the address families of the BGP peer configuration advertising the tiers load balancer IPs, all
+// tiers and the services pool, if not nil, being advertised if advertised is empty.
+func bgpFamilies(tiers []TierArgs, advertised []Tier, services *ServicesPoolArgs) pulumi.Array {
+	afis := map[string][]string{}
+	for _, t := range tiers {
+		if len(advertised) > 0 && !slices.Contains(advertised, t.Tier) {
+			continue
+		}
+		afi := lbPoolAFI(t.LBPoolCIDR)
+		afis[afi] = append(afis[afi], string(t.Tier))
+	}
+	// Peers restricted to some tiers are not advertised other services IPs
+	if services != nil && len(advertised) == 0 {
+		afi := lbPoolAFI(services.LBPoolCIDR)
+		afis[afi] = append(afis[afi], servicesPoolName)
+	}
+	families := pulumi.Array{}
+	for _, afi := range slices.Sorted(maps.Keys(afis)) {
+		values := pulumi.ToStringArray(afis[afi])
+		families = append(families, pulumi.Map{
+			"afi":  pulumi.String(afi),
+			"safi": pulumi.String("unicast"),
+			"advertisements": pulumi.Map{
+				"matchLabels": pulumi.StringMap{
+					bgpAdvertisementLabelKey: pulumi.String(bgpAdvertisementLabelValue),
+				},
+				"matchExpressions": pulumi.Array{
+					pulumi.Map{
+						"key":      pulumi.String(label.GatewayTierLabelKey),
+						"operator": pulumi.String("In"),
+						"values":   values,
+					},
+				},
+			},
+		})
+	}
+	return families
+}
+
+// deployBGPPeerConfig deploys a BGP peer configuration advertising the tiers load balancer IPs, along with the services
+// pool ones if advertised is empty, applying opts to all created resources, and returns an error if any.
+func deployBGPPeerConfig(
+	ctx *pulumi.Context,
+	name string,
+	tiers []TierArgs,
+	advertised []Tier,
+	services *ServicesPoolArgs,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	_, err := yamlv2.NewConfigGroup(ctx, name, &yamlv2.ConfigGroupArgs{
+		Objs: pulumi.Array{
+			pulumi.Map{
+				"apiVersion": pulumi.String("cilium.io/v2alpha1"),
+				"kind":       pulumi.String("CiliumBGPPeerConfig"),
+				"metadata": pulumi.Map{
+					"name":   pulumi.String(name),
+					"labels": sharedLabels,
+				},
+				"spec": pulumi.Map{
+					// Keep routes while agents restart
+					"gracefulRestart": pulumi.Map{
+						"enabled":            pulumi.Bool(true),
+						"restartTimeSeconds": pulumi.Int(120),
+					},
+					"families": bgpFamilies(tiers, advertised, services),
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to deploy CiliumBGPPeerConfig %s: %w", name, err)
+	}
+	return nil
+}
+
+// deployBGPAdvertisement deploys the BGP advertisement of load balancer IPs of services matching selector, named and
+// labeled after advertised so that peer configurations can select it, applying opts to all created resources, and
+// returns an error if any.
+func deployBGPAdvertisement(
+	ctx *pulumi.Context,
+	advertised string,
+	selector pulumi.Map,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	name := bgpAdvertisementNamePrefix + advertised
+	_, err := yamlv2.NewConfigGroup(ctx, name, &yamlv2.ConfigGroupArgs{
+		Objs: pulumi.Array{
+			pulumi.Map{
+				"apiVersion": pulumi.String("cilium.io/v2alpha1"),
+				"kind":       pulumi.String("CiliumBGPAdvertisement"),
+				"metadata": pulumi.Map{
+					"name": pulumi.String(name),
+					"labels": func() pulumi.StringMap {
+						labels := pulumi.StringMap{
+							bgpAdvertisementLabelKey:  pulumi.String(bgpAdvertisementLabelValue),
+							label.GatewayTierLabelKey: pulumi.String(advertised),
+						}
+						maps.Copy(labels, sharedLabels)
+						return labels
+					}(),
+				},
+				"spec": pulumi.Map{
+					"advertisements": pulumi.Array{
+						pulumi.Map{
+							"advertisementType": pulumi.String("Service"),
+							"service": pulumi.Map{
+								"addresses": pulumi.StringArray{
+									pulumi.String("LoadBalancerIP"),
+								},
+							},
+							"selector": selector,
+						},
+					},
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to deploy CiliumBGPAdvertisement %s: %w", name, err)
+	}
+	return nil
+}
+
+// deployBGPResources deploys the Cilium BGP control plane resources announcing load balancer IPs of the tiers, and of
+// the services pool if not nil, applying opts to all created resources, and returns an error if any.
+func deployBGPResources(
+	ctx *pulumi.Context,
+	args BGPArgs,
+	tiers []TierArgs,
+	services *ServicesPoolArgs,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	err := validateBGPArgs(args, tiers)
+	if err != nil {
+		return fmt.Errorf("error validating bgp parameters: %w", err)
+	}
+
+	for _, t := range tiers {
+		err = deployBGPAdvertisement(
+			ctx,
+			string(t.Tier),
+			// Match the tier gateway service only
+			pulumi.Map{
+				"matchLabels": pulumi.StringMap{
+					label.GatewayTierLabelKey: pulumi.String(string(t.Tier)),
+				},
+			},
+			sharedLabels,
+			opts...,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if services != nil {
+		err = deployBGPAdvertisement(ctx, servicesPoolName, servicesSelector(), sharedLabels, opts...)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = deployBGPPeerConfig(ctx, bgpPeerConfigName, tiers, nil, services, sharedLabels, opts...)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range args.NodeGroups {
+		topologyKey := g.TopologyKey
+		if topologyKey == "" {
+			topologyKey = label.LabelTopologyDatacenterRackKey
+		}
+		name := "bgp-" + g.Name
+		peers := make(pulumi.Array, len(g.Peers))
+		for i, p := range g.Peers {
+			peerConfigName := bgpPeerConfigName
+			if len(p.Tiers) > 0 {
+				// Restrict advertised tiers using a dedicated peer configuration
+				peerConfigName = bgpPeerConfigName + "-" + g.Name + "-" + p.Name
+				err = deployBGPPeerConfig(ctx, peerConfigName, tiers, p.Tiers, services, sharedLabels, opts...)
+				if err != nil {
+					return err
+				}
+			}
+			peers[i] = pulumi.Map{
+				"name":        pulumi.String(p.Name),
+				"peerASN":     pulumi.Int(int(p.ASN)),
+				"peerAddress": pulumi.String(p.Address.String()),
+				"peerConfigRef": pulumi.Map{
+					"name": pulumi.String(peerConfigName),
+				},
+			}
+		}
+		_, err = yamlv2.NewConfigGroup(ctx, name, &yamlv2.ConfigGroupArgs{
+			Objs: pulumi.Array{
+				pulumi.Map{
+					"apiVersion": pulumi.String("cilium.io/v2alpha1"),
+					"kind":       pulumi.String("CiliumBGPClusterConfig"),
+					"metadata": pulumi.Map{
+						"name":   pulumi.String(name),
+						"labels": sharedLabels,
+					},
+					"spec": pulumi.Map{
+						"nodeSelector": pulumi.Map{
+							"matchLabels": pulumi.StringMap{
+								topologyKey: pulumi.String(g.TopologyValue),
+							},
+						},
+						"bgpInstances": pulumi.Array{
+							pulumi.Map{
+								"name":     pulumi.String(name),
+								"localASN": pulumi.Int(int(g.LocalASN)),
+								"peers":    peers,
+							},
+						},
+					},
+				},
+			},
+		}, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to deploy CiliumBGPClusterConfig %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
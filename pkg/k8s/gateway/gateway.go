@@ -13,21 +13,38 @@ import (
 )
 
 const (
-	// SharedGatewayName is the name of the shared gateway.
-	SharedGatewayName = "shared-gateway"
-	// SharedGatewayNamespace is the namespace where the shared gateway resources are deployed.
+	// SharedGatewayNamespace is the namespace where the gateways of all tiers and their resources are deployed.
 	SharedGatewayNamespace = "shared-gateway"
+
+	// SharedGatewayName is the name of the former single shared gateway. No gateway is deployed with this name anymore.
+	//
+	// Deprecated: use the gateway name of the tier instead, see [Tier.GatewayName].
+	SharedGatewayName = "shared-gateway"
 )
 
-// deployGatewayResources deploys the Gateway and LB-IPAM resources for all domains, creating setting
-// up TLS termination and wildcard certificates for each domain.
+// deployGatewayResources deploys the Gateway and LB-IPAM resources of each tier, creating setting
+// up TLS termination and wildcard certificates for each domain, along with apex and HTTPS redirect listeners for domains
+// requesting them. Each tier gets its own IP pool and announcement policy. Other load balancer services, e.g. the
+// clustermesh-apiserver, get IPs from the services pool if services is not nil. Load balancer IPs are announced using L2
+// announcements, or over BGP if bgp is not nil. opts are applied to all created resources.
 func DeployGatewayResources(
 	ctx *pulumi.Context,
-	certIssuerName string,
-	lbPoolCIDR net.IPNet,
-	gatewayIPs []net.IP,
-	domains []string,
+	tiers []TierArgs,
+	services *ServicesPoolArgs,
+	bgp *BGPArgs,
+	opts ...pulumi.ResourceOption,
 ) error {
+	tiers, err := validateTiers(tiers)
+	if err != nil {
+		return fmt.Errorf("error validating tiers: %w", err)
+	}
+	if services != nil {
+		err = validateServicesPool(*services, tiers)
+		if err != nil {
+			return fmt.Errorf("error validating services pool: %w", err)
+		}
+	}
+
 	sharedLabels := pulumilabel.DefaultLabels(
 		pulumi.String("shared-gateway"),
 		pulumi.String("shared-gateway"),
@@ -36,91 +53,188 @@ func DeployGatewayResources(
 		pulumi.String("network"),
 	)
 
-	_, err := corev1.NewNamespace(ctx, SharedGatewayNamespace, &corev1.NamespaceArgs{
+	_, err = corev1.NewNamespace(ctx, SharedGatewayNamespace, &corev1.NamespaceArgs{
 		Metadata: &metav1.ObjectMetaArgs{
 			Name:      pulumi.String(SharedGatewayNamespace),
 			Namespace: pulumi.String(SharedGatewayNamespace),
 			Labels:    sharedLabels,
 		},
-	})
+	}, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to create namespace %s: %w", SharedGatewayName, err)
+		return fmt.Errorf("failed to create namespace %s: %w", SharedGatewayNamespace, err)
+	}
+
+	for _, tier := range tiers {
+		err = deployTierGateway(ctx, tier, bgp == nil, sharedLabels, opts...)
+		if err != nil {
+			return fmt.Errorf("error deploying tier %s gateway: %w", tier.Tier, err)
+		}
+	}
+
+	if services != nil {
+		err = deployLBPool(
+			ctx,
+			servicesPoolName,
+			services.LBPoolCIDR,
+			// Leave tiers pools to their gateway
+			servicesSelector(),
+			bgp == nil,
+			services.L2Interfaces,
+			sharedLabels,
+			opts...,
+		)
+		if err != nil {
+			return fmt.Errorf("error deploying services pool: %w", err)
+		}
+	}
+
+	if bgp != nil {
+		err = deployBGPResources(ctx, *bgp, tiers, services, sharedLabels, opts...)
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = yamlv2.NewConfigGroup(ctx, "lb-pool-1", &yamlv2.ConfigGroupArgs{
+	return nil
+}
+
+// deployLBPool deploys the load balancer IP pool named after name, assigning IPs of cidr to services matching selector,
+// along with its L2 announcement policy if l2 is true, announcing IPs on interfaces matching l2Interfaces, applying opts
+// to all created resources, and returns an error if any.
+func deployLBPool(
+	ctx *pulumi.Context,
+	name string,
+	cidr net.IPNet,
+	selector pulumi.Map,
+	l2 bool,
+	l2Interfaces []string,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	poolName := "lb-pool-" + name
+	_, err := yamlv2.NewConfigGroup(ctx, poolName, &yamlv2.ConfigGroupArgs{
 		Objs: pulumi.Array{
 			pulumi.Map{
 				"apiVersion": pulumi.String("cilium.io/v2alpha1"),
 				"kind":       pulumi.String("CiliumLoadBalancerIPPool"),
 				"metadata": pulumi.Map{
-					"name":      pulumi.String("lb-pool-1"),
+					"name":      pulumi.String(poolName),
 					"namespace": pulumi.String(SharedGatewayNamespace),
 					"labels":    sharedLabels,
 				},
 				"spec": pulumi.Map{
 					"blocks": pulumi.Array{
 						pulumi.Map{
-							"cidr": pulumi.String(lbPoolCIDR.String()),
+							"cidr": pulumi.String(cidr.String()),
 						},
 					},
+					"serviceSelector": selector,
 				},
 			},
 		},
-	})
+	}, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to deploy CiliumLoadBalancerIPPool: %w", err)
 	}
 
-	_, err = yamlv2.NewConfigGroup(ctx, "announcement-policy-1", &yamlv2.ConfigGroupArgs{
-		Objs: pulumi.Array{
-			pulumi.Map{
-				"apiVersion": pulumi.String("cilium.io/v2alpha1"),
-				"kind":       pulumi.String("CiliumL2AnnouncementPolicy"),
-				"metadata": pulumi.Map{
-					"name":      pulumi.String("announcement-policy-1"),
-					"namespace": pulumi.String(SharedGatewayNamespace),
-					"labels":    sharedLabels,
-				},
-				"spec": pulumi.Map{
-					"externalIPs":     pulumi.Bool(true),
-					"loadBalancerIPs": pulumi.Bool(true),
-					"nodeSelector": pulumi.Map{
-						"matchExpressions": pulumi.Array{
-							pulumi.Map{
-								"key":      pulumi.String("node-role.kubernetes.io/control-plane"),
-								"operator": pulumi.String("DoesNotExist"),
+	if l2 {
+		policyName := "announcement-policy-" + name
+		_, err = yamlv2.NewConfigGroup(ctx, policyName, &yamlv2.ConfigGroupArgs{
+			Objs: pulumi.Array{
+				pulumi.Map{
+					"apiVersion": pulumi.String("cilium.io/v2alpha1"),
+					"kind":       pulumi.String("CiliumL2AnnouncementPolicy"),
+					"metadata": pulumi.Map{
+						"name":      pulumi.String(policyName),
+						"namespace": pulumi.String(SharedGatewayNamespace),
+						"labels":    sharedLabels,
+					},
+					"spec": pulumi.Map{
+						"externalIPs":     pulumi.Bool(true),
+						"loadBalancerIPs": pulumi.Bool(true),
+						"serviceSelector": selector,
+						"interfaces": func() pulumi.StringArrayInput {
+							if len(l2Interfaces) == 0 {
+								return nil
+							}
+							return pulumi.ToStringArray(l2Interfaces)
+						}(),
+						"nodeSelector": pulumi.Map{
+							"matchExpressions": pulumi.Array{
+								pulumi.Map{
+									"key":      pulumi.String("node-role.kubernetes.io/control-plane"),
+									"operator": pulumi.String("DoesNotExist"),
+								},
 							},
 						},
 					},
 				},
 			},
+		}, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to deploy CiliumL2AnnouncementPolicy: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deployTierGateway deploys the Gateway of the tier along with its IP pool, and its L2 announcement policy if l2 is
+// true, applying opts to all created resources, and returns an error if any.
+func deployTierGateway(
+	ctx *pulumi.Context,
+	tier TierArgs,
+	l2 bool,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	gatewayName := tier.Tier.GatewayName()
+	gatewayListeners, httpListeners := listeners(tier.Tier, tier.Domains)
+
+	err := deployLBPool(
+		ctx,
+		string(tier.Tier),
+		tier.LBPoolCIDR,
+		// Reserve the pool to the tier gateway service, see https://docs.cilium.io/en/stable/network/servicemesh/gateway-api/gateway-api/#gateway-infrastructure
+		pulumi.Map{
+			"matchLabels": pulumi.StringMap{
+				label.GatewayTierLabelKey: pulumi.String(string(tier.Tier)),
+			},
 		},
-	})
+		l2,
+		tier.L2Interfaces,
+		sharedLabels,
+		opts...,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to deploy CiliumL2AnnouncementPolicy: %w", err)
+		return err
 	}
 
-	_, err = yamlv2.NewConfigGroup(ctx, "Gateway", &yamlv2.ConfigGroupArgs{
+	issuerAnnotation := "cert-manager.io/issuer"
+	if tier.CertClusterIssuer {
+		issuerAnnotation = "cert-manager.io/cluster-issuer"
+	}
+	_, err = yamlv2.NewConfigGroup(ctx, gatewayName, &yamlv2.ConfigGroupArgs{
 		Objs: pulumi.Array{
 			pulumi.Map{
 				"apiVersion": pulumi.String("gateway.networking.k8s.io/v1"),
 				"kind":       pulumi.String("Gateway"),
 				"metadata": pulumi.Map{
-					"name":      pulumi.String(SharedGatewayName),
+					"name":      pulumi.String(gatewayName),
 					"namespace": pulumi.String(SharedGatewayNamespace),
 					"labels":    sharedLabels,
 					"annotations": pulumi.Map{
 						// Integrate with cert-manager
-						"cert-manager.io/issuer": pulumi.String(certIssuerName),
+						issuerAnnotation: pulumi.String(tier.CertIssuerName),
 					},
 				},
 				"spec": pulumi.Map{
 					"addresses": func() pulumi.ArrayInput {
-						if len(gatewayIPs) == 0 {
+						if len(tier.GatewayIPs) == 0 {
 							return nil
 						}
-						addrs := make(pulumi.Array, len(gatewayIPs))
-						for i, ip := range gatewayIPs {
+						addrs := make(pulumi.Array, len(tier.GatewayIPs))
+						for i, ip := range tier.GatewayIPs {
 							addrs[i] = pulumi.Map{
 								"type":  pulumi.String("IPAddress"),
 								"value": pulumi.String(ip.String()),
@@ -128,48 +242,33 @@ func DeployGatewayResources(
 						}
 						return addrs
 					}(),
+					// Propagate tier label to the gateway service
+					"infrastructure": pulumi.Map{
+						"labels": pulumi.StringMap{
+							label.GatewayTierLabelKey: pulumi.String(string(tier.Tier)),
+						},
+					},
 					"gatewayClassName": pulumi.String("cilium"),
-					"listeners": func() pulumi.ArrayInput {
-						var listeners pulumi.Array = make(pulumi.Array, 0, len(domains))
-						for _, domain := range domains {
-							l := pulumi.Map{
-								"name":     pulumi.String(domain + "-wildcard"),
-								"port":     pulumi.Int(443),
-								"protocol": pulumi.String("HTTPS"),
-								"hostname": pulumi.String("*." + domain),
-								"tls": pulumi.Map{
-									"mode": pulumi.String("Terminate"),
-									"certificateRefs": pulumi.Array{
-										pulumi.Map{
-											"kind": pulumi.String("Secret"),
-											"name": pulumi.String("wildcard-cert-" + domain),
-										},
-									},
-								},
-								"allowedRoutes": pulumi.Map{
-									"namespaces": pulumi.Map{
-										"from": pulumi.String("Selector"),
-										"selector": pulumi.Map{
-											"matchLabels": pulumi.Map{
-												label.SharedGatewayAccessLabelKey: pulumi.String(
-													label.SharedGatewayAccessLabelValue,
-												),
-											},
-										},
-									},
-								},
-							}
-							listeners = append(listeners, l)
-						}
-						return listeners
-					}(),
+					"listeners":        gatewayListeners,
 				},
 			},
 		},
-	})
+	}, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to deploy Gateway: %w", err)
 	}
 
+	err = deployHTTPSRedirect(
+		ctx,
+		gatewayName,
+		SharedGatewayNamespace,
+		httpListeners,
+		sharedLabels,
+		opts...,
+	)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
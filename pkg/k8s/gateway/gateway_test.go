@@ -0,0 +1,204 @@
+package gateway
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// mocks records the inputs of created resources, keyed by name.
+type mocks struct {
+	mu        sync.Mutex
+	resources map[string]resource.PropertyMap
+}
+
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources[args.Name] = args.Inputs
+	return args.Name + "-id", args.Inputs, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+// deploy runs DeployGatewayResources using mocks, returning the inputs of created resources, keyed by name, and the
+// deployment error if any.
+func deploy(
+	t *testing.T,
+	tiers []TierArgs,
+	services *ServicesPoolArgs,
+	bgp *BGPArgs,
+) (map[string]map[string]any, error) {
+	t.Helper()
+	m := &mocks{resources: map[string]resource.PropertyMap{}}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		return DeployGatewayResources(ctx, tiers, services, bgp)
+	}, pulumi.WithMocks("project", "stack", m))
+	resources := map[string]map[string]any{}
+	for name, inputs := range m.resources {
+		resources[name] = inputs.Mappable()
+	}
+	return resources, err
+}
+
+// object returns the single object of the config group, nil if it was not created.
+func object(resources map[string]map[string]any, name string) map[string]any {
+	group, ok := resources[name]
+	if !ok {
+		return nil
+	}
+	return group["objs"].([]any)[0].(map[string]any)
+}
+
+// path returns the value at the keys of nested maps, nil if any is missing.
+func path(v any, keys ...string) any {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// selectsNonGatewayServices returns true if the selector matches services without tier label only.
+func selectsNonGatewayServices(selector any) bool {
+	expressions, _ := path(selector, "matchExpressions").([]any)
+	return len(expressions) == 1 &&
+		path(expressions[0], "key") == label.GatewayTierLabelKey &&
+		path(expressions[0], "operator") == "DoesNotExist"
+}
+
+// families returns the advertised tier label values of the peer configuration, keyed by address family.
+func families(t *testing.T, resources map[string]map[string]any, name string) map[string][]any {
+	t.Helper()
+	config := object(resources, name)
+	if config == nil {
+		t.Fatalf("peer configuration %s was not created", name)
+	}
+	got := map[string][]any{}
+	for _, f := range path(config, "spec", "families").([]any) {
+		expressions := path(f, "advertisements", "matchExpressions").([]any)
+		got[path(f, "afi").(string)] = path(expressions[0], "values").([]any)
+	}
+	return got
+}
+
+func testTiers() []TierArgs {
+	_, pool, _ := net.ParseCIDR("192.0.2.0/28")
+	return []TierArgs{
+		{
+			Tier:           TierPublicApp,
+			CertIssuerName: "acme",
+			LBPoolCIDR:     *pool,
+		},
+	}
+}
+
+func testServicesPool() *ServicesPoolArgs {
+	_, pool, _ := net.ParseCIDR("192.0.2.16/28")
+	return &ServicesPoolArgs{LBPoolCIDR: *pool}
+}
+
+func TestServicesPoolL2(t *testing.T) {
+	resources, err := deploy(t, testTiers(), testServicesPool(), nil)
+	if err != nil {
+		t.Fatalf("DeployGatewayResources() error = %v", err)
+	}
+
+	pool := object(resources, "lb-pool-"+servicesPoolName)
+	if pool == nil {
+		t.Fatal("services pool was not created")
+	}
+	if !selectsNonGatewayServices(path(pool, "spec", "serviceSelector")) {
+		t.Errorf("services pool selector = %v, want services without tier label", path(pool, "spec", "serviceSelector"))
+	}
+	policy := object(resources, "announcement-policy-"+servicesPoolName)
+	if policy == nil {
+		t.Fatal("services announcement policy was not created")
+	}
+	if !selectsNonGatewayServices(path(policy, "spec", "serviceSelector")) {
+		t.Errorf(
+			"services announcement policy selector = %v, want services without tier label",
+			path(policy, "spec", "serviceSelector"),
+		)
+	}
+
+	tierPool := object(resources, "lb-pool-"+string(TierPublicApp))
+	if path(tierPool, "spec", "serviceSelector", "matchLabels", label.GatewayTierLabelKey) != string(TierPublicApp) {
+		t.Errorf("tier pool selector = %v, want tier gateway service", path(tierPool, "spec", "serviceSelector"))
+	}
+}
+
+func TestServicesPoolBGP(t *testing.T) {
+	bgp := &BGPArgs{
+		NodeGroups: []BGPNodeGroup{
+			{
+				Name:          "rack-1",
+				TopologyValue: "rack-1",
+				LocalASN:      65001,
+				Peers: []BGPPeer{
+					{Name: "tor-1", Address: netip.MustParseAddr("198.51.100.1"), ASN: 65000},
+					{
+						Name:    "internal",
+						Address: netip.MustParseAddr("198.51.100.2"),
+						ASN:     65000,
+						Tiers:   []Tier{TierPublicApp},
+					},
+				},
+			},
+		},
+	}
+	resources, err := deploy(t, testTiers(), testServicesPool(), bgp)
+	if err != nil {
+		t.Fatalf("DeployGatewayResources() error = %v", err)
+	}
+
+	if object(resources, "announcement-policy-"+servicesPoolName) != nil {
+		t.Error("services L2 announcement policy was created with BGP")
+	}
+	advertisement := object(resources, bgpAdvertisementNamePrefix+servicesPoolName)
+	if advertisement == nil {
+		t.Fatal("services BGP advertisement was not created")
+	}
+	if !selectsNonGatewayServices(path(advertisement, "spec", "advertisements").([]any)[0].(map[string]any)["selector"]) {
+		t.Errorf("services advertisement = %v, want services without tier label", advertisement)
+	}
+	if !slices.Contains(families(t, resources, bgpPeerConfigName)["ipv4"], any(servicesPoolName)) {
+		t.Errorf("default peer configuration does not advertise the services pool")
+	}
+	if slices.Contains(families(t, resources, bgpPeerConfigName+"-rack-1-internal")["ipv4"], any(servicesPoolName)) {
+		t.Errorf("peer configuration restricted to tiers advertises the services pool")
+	}
+}
+
+func TestServicesPoolValidation(t *testing.T) {
+	_, overlapping, _ := net.ParseCIDR("192.0.2.0/24")
+	tests := []struct {
+		name     string
+		services *ServicesPoolArgs
+		wantErr  bool
+	}{
+		{name: "no services pool", services: nil, wantErr: false},
+		{name: "distinct pool", services: testServicesPool(), wantErr: false},
+		{name: "overlapping tier pool", services: &ServicesPoolArgs{LBPoolCIDR: *overlapping}, wantErr: true},
+		{name: "invalid pool", services: &ServicesPoolArgs{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := deploy(t, testTiers(), tt.services, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeployGatewayResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
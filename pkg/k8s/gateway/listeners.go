@@ -0,0 +1,174 @@
+package gateway
+
+import (
+	"fmt"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	yamlv2 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml/v2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// httpsRedirectRouteName is the name of the HTTPRoute redirecting plain HTTP requests to HTTPS.
+	httpsRedirectRouteName = "https-redirect"
+)
+
+// A DomainArgs contains the parameters of a domain served by the gateway. Subdomains are always served over HTTPS, using
+// a `wildcard-cert-<domain>` certificate.
+type DomainArgs struct {
+	// Name is the domain name, e.g. kema.dev.
+	Name string
+	// HTTPRedirect is a boolean indicating if plain HTTP requests to the domain should be redirected to HTTPS.
+	HTTPRedirect bool
+	// Apex is a boolean indicating if the apex domain itself should be served, using an `apex-cert-<domain>` certificate.
+	Apex bool
+}
+
+// tierAllowedRoutes returns the allowedRoutes of listeners open to namespaces granted access to the tier gateway.
+func tierAllowedRoutes(tier Tier) pulumi.Map {
+	return pulumi.Map{
+		"namespaces": pulumi.Map{
+			"from": pulumi.String("Selector"),
+			"selector": pulumi.Map{
+				"matchLabels": pulumi.Map{
+					tier.AccessLabelKey(): pulumi.String(
+						label.GatewayAccessLabelValue,
+					),
+				},
+			},
+		},
+	}
+}
+
+// httpsListener returns an HTTPS listener of the tier gateway for the hostname, terminating TLS using the certificate
+// secret.
+func httpsListener(tier Tier, name string, hostname string, certName string) pulumi.Map {
+	return pulumi.Map{
+		"name":     pulumi.String(name),
+		"port":     pulumi.Int(443),
+		"protocol": pulumi.String("HTTPS"),
+		"hostname": pulumi.String(hostname),
+		"tls": pulumi.Map{
+			"mode": pulumi.String("Terminate"),
+			"certificateRefs": pulumi.Array{
+				pulumi.Map{
+					"kind": pulumi.String("Secret"),
+					"name": pulumi.String(certName),
+				},
+			},
+		},
+		"allowedRoutes": tierAllowedRoutes(tier),
+	}
+}
+
+// httpListener returns a plain HTTP listener for the hostname, only accepting routes from the gateway namespace, i.e. the
+// HTTPS redirect route.
+func httpListener(name string, hostname string) pulumi.Map {
+	return pulumi.Map{
+		"name":     pulumi.String(name),
+		"port":     pulumi.Int(80),
+		"protocol": pulumi.String("HTTP"),
+		"hostname": pulumi.String(hostname),
+		"allowedRoutes": pulumi.Map{
+			"namespaces": pulumi.Map{
+				"from": pulumi.String("Same"),
+			},
+		},
+	}
+}
+
+// validateDomains validates the domains, returning an error if any of them is invalid.
+func validateDomains(domains []DomainArgs) error {
+	if len(domains) == 0 {
+		return fmt.Errorf("domains cannot be empty")
+	}
+	names := map[string]bool{}
+	for _, d := range domains {
+		if d.Name == "" {
+			return fmt.Errorf("domain name cannot be empty")
+		}
+		if names[d.Name] {
+			return fmt.Errorf("domain %s is declared more than once", d.Name)
+		}
+		names[d.Name] = true
+	}
+	return nil
+}
+
+// listeners returns the tier gateway listeners serving the domains, and the names of plain HTTP listeners.
+func listeners(tier Tier, domains []DomainArgs) (pulumi.Array, []string) {
+	l := make(pulumi.Array, 0, len(domains))
+	var httpListeners []string
+	for _, d := range domains {
+		l = append(l, httpsListener(tier, d.Name+"-wildcard", "*."+d.Name, "wildcard-cert-"+d.Name))
+		if d.Apex {
+			l = append(l, httpsListener(tier, d.Name+"-apex", d.Name, "apex-cert-"+d.Name))
+		}
+		if d.HTTPRedirect {
+			l = append(l, httpListener(d.Name+"-http-wildcard", "*."+d.Name))
+			httpListeners = append(httpListeners, d.Name+"-http-wildcard")
+			if d.Apex {
+				l = append(l, httpListener(d.Name+"-http-apex", d.Name))
+				httpListeners = append(httpListeners, d.Name+"-http-apex")
+			}
+		}
+	}
+	return l, httpListeners
+}
+
+// deployHTTPSRedirect deploys the HTTPRoute permanently redirecting requests of plain HTTP listeners to HTTPS, applying
+// opts to all created resources, and returns an error if any.
+func deployHTTPSRedirect(
+	ctx *pulumi.Context,
+	gatewayName string,
+	gatewayNamespace string,
+	httpListeners []string,
+	sharedLabels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) error {
+	if len(httpListeners) == 0 {
+		return nil
+	}
+	parentRefs := make(pulumi.Array, len(httpListeners))
+	for i, l := range httpListeners {
+		parentRefs[i] = pulumi.Map{
+			"name":        pulumi.String(gatewayName),
+			"namespace":   pulumi.String(gatewayNamespace),
+			"sectionName": pulumi.String(l),
+		}
+	}
+	name := gatewayName + "-" + httpsRedirectRouteName
+	_, err := yamlv2.NewConfigGroup(ctx, name, &yamlv2.ConfigGroupArgs{
+		Objs: pulumi.Array{
+			pulumi.Map{
+				"apiVersion": pulumi.String("gateway.networking.k8s.io/v1"),
+				"kind":       pulumi.String("HTTPRoute"),
+				"metadata": pulumi.Map{
+					"name":      pulumi.String(name),
+					"namespace": pulumi.String(gatewayNamespace),
+					"labels":    sharedLabels,
+				},
+				"spec": pulumi.Map{
+					"parentRefs": parentRefs,
+					"rules": pulumi.Array{
+						pulumi.Map{
+							"filters": pulumi.Array{
+								pulumi.Map{
+									"type": pulumi.String("RequestRedirect"),
+									"requestRedirect": pulumi.Map{
+										"scheme":     pulumi.String("https"),
+										"statusCode": pulumi.Int(301),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to deploy HTTPS redirect route of %s: %w", gatewayName, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// servicesPoolName is the name suffix of the load balancer resources of services other than tier gateways, and the
+// tier label value of their BGP advertisement.
+const servicesPoolName = "services"
+
+// A ServicesPoolArgs contains all the parameters needed to assign and announce load balancer IPs of services other than
+// tier gateways, e.g. the clustermesh-apiserver of cni.ClusterMeshArgs, requesting its IP from this pool.
+type ServicesPoolArgs struct {
+	// LBPoolCIDR is the CIDR of the load balancer IP pool of services other than tier gateways. It cannot overlap tiers
+	// pools.
+	LBPoolCIDR net.IPNet
+	// L2Interfaces are regular expressions matching the node interfaces the services IPs are announced on when using L2
+	// announcements. IPs are announced on all interfaces if empty.
+	L2Interfaces []string
+}
+
+// validateServicesPool validates the services pool parameters against the tiers, returning an error if any of them is
+// invalid.
+func validateServicesPool(args ServicesPoolArgs, tiers []TierArgs) error {
+	pool, err := ipNetPrefix(args.LBPoolCIDR)
+	if err != nil {
+		return fmt.Errorf("LBPoolCIDR is invalid: %w", err)
+	}
+	for _, t := range tiers {
+		tierPool, err := ipNetPrefix(t.LBPoolCIDR)
+		if err != nil {
+			return fmt.Errorf("tier %s LBPoolCIDR is invalid: %w", t.Tier, err)
+		}
+		if pool.Overlaps(tierPool) {
+			return fmt.Errorf("LBPoolCIDR %s overlaps tier %s one %s", pool, t.Tier, tierPool)
+		}
+	}
+	return nil
+}
+
+// servicesSelector returns the service selector matching all load balancer services but tier gateways.
+func servicesSelector() pulumi.Map {
+	return pulumi.Map{
+		"matchExpressions": pulumi.Array{
+			pulumi.Map{
+				"key":      pulumi.String(label.GatewayTierLabelKey),
+				"operator": pulumi.String("DoesNotExist"),
+			},
+		},
+	}
+}
+
+// lbPoolAFI returns the BGP address family of the load balancer IP pool.
+func lbPoolAFI(pool net.IPNet) string {
+	if addr, ok := netip.AddrFromSlice(pool.IP); ok && addr.Unmap().Is4() {
+		return "ipv4"
+	}
+	return "ipv6"
+}
@@ -0,0 +1,192 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	"github.com/kemadev/infrastructure-components/pkg/private/host"
+)
+
+// A Tier represents an exposure tier, matching the base hosts of package host. Each tier is served by its own Gateway,
+// reachable from its own load balancer IP pool, so that private services are never exposed on public IPs.
+type Tier string
+
+const (
+	// TierPublicApp is the tier of internet-facing public applications, see [host.BaseHostPublicInternetFacingApp].
+	TierPublicApp Tier = "public-app"
+	// TierPublicService is the tier of internet-facing public services, see [host.BaseHostPublicInternetFacingService].
+	TierPublicService Tier = "public-service"
+	// TierInternalService is the tier of internet-facing internal services, see
+	// [host.BaseHostInternalInternetFacingService].
+	TierInternalService Tier = "internal-service"
+	// TierPrivate is the tier of private internal services, see [host.BaseHostInternalPrivateService].
+	TierPrivate Tier = "private"
+)
+
+// Tiers are all the exposure tiers.
+var Tiers = []Tier{
+	TierPublicApp,
+	TierPublicService,
+	TierInternalService,
+	TierPrivate,
+}
+
+// BaseHost returns the base host of the tier, i.e. the domain it serves by default.
+func (t Tier) BaseHost() string {
+	switch t {
+	case TierPublicApp:
+		return host.BaseHostPublicInternetFacingApp.Host
+	case TierPublicService:
+		return host.BaseHostPublicInternetFacingService.Host
+	case TierInternalService:
+		return host.BaseHostInternalInternetFacingService.Host
+	case TierPrivate:
+		return host.BaseHostInternalPrivateService.Host
+	}
+	return ""
+}
+
+// GatewayName returns the name of the Gateway serving the tier.
+func (t Tier) GatewayName() string {
+	return "gateway-" + string(t)
+}
+
+// AccessLabelKey returns the namespace label key granting routes of the namespace access to the tier Gateway, to be set
+// to [label.GatewayAccessLabelValue].
+func (t Tier) AccessLabelKey() string {
+	return label.GatewayAccessLabelKeyPrefix + string(t)
+}
+
+// TierForHost returns the tier serving the hostname among tiers, based on the domains they serve as listeners do, the
+// most specific domain winning, and an error if no tier serves it. Tiers without domains serve their base host, as
+// when deployed.
+func TierForHost(hostname string, tiers []TierArgs) (Tier, error) {
+	h := strings.ToLower(strings.TrimSuffix(hostname, "."))
+	var match Tier
+	matchLength := 0
+	for _, t := range tiers {
+		domains := t.Domains
+		if len(domains) == 0 {
+			domains = []DomainArgs{{Name: t.Tier.BaseHost()}}
+		}
+		for _, d := range domains {
+			name := strings.ToLower(d.Name)
+			if name == "" || len(name) <= matchLength {
+				continue
+			}
+			// Wildcard listeners match all subdomains, apex listeners the domain itself
+			if strings.HasSuffix(h, "."+name) || (d.Apex && h == name) {
+				match = t.Tier
+				matchLength = len(name)
+			}
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("no gateway tier serves host %s", hostname)
+	}
+	return match, nil
+}
+
+// BaseHostTiers returns all the tiers serving their base host, i.e. deployed with default domains. Only Tier is set,
+// e.g. to resolve the tier of hosts using [TierForHost].
+func BaseHostTiers() []TierArgs {
+	tiers := make([]TierArgs, len(Tiers))
+	for i, t := range Tiers {
+		tiers[i] = TierArgs{Tier: t}
+	}
+	return tiers
+}
+
+// A TierArgs contains all the parameters needed to deploy the Gateway of a tier.
+type TierArgs struct {
+	// Tier is the exposure tier.
+	Tier Tier
+	// CertIssuerName is the name of the cert-manager issuer used by the gateway.
+	CertIssuerName string
+	// CertClusterIssuer is a boolean indicating if CertIssuerName refers to a ClusterIssuer, e.g. the private CA issuer
+	// of internal domains.
+	CertClusterIssuer bool
+	// LBPoolCIDR is the CIDR of the load balancer IP pool dedicated to the tier.
+	LBPoolCIDR net.IPNet
+	// GatewayIPs are the IPs the gateway should be reachable on, among LBPoolCIDR.
+	GatewayIPs []net.IP
+	// Domains are the domains served by the gateway. Defaults to the tier base host, redirecting HTTP to HTTPS.
+	Domains []DomainArgs
+	// L2Interfaces are regular expressions matching the node interfaces the tier IPs are announced on when using L2
+	// announcements, e.g. the interface of a public VLAN. IPs are announced on all interfaces if empty.
+	L2Interfaces []string
+}
+
+// ipNetPrefix returns the IPNet as a prefix.
+func ipNetPrefix(n net.IPNet) (netip.Prefix, error) {
+	addr, ok := netip.AddrFromSlice(n.IP)
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR %s", n.String())
+	}
+	ones, _ := n.Mask.Size()
+	return netip.PrefixFrom(addr.Unmap(), ones).Masked(), nil
+}
+
+// validateTiers validates the tiers, returning a copy of them with their default values filled, and an error if any of
+// them is invalid.
+func validateTiers(args []TierArgs) ([]TierArgs, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("tiers cannot be empty")
+	}
+	// Copy tiers before filling them, not to modify the caller ones
+	tiers := slices.Clone(args)
+	seen := map[Tier]bool{}
+	domains := map[string]Tier{}
+	pools := map[Tier]netip.Prefix{}
+	for i := range tiers {
+		t := &tiers[i]
+		if t.Tier.BaseHost() == "" {
+			return nil, fmt.Errorf("unknown tier %q", t.Tier)
+		}
+		if seen[t.Tier] {
+			return nil, fmt.Errorf("tier %s is declared more than once", t.Tier)
+		}
+		seen[t.Tier] = true
+		if t.CertIssuerName == "" {
+			return nil, fmt.Errorf("tier %s CertIssuerName cannot be empty", t.Tier)
+		}
+		if len(t.Domains) == 0 {
+			t.Domains = []DomainArgs{
+				{
+					Name:         t.Tier.BaseHost(),
+					HTTPRedirect: true,
+				},
+			}
+		}
+		err := validateDomains(t.Domains)
+		if err != nil {
+			return nil, fmt.Errorf("error validating tier %s domains: %w", t.Tier, err)
+		}
+		for _, d := range t.Domains {
+			if other, ok := domains[d.Name]; ok {
+				return nil, fmt.Errorf("domain %s is served by both tiers %s and %s", d.Name, other, t.Tier)
+			}
+			domains[d.Name] = t.Tier
+		}
+		pool, err := ipNetPrefix(t.LBPoolCIDR)
+		if err != nil {
+			return nil, fmt.Errorf("tier %s LBPoolCIDR is invalid: %w", t.Tier, err)
+		}
+		for other, otherPool := range pools {
+			if pool.Overlaps(otherPool) {
+				return nil, fmt.Errorf("tier %s LBPoolCIDR %s overlaps tier %s one %s", t.Tier, pool, other, otherPool)
+			}
+		}
+		pools[t.Tier] = pool
+		for _, ip := range t.GatewayIPs {
+			if !t.LBPoolCIDR.Contains(ip) {
+				return nil, fmt.Errorf("tier %s gateway IP %s is not in LBPoolCIDR %s", t.Tier, ip, pool)
+			}
+		}
+	}
+	return tiers, nil
+}
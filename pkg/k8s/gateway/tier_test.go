@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTierForHost(t *testing.T) {
+	configured := []TierArgs{
+		{
+			Tier: TierPublicApp,
+			Domains: []DomainArgs{
+				{Name: "kema.dev", Apex: true},
+				{Name: "example.com"},
+			},
+		},
+		{
+			Tier: TierPrivate,
+			Domains: []DomainArgs{
+				{Name: "internal.kema.dev"},
+			},
+		},
+		// Serves its base host
+		{
+			Tier: TierPublicService,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		hostname string
+		tiers    []TierArgs
+		want     Tier
+		wantErr  bool
+	}{
+		{
+			name:     "configured domain",
+			hostname: "app.example.com",
+			tiers:    configured,
+			want:     TierPublicApp,
+		},
+		{
+			name:     "deep subdomain",
+			hostname: "a.b.example.com",
+			tiers:    configured,
+			want:     TierPublicApp,
+		},
+		{
+			name:     "apex served",
+			hostname: "kema.dev",
+			tiers:    configured,
+			want:     TierPublicApp,
+		},
+		{
+			name:     "apex not served",
+			hostname: "example.com",
+			tiers:    configured,
+			wantErr:  true,
+		},
+		{
+			name:     "most specific domain wins",
+			hostname: "db.internal.kema.dev",
+			tiers:    configured,
+			want:     TierPrivate,
+		},
+		{
+			name:     "case and trailing dot",
+			hostname: "App.Example.com.",
+			tiers:    configured,
+			want:     TierPublicApp,
+		},
+		{
+			name:     "tier without domains serves its base host",
+			hostname: "api." + TierPublicService.BaseHost(),
+			tiers:    configured,
+			want:     TierPublicService,
+		},
+		{
+			name:     "unserved domain",
+			hostname: "app.example.org",
+			tiers:    configured,
+			wantErr:  true,
+		},
+		{
+			name:     "suffix is not a subdomain",
+			hostname: "notexample.com",
+			tiers:    configured,
+			wantErr:  true,
+		},
+		{
+			name:     "base host tiers",
+			hostname: "api." + TierInternalService.BaseHost(),
+			tiers:    BaseHostTiers(),
+			want:     TierInternalService,
+		},
+		{
+			name:     "no tiers",
+			hostname: "api." + TierPublicApp.BaseHost(),
+			tiers:    nil,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TierForHost(tt.hostname, tt.tiers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TierForHost(%q) error = %v, wantErr %v", tt.hostname, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("TierForHost(%q) = %s, want %s", tt.hostname, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTiersKeepsCallerTiers(t *testing.T) {
+	_, pool, _ := net.ParseCIDR("192.0.2.0/28")
+	tiers := []TierArgs{
+		{
+			Tier:           TierPublicApp,
+			CertIssuerName: "acme",
+			LBPoolCIDR:     *pool,
+		},
+	}
+	got, err := validateTiers(tiers)
+	if err != nil {
+		t.Fatalf("validateTiers() error = %v", err)
+	}
+
+	if tiers[0].Domains != nil {
+		t.Errorf("validateTiers() modified caller tier domains: %v", tiers[0].Domains)
+	}
+	if len(got[0].Domains) != 1 || got[0].Domains[0].Name != TierPublicApp.BaseHost() {
+		t.Errorf("validated tier domains = %v, want base host %s", got[0].Domains, TierPublicApp.BaseHost())
+	}
+}
@@ -1,22 +1,230 @@
+/*
+Package gwapicrds deploys the Gateway API CRDs, see https://gateway-api.sigs.k8s.io/.
+
+CRD manifests of supported versions are embedded, so that they can be deployed without network
+access. CRDs are never downgraded, as resources stored using a newer version may no longer be
+served.
+
+The version of CRDs served by the cluster is read from their bundle version annotation before
+deploying, whatever installed them, e.g. another stack, Cilium or a manual apply. The deployed
+version is also exported as [ExportKeyVersion], and read back from the stack on next deployments,
+as a fallback for clusters whose CRDs lack the annotation.
+*/
 package gwapicrds
 
+//go:generate ../../../tool/fetch-gateway-api-crds.sh v1.2.1 v1.3.0
+
 import (
+	"embed"
 	"fmt"
+	"io/fs"
+	"path"
+	"slices"
 
+	"dario.cat/mergo"
+	"github.com/blang/semver"
+	apiextensionsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions/v1"
 	yamlv2 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml/v2"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
-// DeployGatewayAPICRDs deploys the Gateway API CRDs to the cluster, returning the corresponding ConfigFile object and an error if any.
-func DeployGatewayAPICRDs(ctx *pulumi.Context) (*yamlv2.ConfigFile, error) {
-	crd, err := yamlv2.NewConfigFile(ctx, "gateway-api-crds", &yamlv2.ConfigFileArgs{
-		// TODO add renovate tracking
-		File: pulumi.String(
-			"https://github.com/kubernetes-sigs/gateway-api/releases/download/v1.2.1/experimental-install.yaml",
-		),
+// A Channel represents a Gateway API release channel, see https://gateway-api.sigs.k8s.io/concepts/versioning/#release-channels.
+type Channel string
+
+const (
+	// ChannelStandard is the release channel of stable resources and fields.
+	ChannelStandard Channel = "standard"
+	// ChannelExperimental is the release channel including experimental resources and fields, e.g. TLSRoute.
+	ChannelExperimental Channel = "experimental"
+)
+
+const (
+	// bundleVersionAnnotation is the annotation holding the Gateway API version of CRDs.
+	bundleVersionAnnotation = "gateway.networking.k8s.io/bundle-version"
+	// referenceCRDName is the name of the CRD whose version is checked before upgrades, being part of all channels.
+	referenceCRDName = "gateways.gateway.networking.k8s.io"
+)
+
+// ExportKeyVersion is the stack output key of the deployed Gateway API version.
+const ExportKeyVersion = "gatewayApiVersion"
+
+//go:embed manifests
+var manifests embed.FS
+
+// A GatewayAPICRDsArgs contains all the parameters needed to deploy the Gateway API CRDs.
+type GatewayAPICRDsArgs struct {
+	// Version is the Gateway API version, among SupportedVersions.
+	Version string
+	// Channel is the Gateway API release channel.
+	Channel Channel
+	// SkipUpgradeCheck is a boolean indicating if CRDs served by the cluster should not be checked for downgrades, e.g.
+	// when the cluster has no CRDs yet or when rendering manifests.
+	SkipUpgradeCheck bool
+}
+
+// GatewayAPICRDsDefaultArgs are the default Gateway API CRDs parameters.
+var GatewayAPICRDsDefaultArgs = GatewayAPICRDsArgs{
+	// TODO add renovate tracking
+	Version: "v1.2.1",
+	Channel: ChannelExperimental,
+}
+
+// SupportedVersions returns the Gateway API versions whose manifests are embedded, sorted, and an error if any.
+func SupportedVersions() ([]string, error) {
+	dirs, err := fs.ReadDir(manifests, "manifests")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded manifests: %w", err)
+	}
+	parsed := map[string]semver.Version{}
+	versions := []string{}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		v, err := semver.ParseTolerant(d.Name())
+		if err != nil {
+			return nil, fmt.Errorf("embedded manifests directory %s is not a version: %w", d.Name(), err)
+		}
+		parsed[d.Name()] = v
+		versions = append(versions, d.Name())
+	}
+	slices.SortFunc(versions, func(a, b string) int {
+		return parsed[a].Compare(parsed[b])
 	})
+	return versions, nil
+}
+
+// manifestPath returns the path of the embedded manifest of the version and channel.
+func manifestPath(version string, channel Channel) string {
+	return path.Join("manifests", version, string(channel)+"-install.yaml")
+}
+
+// validateArgs validates the Gateway API CRDs parameters, returning an error if any of them is invalid.
+func validateArgs(args GatewayAPICRDsArgs) error {
+	if !slices.Contains([]Channel{ChannelStandard, ChannelExperimental}, args.Channel) {
+		return fmt.Errorf("Channel %q is invalid", args.Channel)
+	}
+	versions, err := SupportedVersions()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(versions, args.Version) {
+		return fmt.Errorf(
+			"Version %q is not supported, supported versions are %v, see manifests/README.md to add one",
+			args.Version,
+			versions,
+		)
+	}
+	_, err = fs.Stat(manifests, manifestPath(args.Version, args.Channel))
+	if err != nil {
+		return fmt.Errorf("no %s manifest for Version %s: %w", args.Channel, args.Version, err)
+	}
+	return nil
+}
+
+// mergeArgs fills unset Gateway API CRDs parameters with their default values and validates them, returning an error
+// if any of them is invalid.
+func mergeArgs(args *GatewayAPICRDsArgs) error {
+	err := mergo.Merge(args, GatewayAPICRDsDefaultArgs)
+	if err != nil {
+		return fmt.Errorf("error filling gateway api crds parameters: %w", err)
+	}
+	err = validateArgs(*args)
+	if err != nil {
+		return fmt.Errorf("error validating gateway api crds parameters: %w", err)
+	}
+	return nil
+}
+
+// checkUpgrade returns an error if the version is older than any of the installed ones, i.e. if deploying it would
+// downgrade CRDs. Empty installed versions are ignored, e.g. when CRDs were not deployed yet.
+func checkUpgrade(version string, installed ...string) error {
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return fmt.Errorf("failed to parse gateway api version %q: %w", version, err)
+	}
+	for _, i := range installed {
+		if i == "" {
+			continue
+		}
+		installedVersion, err := semver.ParseTolerant(i)
+		if err != nil {
+			return fmt.Errorf("failed to parse installed gateway api version %q: %w", i, err)
+		}
+		if v.LT(installedVersion) {
+			return fmt.Errorf("refusing to downgrade gateway api crds from %s to %s", i, version)
+		}
+	}
+	return nil
+}
+
+// DeployGatewayAPICRDs deploys the Gateway API CRDs to the cluster from embedded manifests, using the provided
+// parameters merged with the default ones, applying opts to the deployed resources, returning the corresponding
+// ConfigGroup object and an error if any. Unless args.SkipUpgradeCheck is set, CRDs served by the cluster and the
+// version previously deployed by the stack are read first, and deployment fails if it would downgrade them. The
+// deployed version is exported as [ExportKeyVersion].
+func DeployGatewayAPICRDs(
+	ctx *pulumi.Context,
+	args GatewayAPICRDsArgs,
+	opts ...pulumi.ResourceOption,
+) (*yamlv2.ConfigGroup, error) {
+	err := mergeArgs(&args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply default gateway api crds parameters: %w", err)
+	}
+
+	manifest, err := manifests.ReadFile(manifestPath(args.Version, args.Channel))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gateway api crds manifest: %w", err)
+	}
+
+	var yaml pulumi.StringInput = pulumi.String(string(manifest))
+	crdOpts := opts
+	if !args.SkipUpgradeCheck {
+		served, err := apiextensionsv1.GetCustomResourceDefinition(
+			ctx,
+			"gateway-api-crds-served",
+			pulumi.ID(referenceCRDName),
+			nil,
+			opts...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read served gateway api crds: %w", err)
+		}
+		// Stack outputs of the previous deployment as a fallback, nothing being read if the stack was never deployed
+		self, err := pulumi.NewStackReference(
+			ctx,
+			"gateway-api-crds-deployed",
+			&pulumi.StackReferenceArgs{
+				Name: pulumi.String(ctx.Organization() + "/" + ctx.Project() + "/" + ctx.Stack()),
+			},
+			opts...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read deployed gateway api version: %w", err)
+		}
+		// Only provide manifest once served and deployed versions are checked
+		yaml = pulumi.All(
+			served.Metadata.Annotations(),
+			self.GetOutput(pulumi.String(ExportKeyVersion)),
+		).ApplyT(func(v []any) (string, error) {
+			annotations, _ := v[0].(map[string]string)
+			deployed, _ := v[1].(string)
+			err := checkUpgrade(args.Version, annotations[bundleVersionAnnotation], deployed)
+			if err != nil {
+				return "", err
+			}
+			return string(manifest), nil
+		}).(pulumi.StringOutput)
+		crdOpts = append([]pulumi.ResourceOption{pulumi.DependsOn([]pulumi.Resource{served})}, opts...)
+	}
+
+	crd, err := yamlv2.NewConfigGroup(ctx, "gateway-api-crds", &yamlv2.ConfigGroupArgs{
+		Yaml: yaml,
+	}, crdOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to deploy gateway api crds: %w", err)
 	}
-	return crd, err
+	ctx.Export(ExportKeyVersion, pulumi.String(args.Version))
+	return crd, nil
 }
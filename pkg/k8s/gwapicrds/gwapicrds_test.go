@@ -0,0 +1,68 @@
+package gwapicrds
+
+import (
+	"io/fs"
+	"slices"
+	"testing"
+)
+
+func TestSupportedVersionsHaveAllChannels(t *testing.T) {
+	versions, err := SupportedVersions()
+	if err != nil {
+		t.Fatalf("SupportedVersions() error = %v", err)
+	}
+	if len(versions) == 0 {
+		t.Fatal("no embedded manifests, run go generate ./pkg/k8s/gwapicrds")
+	}
+	for _, v := range versions {
+		for _, c := range []Channel{ChannelStandard, ChannelExperimental} {
+			_, err := fs.Stat(manifests, manifestPath(v, c))
+			if err != nil {
+				t.Errorf("version %s has no %s manifest: %v", v, c, err)
+			}
+		}
+	}
+}
+
+func TestDefaultVersionIsSupported(t *testing.T) {
+	versions, err := SupportedVersions()
+	if err != nil {
+		t.Fatalf("SupportedVersions() error = %v", err)
+	}
+	if !slices.Contains(versions, GatewayAPICRDsDefaultArgs.Version) {
+		t.Errorf("default version %s is not among supported versions %v", GatewayAPICRDsDefaultArgs.Version, versions)
+	}
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		served   string
+		deployed string
+		wantErr  bool
+	}{
+		{name: "never deployed", version: "v1.2.1", served: "", deployed: "", wantErr: false},
+		{name: "same version", version: "v1.2.1", served: "v1.2.1", deployed: "v1.2.1", wantErr: false},
+		{name: "upgrade", version: "v1.3.0", served: "v1.2.1", deployed: "v1.2.1", wantErr: false},
+		{name: "downgrade", version: "v1.2.1", served: "v1.3.0", deployed: "v1.3.0", wantErr: true},
+		{name: "newer crds installed elsewhere", version: "v1.2.1", served: "v1.3.0", deployed: "", wantErr: true},
+		{name: "served crds without annotation", version: "v1.2.1", served: "", deployed: "v1.3.0", wantErr: true},
+		{name: "invalid served version", version: "v1.2.1", served: "latest", deployed: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUpgrade(tt.version, tt.served, tt.deployed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf(
+					"checkUpgrade(%q, %q, %q) error = %v, wantErr %v",
+					tt.version,
+					tt.served,
+					tt.deployed,
+					err,
+					tt.wantErr,
+				)
+			}
+		})
+	}
+}
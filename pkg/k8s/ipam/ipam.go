@@ -0,0 +1,313 @@
+/*
+Package ipam allocates per-cluster pod and service CIDRs from declared supernets.
+
+Allocations are tracked in a [Registry] holding every known cluster, so that CIDRs never
+overlap across clusters and multi-cluster routing (e.g. ClusterMesh, BGP) works. Allocation
+is deterministic: already registered clusters keep their CIDRs, and new clusters get the
+first free block of each pool, in the order they are allocated. [Pin] keeps the allocation of a
+cluster stable across runs, and cni.CNIArgs.Allocation uses it as the cluster pod CIDRs.
+*/
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrCollision is a sentinel error indicating that two allocated CIDRs overlap.
+	ErrCollision = errors.New("cidr collision")
+	// ErrExhausted is a sentinel error indicating that a pool has no free CIDR left.
+	ErrExhausted = errors.New("pool exhausted")
+	// ErrDrift is a sentinel error indicating that an allocation differs from the one pinned in state.
+	ErrDrift = errors.New("allocation drift")
+)
+
+// A Pool declares a supernet that CIDRs of a given size are carved from.
+type Pool struct {
+	// Supernet is the prefix CIDRs are allocated from, e.g. 10.0.0.0/8.
+	Supernet netip.Prefix
+	// PrefixLen is the prefix length of allocated CIDRs, e.g. 16.
+	PrefixLen int
+}
+
+// IsZero returns whether the pool is unset.
+func (p Pool) IsZero() bool {
+	return !p.Supernet.IsValid() && p.PrefixLen == 0
+}
+
+// String returns the string representation of the pool, empty if unset.
+func (p Pool) String() string {
+	if p.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d", p.Supernet.Masked().String(), p.PrefixLen)
+}
+
+// validate validates the pool, returning an error if it is invalid.
+func (p Pool) validate() error {
+	if !p.Supernet.IsValid() {
+		return fmt.Errorf("pool supernet is invalid")
+	}
+	if p.PrefixLen < p.Supernet.Bits() || p.PrefixLen > p.Supernet.Addr().BitLen() {
+		return fmt.Errorf(
+			"pool %s prefix length must be between %d and %d",
+			p,
+			p.Supernet.Bits(),
+			p.Supernet.Addr().BitLen(),
+		)
+	}
+	return nil
+}
+
+// A ClusterPools declares the pools cluster CIDRs are allocated from. Unset pools are skipped, e.g. an IPv6-only
+// cluster leaves IPv4 pools unset.
+type ClusterPools struct {
+	// IPv4Pod is the pool IPv4 pod CIDRs are allocated from.
+	IPv4Pod Pool
+	// IPv4Service is the pool IPv4 service CIDRs are allocated from.
+	IPv4Service Pool
+	// IPv6Pod is the pool IPv6 pod CIDRs are allocated from.
+	IPv6Pod Pool
+	// IPv6Service is the pool IPv6 service CIDRs are allocated from.
+	IPv6Service Pool
+}
+
+// validate validates the cluster pools, returning an error if any of them is invalid.
+func (p ClusterPools) validate() error {
+	for _, pool := range []struct {
+		name   string
+		pool   Pool
+		isIPv4 bool
+	}{
+		{"IPv4Pod", p.IPv4Pod, true},
+		{"IPv4Service", p.IPv4Service, true},
+		{"IPv6Pod", p.IPv6Pod, false},
+		{"IPv6Service", p.IPv6Service, false},
+	} {
+		if pool.pool.IsZero() {
+			continue
+		}
+		err := pool.pool.validate()
+		if err != nil {
+			return fmt.Errorf("%s: %w", pool.name, err)
+		}
+		if pool.pool.Supernet.Addr().Is4() != pool.isIPv4 {
+			return fmt.Errorf("%s: pool %s has wrong IP family", pool.name, pool.pool)
+		}
+	}
+	return nil
+}
+
+// A ClusterAllocation contains the CIDRs allocated to a cluster. Unallocated CIDRs are zero prefixes.
+type ClusterAllocation struct {
+	// ClusterName is the name of the cluster.
+	ClusterName string
+	// IPv4PodCIDR is the IPv4 pod CIDR.
+	IPv4PodCIDR netip.Prefix
+	// IPv4ServiceCIDR is the IPv4 service CIDR.
+	IPv4ServiceCIDR netip.Prefix
+	// IPv6PodCIDR is the IPv6 pod CIDR.
+	IPv6PodCIDR netip.Prefix
+	// IPv6ServiceCIDR is the IPv6 service CIDR.
+	IPv6ServiceCIDR netip.Prefix
+}
+
+// Prefixes returns all the CIDRs allocated to the cluster.
+func (a ClusterAllocation) Prefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, p := range []netip.Prefix{a.IPv4PodCIDR, a.IPv4ServiceCIDR, a.IPv6PodCIDR, a.IPv6ServiceCIDR} {
+		if p.IsValid() {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+// A Registry tracks the CIDRs allocated to clusters, detecting collisions between them.
+type Registry struct {
+	allocations []ClusterAllocation
+}
+
+// NewRegistry creates a registry from existing allocations, returning the registry and an error if any of them collide.
+func NewRegistry(allocations ...ClusterAllocation) (*Registry, error) {
+	r := &Registry{}
+	for _, a := range allocations {
+		err := r.Register(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds an existing allocation to the registry, returning an error if the cluster is already registered or if
+// any of its CIDRs overlaps with another cluster's.
+func (r *Registry) Register(allocation ClusterAllocation) error {
+	if allocation.ClusterName == "" {
+		return fmt.Errorf("cluster name cannot be empty")
+	}
+	if _, found := r.Get(allocation.ClusterName); found {
+		return fmt.Errorf("cluster %s is already registered", allocation.ClusterName)
+	}
+	prefixes := allocation.Prefixes()
+	for i, p := range prefixes {
+		if p != p.Masked() {
+			return fmt.Errorf("cluster %s CIDR %s is not masked", allocation.ClusterName, p)
+		}
+		// Pod and service CIDRs of the same cluster can't overlap either
+		for _, q := range prefixes[i+1:] {
+			if p.Overlaps(q) {
+				return fmt.Errorf(
+					"cluster %s CIDRs %s and %s: %w",
+					allocation.ClusterName,
+					p,
+					q,
+					ErrCollision,
+				)
+			}
+		}
+		owner, q, found := r.overlapping(p)
+		if found {
+			return fmt.Errorf(
+				"cluster %s CIDR %s overlaps with cluster %s CIDR %s: %w",
+				allocation.ClusterName,
+				p,
+				owner,
+				q,
+				ErrCollision,
+			)
+		}
+	}
+	r.allocations = append(r.allocations, allocation)
+	return nil
+}
+
+// Get returns the allocation of the cluster, and whether the cluster is registered.
+func (r *Registry) Get(clusterName string) (ClusterAllocation, bool) {
+	for _, a := range r.allocations {
+		if a.ClusterName == clusterName {
+			return a, true
+		}
+	}
+	return ClusterAllocation{}, false
+}
+
+// Allocations returns all registered allocations, sorted by cluster name.
+func (r *Registry) Allocations() []ClusterAllocation {
+	allocations := slices.Clone(r.allocations)
+	slices.SortFunc(allocations, func(a, b ClusterAllocation) int {
+		return strings.Compare(a.ClusterName, b.ClusterName)
+	})
+	return allocations
+}
+
+// Allocate allocates CIDRs for the cluster from pools and registers them, returning the allocation and an error if any.
+// If the cluster is already registered, its existing allocation is returned unchanged.
+func (r *Registry) Allocate(clusterName string, pools ClusterPools) (ClusterAllocation, error) {
+	if existing, found := r.Get(clusterName); found {
+		return existing, nil
+	}
+	err := pools.validate()
+	if err != nil {
+		return ClusterAllocation{}, fmt.Errorf("invalid pools for cluster %s: %w", clusterName, err)
+	}
+	allocation := ClusterAllocation{
+		ClusterName: clusterName,
+	}
+	var pending []netip.Prefix
+	for _, target := range []struct {
+		pool Pool
+		dst  *netip.Prefix
+	}{
+		{pools.IPv4Pod, &allocation.IPv4PodCIDR},
+		{pools.IPv4Service, &allocation.IPv4ServiceCIDR},
+		{pools.IPv6Pod, &allocation.IPv6PodCIDR},
+		{pools.IPv6Service, &allocation.IPv6ServiceCIDR},
+	} {
+		if target.pool.IsZero() {
+			continue
+		}
+		p, err := r.firstFree(target.pool, pending)
+		if err != nil {
+			return ClusterAllocation{}, fmt.Errorf("cluster %s: %w", clusterName, err)
+		}
+		*target.dst = p
+		pending = append(pending, p)
+	}
+	err = r.Register(allocation)
+	if err != nil {
+		return ClusterAllocation{}, err
+	}
+	return allocation, nil
+}
+
+// overlapping returns the cluster name and the CIDR overlapping with p, and whether such CIDR was found.
+func (r *Registry) overlapping(p netip.Prefix) (string, netip.Prefix, bool) {
+	for _, a := range r.allocations {
+		for _, q := range a.Prefixes() {
+			if p.Overlaps(q) {
+				return a.ClusterName, q, true
+			}
+		}
+	}
+	return "", netip.Prefix{}, false
+}
+
+// firstFree returns the first CIDR of pool overlapping neither with registered CIDRs nor with pending ones, and an
+// error if the pool is exhausted.
+func (r *Registry) firstFree(pool Pool, pending []netip.Prefix) (netip.Prefix, error) {
+	supernet := pool.Supernet.Masked()
+	candidate := netip.PrefixFrom(supernet.Addr(), pool.PrefixLen)
+	for supernet.Contains(candidate.Addr()) {
+		_, blocker, found := r.overlapping(candidate)
+		if !found {
+			for _, q := range pending {
+				if candidate.Overlaps(q) {
+					blocker, found = q, true
+					break
+				}
+			}
+		}
+		if !found {
+			return candidate, nil
+		}
+		// Skip past the blocking CIDR, keeping candidates aligned on the allocated prefix length
+		next, ok := nextPrefix(netip.PrefixFrom(lastAddr(blocker), pool.PrefixLen).Masked())
+		if !ok {
+			break
+		}
+		candidate = next
+	}
+	return netip.Prefix{}, fmt.Errorf("no free /%d CIDR left in %s: %w", pool.PrefixLen, supernet, ErrExhausted)
+}
+
+// lastAddr returns the last address of the prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().As16()
+	offset := 0
+	if p.Addr().Is4() {
+		// IPv4 addresses are stored in the last 4 bytes
+		offset = 96
+	}
+	for i := offset + p.Bits(); i < 128; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr := netip.AddrFrom16(b)
+	if p.Addr().Is4() {
+		return addr.Unmap()
+	}
+	return addr
+}
+
+// nextPrefix returns the prefix of same length directly following p, and false if p is the last one of its IP family.
+func nextPrefix(p netip.Prefix) (netip.Prefix, bool) {
+	next := lastAddr(p).Next()
+	if !next.IsValid() {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(next, p.Bits()), true
+}
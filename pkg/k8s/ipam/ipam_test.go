@@ -0,0 +1,360 @@
+package ipam
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestLastAddr(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "10.0.0.0/8", want: "10.255.255.255"},
+		{prefix: "10.1.0.0/16", want: "10.1.255.255"},
+		{prefix: "10.1.2.3/24", want: "10.1.2.255"},
+		{prefix: "192.168.1.1/32", want: "192.168.1.1"},
+		{prefix: "0.0.0.0/0", want: "255.255.255.255"},
+		{prefix: "fd00::/8", want: "fdff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{prefix: "fd00:1::/48", want: "fd00:1:0:ffff:ffff:ffff:ffff:ffff"},
+		{prefix: "fd00::1/128", want: "fd00::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got := lastAddr(netip.MustParsePrefix(tt.prefix))
+			if got != netip.MustParseAddr(tt.want) {
+				t.Errorf("lastAddr(%s) = %s, want %s", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+		wantOk bool
+	}{
+		{prefix: "10.0.0.0/16", want: "10.1.0.0/16", wantOk: true},
+		{prefix: "10.255.0.0/16", want: "11.0.0.0/16", wantOk: true},
+		{prefix: "10.0.0.0/32", want: "10.0.0.1/32", wantOk: true},
+		{prefix: "255.255.0.0/16", wantOk: false},
+		{prefix: "fd00::/48", want: "fd00:0:1::/48", wantOk: true},
+		{prefix: "ffff:ffff:ffff::/48", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got, ok := nextPrefix(netip.MustParsePrefix(tt.prefix))
+			if ok != tt.wantOk {
+				t.Fatalf("nextPrefix(%s) ok = %t, want %t", tt.prefix, ok, tt.wantOk)
+			}
+			if ok && got != netip.MustParsePrefix(tt.want) {
+				t.Errorf("nextPrefix(%s) = %s, want %s", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstFree(t *testing.T) {
+	tests := []struct {
+		name       string
+		registered []ClusterAllocation
+		pool       Pool
+		pending    []string
+		want       string
+		wantErr    error
+	}{
+		{
+			name: "empty registry",
+			pool: Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 16},
+			want: "10.0.0.0/16",
+		},
+		{
+			name: "unmasked supernet",
+			pool: Pool{Supernet: netip.MustParsePrefix("10.1.2.3/8"), PrefixLen: 16},
+			want: "10.0.0.0/16",
+		},
+		{
+			name: "skips registered prefix",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.0.0.0/16")},
+			},
+			pool: Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 16},
+			want: "10.1.0.0/16",
+		},
+		{
+			name: "skips smaller registered prefix",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.0.4.0/24")},
+			},
+			pool: Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 16},
+			want: "10.1.0.0/16",
+		},
+		{
+			name: "skips larger registered prefix",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.0.0.0/12")},
+			},
+			pool: Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 16},
+			want: "10.16.0.0/16",
+		},
+		{
+			name: "fills gap",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.0.0.0/16")},
+				{ClusterName: "c", IPv4PodCIDR: netip.MustParsePrefix("10.2.0.0/16")},
+			},
+			pool: Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 16},
+			want: "10.1.0.0/16",
+		},
+		{
+			name:    "skips pending prefix",
+			pool:    Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 16},
+			pending: []string{"10.0.0.0/16"},
+			want:    "10.1.0.0/16",
+		},
+		{
+			name: "ipv6",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv6PodCIDR: netip.MustParsePrefix("fd00::/48")},
+			},
+			pool: Pool{Supernet: netip.MustParsePrefix("fd00::/40"), PrefixLen: 48},
+			want: "fd00:0:1::/48",
+		},
+		{
+			name: "exhausted",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.0.0.0/9")},
+				{ClusterName: "b", IPv4PodCIDR: netip.MustParsePrefix("10.128.0.0/9")},
+			},
+			pool:    Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 16},
+			wantErr: ErrExhausted,
+		},
+		{
+			name: "exhausted at end of address space",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("255.255.255.0/24")},
+			},
+			pool:    Pool{Supernet: netip.MustParsePrefix("255.255.255.0/24"), PrefixLen: 28},
+			wantErr: ErrExhausted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRegistry(tt.registered...)
+			if err != nil {
+				t.Fatalf("NewRegistry() error = %v", err)
+			}
+			var pending []netip.Prefix
+			for _, p := range tt.pending {
+				pending = append(pending, netip.MustParsePrefix(p))
+			}
+			got, err := r.firstFree(tt.pool, pending)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("firstFree() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("firstFree() error = %v", err)
+			}
+			if got != netip.MustParsePrefix(tt.want) {
+				t.Errorf("firstFree() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	pools := ClusterPools{
+		IPv4Pod:     Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 16},
+		IPv4Service: Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 20},
+		IPv6Pod:     Pool{Supernet: netip.MustParsePrefix("fd00::/40"), PrefixLen: 48},
+		IPv6Service: Pool{Supernet: netip.MustParsePrefix("fd00::/40"), PrefixLen: 108},
+	}
+	tests := []struct {
+		name       string
+		registered []ClusterAllocation
+		cluster    string
+		pools      ClusterPools
+		want       ClusterAllocation
+		wantErr    error
+	}{
+		{
+			name:    "first cluster",
+			cluster: "a",
+			pools:   pools,
+			want: ClusterAllocation{
+				ClusterName:     "a",
+				IPv4PodCIDR:     netip.MustParsePrefix("10.0.0.0/16"),
+				IPv4ServiceCIDR: netip.MustParsePrefix("10.1.0.0/20"),
+				IPv6PodCIDR:     netip.MustParsePrefix("fd00::/48"),
+				IPv6ServiceCIDR: netip.MustParsePrefix("fd00:0:1::/108"),
+			},
+		},
+		{
+			name: "second cluster",
+			registered: []ClusterAllocation{
+				{
+					ClusterName:     "a",
+					IPv4PodCIDR:     netip.MustParsePrefix("10.0.0.0/16"),
+					IPv4ServiceCIDR: netip.MustParsePrefix("10.1.0.0/20"),
+				},
+			},
+			cluster: "b",
+			pools: ClusterPools{
+				IPv4Pod:     pools.IPv4Pod,
+				IPv4Service: pools.IPv4Service,
+			},
+			want: ClusterAllocation{
+				ClusterName:     "b",
+				IPv4PodCIDR:     netip.MustParsePrefix("10.2.0.0/16"),
+				IPv4ServiceCIDR: netip.MustParsePrefix("10.1.16.0/20"),
+			},
+		},
+		{
+			name: "registered cluster keeps allocation",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.42.0.0/16")},
+			},
+			cluster: "a",
+			pools:   pools,
+			want:    ClusterAllocation{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.42.0.0/16")},
+		},
+		{
+			name:    "ipv6 only",
+			cluster: "a",
+			pools:   ClusterPools{IPv6Pod: pools.IPv6Pod},
+			want:    ClusterAllocation{ClusterName: "a", IPv6PodCIDR: netip.MustParsePrefix("fd00::/48")},
+		},
+		{
+			name: "exhausted",
+			registered: []ClusterAllocation{
+				{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.0.0.0/8")},
+			},
+			cluster: "b",
+			pools:   ClusterPools{IPv4Pod: pools.IPv4Pod},
+			wantErr: ErrExhausted,
+		},
+		{
+			name:    "wrong family",
+			cluster: "a",
+			pools:   ClusterPools{IPv4Pod: pools.IPv6Pod},
+			wantErr: errAny,
+		},
+		{
+			name:    "prefix length shorter than supernet",
+			cluster: "a",
+			pools:   ClusterPools{IPv4Pod: Pool{Supernet: netip.MustParsePrefix("10.0.0.0/8"), PrefixLen: 4}},
+			wantErr: errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRegistry(tt.registered...)
+			if err != nil {
+				t.Fatalf("NewRegistry() error = %v", err)
+			}
+			got, err := r.Allocate(tt.cluster, tt.pools)
+			if tt.wantErr != nil {
+				if err == nil || (tt.wantErr != errAny && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("Allocate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Allocate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Allocate() = %+v, want %+v", got, tt.want)
+			}
+			registered, found := r.Get(tt.cluster)
+			if !found || registered != got {
+				t.Errorf("Get(%s) = %+v, %t, want %+v, true", tt.cluster, registered, found, got)
+			}
+		})
+	}
+}
+
+func TestRegisterCollisions(t *testing.T) {
+	existing := ClusterAllocation{
+		ClusterName: "a",
+		IPv4PodCIDR: netip.MustParsePrefix("10.0.0.0/16"),
+		IPv6PodCIDR: netip.MustParsePrefix("fd00::/48"),
+	}
+	tests := []struct {
+		name       string
+		allocation ClusterAllocation
+		wantErr    error
+	}{
+		{
+			name:       "disjoint",
+			allocation: ClusterAllocation{ClusterName: "b", IPv4PodCIDR: netip.MustParsePrefix("10.1.0.0/16")},
+		},
+		{
+			name:       "same prefix",
+			allocation: ClusterAllocation{ClusterName: "b", IPv4PodCIDR: netip.MustParsePrefix("10.0.0.0/16")},
+			wantErr:    ErrCollision,
+		},
+		{
+			name:       "contained prefix",
+			allocation: ClusterAllocation{ClusterName: "b", IPv6PodCIDR: netip.MustParsePrefix("fd00:0:0:1::/64")},
+			wantErr:    ErrCollision,
+		},
+		{
+			name:       "containing prefix",
+			allocation: ClusterAllocation{ClusterName: "b", IPv4ServiceCIDR: netip.MustParsePrefix("10.0.0.0/8")},
+			wantErr:    ErrCollision,
+		},
+		{
+			name: "pod and service of same cluster",
+			allocation: ClusterAllocation{
+				ClusterName:     "b",
+				IPv4PodCIDR:     netip.MustParsePrefix("10.1.0.0/16"),
+				IPv4ServiceCIDR: netip.MustParsePrefix("10.1.0.0/20"),
+			},
+			wantErr: ErrCollision,
+		},
+		{
+			name:       "already registered",
+			allocation: ClusterAllocation{ClusterName: "a", IPv4PodCIDR: netip.MustParsePrefix("10.1.0.0/16")},
+			wantErr:    errAny,
+		},
+		{
+			name:       "unmasked prefix",
+			allocation: ClusterAllocation{ClusterName: "b", IPv4PodCIDR: netip.MustParsePrefix("10.1.2.3/16")},
+			wantErr:    errAny,
+		},
+		{
+			name:       "no cluster name",
+			allocation: ClusterAllocation{IPv4PodCIDR: netip.MustParsePrefix("10.1.0.0/16")},
+			wantErr:    errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRegistry(existing)
+			if err != nil {
+				t.Fatalf("NewRegistry() error = %v", err)
+			}
+			err = r.Register(tt.allocation)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Register() error = %v", err)
+				}
+				return
+			}
+			if err == nil || (tt.wantErr != errAny && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("Register() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(r.Allocations()) != 1 {
+				t.Errorf("Register() registered a colliding allocation: %+v", r.Allocations())
+			}
+		})
+	}
+}
+
+// errAny is a placeholder for tests expecting an error without a specific sentinel.
+var errAny = errors.New("any error")
@@ -0,0 +1,162 @@
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/kemadev/infrastructure-components/pkg/util"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ExportKeyAllocation is the name of the stack output holding the allocation pinned by [Pin].
+const ExportKeyAllocation = "ipamAllocation"
+
+// Pin returns the allocation of the cluster pinned by a previous run, registering it in the registry, or allocates one
+// from pools if none is pinned or if pools changed, applying opts to created resources. The returned allocation is
+// exported as [ExportKeyAllocation], and read back from the stack on next runs, so that it is kept as is even if the
+// registry changes, e.g. when clusters are added. Changing the cluster pools is the only way to get a new allocation.
+// It returns an error if the pinned allocation collides with a registered one, or if the cluster is registered with a
+// different allocation.
+func Pin(
+	ctx *pulumi.Context,
+	registry *Registry,
+	clusterName string,
+	pools ClusterPools,
+	opts ...pulumi.ResourceOption,
+) (ClusterAllocation, error) {
+	pinned, pinnedPools, err := readPinned(ctx, opts...)
+	if err != nil {
+		return ClusterAllocation{}, err
+	}
+
+	allocation := ClusterAllocation{}
+	if pinned.ClusterName == clusterName && pinnedPools == encodePools(pools) {
+		allocation = pinned
+		existing, found := registry.Get(clusterName)
+		if found && encodeAllocation(existing) != encodeAllocation(pinned) {
+			return ClusterAllocation{}, fmt.Errorf(
+				"cluster %s is registered with %q instead of pinned %q, register the pinned allocation instead: %w",
+				clusterName,
+				encodeAllocation(existing),
+				encodeAllocation(pinned),
+				ErrDrift,
+			)
+		}
+		if !found {
+			err = registry.Register(pinned)
+			if err != nil {
+				return ClusterAllocation{}, fmt.Errorf("failed to register pinned allocation: %w", err)
+			}
+		}
+	} else {
+		allocation, err = registry.Allocate(clusterName, pools)
+		if err != nil {
+			return ClusterAllocation{}, err
+		}
+	}
+
+	ctx.Export(ExportKeyAllocation, pulumi.StringMap{
+		"clusterName":     pulumi.String(allocation.ClusterName),
+		"ipv4PodCIDR":     pulumi.String(prefixString(allocation.IPv4PodCIDR)),
+		"ipv4ServiceCIDR": pulumi.String(prefixString(allocation.IPv4ServiceCIDR)),
+		"ipv6PodCIDR":     pulumi.String(prefixString(allocation.IPv6PodCIDR)),
+		"ipv6ServiceCIDR": pulumi.String(prefixString(allocation.IPv6ServiceCIDR)),
+		"pools":           pulumi.String(encodePools(pools)),
+	})
+	return allocation, nil
+}
+
+// readPinned returns the allocation exported by the previous run of the stack and the pools it was allocated from,
+// applying opts to created resources. The allocation is zero if the stack exported none.
+func readPinned(ctx *pulumi.Context, opts ...pulumi.ResourceOption) (ClusterAllocation, string, error) {
+	self, err := pulumi.NewStackReference(
+		ctx,
+		util.FormatResourceName(ctx, "IPAM pinned allocation"),
+		&pulumi.StackReferenceArgs{
+			Name: pulumi.String(ctx.Organization() + "/" + ctx.Project() + "/" + ctx.Stack()),
+		},
+		opts...,
+	)
+	if err != nil {
+		return ClusterAllocation{}, "", fmt.Errorf("failed to reference stack: %w", err)
+	}
+	details, err := self.GetOutputDetails(ExportKeyAllocation)
+	if err != nil {
+		return ClusterAllocation{}, "", fmt.Errorf("failed to read pinned allocation: %w", err)
+	}
+	raw, ok := details.Value.(map[string]any)
+	if !ok {
+		return ClusterAllocation{}, "", nil
+	}
+	exported := map[string]string{}
+	for k, v := range raw {
+		exported[k], _ = v.(string)
+	}
+	pinned, err := ParseAllocation(exported)
+	if err != nil {
+		return ClusterAllocation{}, "", fmt.Errorf("failed to parse pinned allocation: %w", err)
+	}
+	return pinned, exported["pools"], nil
+}
+
+// ParseAllocation parses an allocation exported by [Pin], e.g. read from a stack reference, returning the allocation and
+// an error if any.
+func ParseAllocation(exported map[string]string) (ClusterAllocation, error) {
+	allocation := ClusterAllocation{
+		ClusterName: exported["clusterName"],
+	}
+	if allocation.ClusterName == "" {
+		return ClusterAllocation{}, fmt.Errorf("exported allocation has no cluster name")
+	}
+	for key, dst := range map[string]*netip.Prefix{
+		"ipv4PodCIDR":     &allocation.IPv4PodCIDR,
+		"ipv4ServiceCIDR": &allocation.IPv4ServiceCIDR,
+		"ipv6PodCIDR":     &allocation.IPv6PodCIDR,
+		"ipv6ServiceCIDR": &allocation.IPv6ServiceCIDR,
+	} {
+		if exported[key] == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(exported[key])
+		if err != nil {
+			return ClusterAllocation{}, fmt.Errorf(
+				"cluster %s %s is invalid: %w",
+				allocation.ClusterName,
+				key,
+				err,
+			)
+		}
+		*dst = p
+	}
+	return allocation, nil
+}
+
+// encodeAllocation returns a stable string representation of the allocation.
+func encodeAllocation(allocation ClusterAllocation) string {
+	return strings.Join([]string{
+		allocation.ClusterName,
+		prefixString(allocation.IPv4PodCIDR),
+		prefixString(allocation.IPv4ServiceCIDR),
+		prefixString(allocation.IPv6PodCIDR),
+		prefixString(allocation.IPv6ServiceCIDR),
+	}, ",")
+}
+
+// encodePools returns a stable string representation of the pools.
+func encodePools(pools ClusterPools) string {
+	return strings.Join([]string{
+		pools.IPv4Pod.String(),
+		pools.IPv4Service.String(),
+		pools.IPv6Pod.String(),
+		pools.IPv6Service.String(),
+	}, ",")
+}
+
+// prefixString returns the string representation of the prefix, empty if unset.
+func prefixString(p netip.Prefix) string {
+	if !p.IsValid() {
+		return ""
+	}
+	return p.String()
+}
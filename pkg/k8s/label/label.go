@@ -127,15 +127,42 @@ const (
 	NodeArchARM64 = "arm64"
 )
 
-// Labels for shared gateway access, enabling the usage of the shared gateway
+// Labels for gateway access, enabling the usage of tier gateways
 const (
-	SharedGatewayAccessLabelKey   = "shared-gateway-access"
-	SharedGatewayAccessLabelValue = "true"
+	// GatewayAccessLabelKeyPrefix is the prefix of namespace label keys granting access to a tier gateway, suffixed with
+	// the tier name.
+	GatewayAccessLabelKeyPrefix = "gateway-access." + OrgNs + "/"
+	// GatewayAccessLabelValue is the label value granting access to a tier gateway.
+	GatewayAccessLabelValue = "true"
+	// GatewayTierLabelKey is the label key of gateways load balancer services, the value being the tier name. It selects
+	// the IP pool and announcement policies of the tier.
+	GatewayTierLabelKey = "gateway." + OrgNs + "/tier"
+
+	// SharedGatewayAccessLabelKey is the namespace label key that granted access to the former single shared gateway.
+	// It no longer grants access to any gateway.
+	//
+	// Deprecated: use the access label key of the tier gateway instead, see GatewayAccessLabelKeyPrefix.
+	SharedGatewayAccessLabelKey = "shared-gateway-access"
+	// SharedGatewayAccessLabelValue is the label value that granted access to the former single shared gateway.
+	//
+	// Deprecated: use GatewayAccessLabelValue instead.
+	SharedGatewayAccessLabelValue = GatewayAccessLabelValue
 )
 
+// Labels for egress gateway usage, routing pods outbound traffic through an egress gateway
+const (
+	// EgressGatewayLabelKey is the label key selecting pods using an egress gateway, the value being the gateway name.
+	EgressGatewayLabelKey = "egress-gateway." + OrgNs + "/name"
+)
+
+// A Taint represents a node taint, see https://kubernetes.io/docs/concepts/scheduling-eviction/taint-and-toleration/.
+// Use NewTaint or ValidateTaint to check its syntax.
 type Taint struct {
-	Key    string
-	Value  string
+	// Key is the taint key, following label key syntax.
+	Key string
+	// Value is the taint value, following label value syntax. It may be empty.
+	Value string
+	// Effect is the taint effect, one of the TaintEffect constants.
 	Effect string
 }
 
@@ -186,3 +213,11 @@ const (
 	// TaintEffectNoExecute is the taint effect for nodes that should not execute any pods.
 	TaintEffectNoExecute = "NoExecute"
 )
+
+// Labels for access log redaction, removing sensitive fields from gateway access logs
+const (
+	// AccessLogRedactLabelKey is the label key of pods whose gateway access logs are redacted, e.g. as they handle
+	// sensitive data.
+	AccessLogRedactLabelKey   = "access-log." + OrgNs + "/redact"
+	AccessLogRedactLabelValue = "true"
+)
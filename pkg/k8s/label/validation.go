@@ -0,0 +1,180 @@
+package label
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// maxKeyPrefixLength is the maximum length of a label key prefix, being a DNS-1123 subdomain.
+	maxKeyPrefixLength = 253
+	// maxNameLength is the maximum length of a label key name and of a label value.
+	maxNameLength = 63
+)
+
+var (
+	// dns1123SubdomainRegexp matches DNS-1123 subdomains, see https://datatracker.ietf.org/doc/html/rfc1123.
+	dns1123SubdomainRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	// qualifiedNameRegexp matches label key names and non-empty label values.
+	qualifiedNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+)
+
+// A Key represents a label key, made of an optional DNS-1123 subdomain prefix and a name separated by a slash, see
+// https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#syntax-and-character-set.
+type Key string
+
+// NewKey returns the label key and an error if its syntax is invalid.
+func NewKey(key string) (Key, error) {
+	k := Key(key)
+	err := k.Validate()
+	if err != nil {
+		return "", err
+	}
+	return k, nil
+}
+
+// Prefix returns the prefix of the label key, empty if unset.
+func (k Key) Prefix() string {
+	prefix, _, found := strings.Cut(string(k), "/")
+	if !found {
+		return ""
+	}
+	return prefix
+}
+
+// Name returns the name of the label key, i.e. without its prefix.
+func (k Key) Name() string {
+	_, name, found := strings.Cut(string(k), "/")
+	if !found {
+		return string(k)
+	}
+	return name
+}
+
+// Validate returns an error if the label key syntax is invalid.
+func (k Key) Validate() error {
+	if strings.Count(string(k), "/") > 1 {
+		return fmt.Errorf("label key %q cannot contain more than one slash", k)
+	}
+	if strings.Contains(string(k), "/") {
+		prefix := k.Prefix()
+		if prefix == "" {
+			return fmt.Errorf("label key %q prefix cannot be empty", k)
+		}
+		if len(prefix) > maxKeyPrefixLength {
+			return fmt.Errorf("label key %q prefix cannot be longer than %d characters", k, maxKeyPrefixLength)
+		}
+		if !dns1123SubdomainRegexp.MatchString(prefix) {
+			return fmt.Errorf("label key %q prefix must be a lowercase DNS-1123 subdomain", k)
+		}
+	}
+	name := k.Name()
+	if name == "" {
+		return fmt.Errorf("label key %q name cannot be empty", k)
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("label key %q name cannot be longer than %d characters", k, maxNameLength)
+	}
+	if !qualifiedNameRegexp.MatchString(name) {
+		return fmt.Errorf(
+			"label key %q name must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character",
+			k,
+		)
+	}
+	return nil
+}
+
+// ValidateValue returns an error if the label value syntax is invalid. Empty values are valid.
+func ValidateValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > maxNameLength {
+		return fmt.Errorf("label value %q cannot be longer than %d characters", value, maxNameLength)
+	}
+	if !qualifiedNameRegexp.MatchString(value) {
+		return fmt.Errorf(
+			"label value %q must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character",
+			value,
+		)
+	}
+	return nil
+}
+
+// ValidateLabels returns an error if any key or value of the labels is invalid.
+func ValidateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		err := Key(k).Validate()
+		if err != nil {
+			return err
+		}
+		err = ValidateValue(v)
+		if err != nil {
+			return fmt.Errorf("label %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// ValidateTaintEffect returns an error if the taint effect is not one of the TaintEffect constants.
+func ValidateTaintEffect(effect string) error {
+	effects := []string{TaintEffectNoSchedule, TaintEffectPreferNoSchedule, TaintEffectNoExecute}
+	if !slices.Contains(effects, effect) {
+		return fmt.Errorf("taint effect %q is invalid, valid effects are %v", effect, effects)
+	}
+	return nil
+}
+
+// NewTaint returns the taint and an error if its key, value or effect is invalid.
+func NewTaint(key string, value string, effect string) (Taint, error) {
+	t := Taint{
+		Key:    key,
+		Value:  value,
+		Effect: effect,
+	}
+	err := ValidateTaint(t)
+	if err != nil {
+		return Taint{}, err
+	}
+	return t, nil
+}
+
+// ValidateTaint returns an error if the taint key, value or effect is invalid.
+func ValidateTaint(t Taint) error {
+	err := Key(t.Key).Validate()
+	if err != nil {
+		return fmt.Errorf("invalid taint key: %w", err)
+	}
+	err = ValidateValue(t.Value)
+	if err != nil {
+		return fmt.Errorf("invalid taint %s value: %w", t.Key, err)
+	}
+	err = ValidateTaintEffect(t.Effect)
+	if err != nil {
+		return fmt.Errorf("invalid taint %s: %w", t.Key, err)
+	}
+	return nil
+}
+
+// ToToleration returns the toleration of pods allowed on nodes with the taint, matching its value if set, any value
+// otherwise.
+func (t Taint) ToToleration() corev1.TolerationArgs {
+	if t.Value == "" {
+		return corev1.TolerationArgs{
+			Key:      pulumi.String(t.Key),
+			Operator: pulumi.String("Exists"),
+			Effect:   pulumi.String(t.Effect),
+		}
+	}
+	return corev1.TolerationArgs{
+		Key:      pulumi.String(t.Key),
+		Operator: pulumi.String("Equal"),
+		Value:    pulumi.String(t.Value),
+		Effect:   pulumi.String(t.Effect),
+	}
+}
@@ -0,0 +1,144 @@
+package nodeprofile
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"gopkg.in/yaml.v3"
+)
+
+// An InventoryNode represents a node of the inventory.
+type InventoryNode struct {
+	// Name is the name of the Node object.
+	Name string `yaml:"name"`
+	// Profile is the profile of the node.
+	Profile Profile `yaml:"profile"`
+	// Labels are extra labels of the node, e.g. topology ones. They cannot override profile labels.
+	Labels map[string]string `yaml:"labels"`
+	// Taints are extra taints of the node. They cannot override profile taints.
+	Taints []label.Taint `yaml:"taints"`
+}
+
+// An Inventory lists the nodes to label and taint according to their profile, e.g.
+//
+//	nodes:
+//	  - name: worker-1
+//	    profile: memory-intensive
+//	    labels:
+//	      topology.kubernetes.io/zone: zone-a
+type Inventory struct {
+	// Nodes are the nodes of the inventory.
+	Nodes []InventoryNode `yaml:"nodes"`
+}
+
+// ReadInventory reads and validates the inventory file at path, returning it and an error if any. Unknown fields are
+// rejected, so that typos do not silently leave nodes unlabeled.
+func ReadInventory(path string) (Inventory, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Inventory{}, fmt.Errorf("failed to read inventory file: %w", err)
+	}
+	inventory := Inventory{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&inventory)
+	if err != nil {
+		return Inventory{}, fmt.Errorf("failed to decode inventory file %s: %w", path, err)
+	}
+	err = ValidateInventory(inventory)
+	if err != nil {
+		return Inventory{}, fmt.Errorf("error validating inventory file %s: %w", path, err)
+	}
+	return inventory, nil
+}
+
+// ValidateInventory returns an error if any node of the inventory is invalid, declared more than once, or overrides
+// its profile labels or taints.
+func ValidateInventory(inventory Inventory) error {
+	names := map[string]bool{}
+	for _, n := range inventory.Nodes {
+		if n.Name == "" {
+			return fmt.Errorf("node name cannot be empty")
+		}
+		if names[n.Name] {
+			return fmt.Errorf("node %s is declared more than once", n.Name)
+		}
+		names[n.Name] = true
+		err := n.Profile.Validate()
+		if err != nil {
+			return fmt.Errorf("node %s: %w", n.Name, err)
+		}
+		for k := range n.Profile.NodeLabels() {
+			if _, ok := n.Labels[k]; ok {
+				return fmt.Errorf("node %s label %s is set by its profile %s", n.Name, k, n.Profile)
+			}
+		}
+		taintKeys := map[string]bool{}
+		for _, t := range n.Profile.NodeTaints() {
+			taintKeys[t.Key] = true
+		}
+		err = label.ValidateLabels(n.Labels)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", n.Name, err)
+		}
+		for _, t := range n.Taints {
+			err := label.ValidateTaint(t)
+			if err != nil {
+				return fmt.Errorf("node %s: %w", n.Name, err)
+			}
+			if taintKeys[t.Key] {
+				return fmt.Errorf("node %s taint %s is set by its profile %s or declared more than once", n.Name, t.Key, n.Profile)
+			}
+			taintKeys[t.Key] = true
+		}
+	}
+	return nil
+}
+
+// DeployNodeProfiles labels and taints the nodes of the inventory according to their profile, applying opts to all
+// created resources, and returns an error if any. Nodes are patched using server-side apply, so that labels and taints
+// set by other field managers are kept, except for taints, which Kubernetes manages as a whole list.
+func DeployNodeProfiles(ctx *pulumi.Context, inventory Inventory, opts ...pulumi.ResourceOption) error {
+	err := ValidateInventory(inventory)
+	if err != nil {
+		return fmt.Errorf("error validating inventory: %w", err)
+	}
+
+	for _, n := range inventory.Nodes {
+		labels := maps.Clone(n.Labels)
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		maps.Copy(labels, n.Profile.NodeLabels())
+
+		taints := corev1.TaintPatchArray{}
+		for _, t := range append(n.Profile.NodeTaints(), n.Taints...) {
+			taints = append(taints, corev1.TaintPatchArgs{
+				Key:    pulumi.String(t.Key),
+				Value:  pulumi.String(t.Value),
+				Effect: pulumi.String(t.Effect),
+			})
+		}
+
+		_, err := corev1.NewNodePatch(ctx, "node-"+n.Name, &corev1.NodePatchArgs{
+			Metadata: &metav1.ObjectMetaPatchArgs{
+				Name:   pulumi.String(n.Name),
+				Labels: pulumi.ToStringMap(labels),
+			},
+			Spec: &corev1.NodeSpecPatchArgs{
+				Taints: taints,
+			},
+		}, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to patch node %s: %w", n.Name, err)
+		}
+	}
+
+	return nil
+}
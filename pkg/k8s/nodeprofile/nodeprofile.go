@@ -0,0 +1,190 @@
+/*
+Package nodeprofile turns node role labels and nodepurpose taints into scheduling presets.
+
+Nodes are labeled and tainted according to their profile, see DeployNodeProfiles, and workloads
+select a profile to get the matching node selector, affinity and tolerations.
+*/
+package nodeprofile
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// A Profile represents a node pool profile, i.e. the kind of workloads nodes are dedicated to.
+type Profile string
+
+const (
+	// ProfileGeneric is the profile of generic compute nodes, which are not tainted.
+	ProfileGeneric Profile = "generic"
+	// ProfileCPUIntensive is the profile of nodes specialized for cpu-intensive workloads.
+	ProfileCPUIntensive Profile = "cpu-intensive"
+	// ProfileMemoryIntensive is the profile of nodes specialized for memory-intensive workloads.
+	ProfileMemoryIntensive Profile = "memory-intensive"
+	// ProfileNetworkIntensive is the profile of nodes specialized for network-intensive workloads.
+	ProfileNetworkIntensive Profile = "network-intensive"
+	// ProfileStorage is the profile of nodes specialized for disk-intensive workloads.
+	ProfileStorage Profile = "storage"
+	// ProfileAccelerated is the profile of nodes dedicated to accelerated workloads (e.g. FPGA, TPU).
+	ProfileAccelerated Profile = "accelerated"
+	// ProfileGPU is the profile of nodes dedicated to GPU workloads.
+	ProfileGPU Profile = "gpu"
+)
+
+// Profiles is the list of all profiles.
+var Profiles = []Profile{
+	ProfileGeneric,
+	ProfileCPUIntensive,
+	ProfileMemoryIntensive,
+	ProfileNetworkIntensive,
+	ProfileStorage,
+	ProfileAccelerated,
+	ProfileGPU,
+}
+
+// profileSpec is the node role label and nodepurpose taint of a profile.
+type profileSpec struct {
+	labelKey   string
+	labelValue string
+	// taintKey is the nodepurpose taint key, nodes not being tainted if empty.
+	taintKey string
+}
+
+var profileSpecs = map[Profile]profileSpec{
+	ProfileGeneric: {
+		labelKey:   label.NodeRoleComputeLabelKey,
+		labelValue: label.NodeRoleComputeGeneric,
+	},
+	ProfileCPUIntensive: {
+		labelKey:   label.NodeRoleCPUIntensiveLabelKey,
+		labelValue: label.NodeRoleComputeCPUIntensiveGeneric,
+		taintKey:   label.NodeTaintCPUIntensiveKey,
+	},
+	ProfileMemoryIntensive: {
+		labelKey:   label.NodeRoleMemoryIntensiveLabelKey,
+		labelValue: label.NodeRoleComputeMemoryIntensiveGeneric,
+		taintKey:   label.NodeTaintMemoryIntensiveKey,
+	},
+	ProfileNetworkIntensive: {
+		labelKey:   label.NodeRoleNetworkIntensiveLabelKey,
+		labelValue: label.NodeRoleComputeNetworkIntensiveGeneric,
+		taintKey:   label.NodeTaintNetworkIntensiveKey,
+	},
+	ProfileStorage: {
+		labelKey:   label.NodeRoleStorageLabelKey,
+		labelValue: label.NodeRoleStorageGeneric,
+		taintKey:   label.NodeTaintStorageIntensiveKey,
+	},
+	ProfileAccelerated: {
+		labelKey:   label.NodeRoleAcceleratedLabelKey,
+		labelValue: label.NodeRoleAcceleratedGeneric,
+		taintKey:   label.NodeTaintAcceleratedKey,
+	},
+	ProfileGPU: {
+		labelKey:   label.NodeRoleGPULabelKey,
+		labelValue: label.NodeRoleGenericGPU,
+		taintKey:   label.NodeTaintGPUKey,
+	},
+}
+
+// Validate returns an error if the profile is unknown.
+func (p Profile) Validate() error {
+	if !slices.Contains(Profiles, p) {
+		return fmt.Errorf("profile %q is invalid, valid profiles are %v", p, Profiles)
+	}
+	return nil
+}
+
+// NodeLabels returns the labels of nodes of the profile.
+func (p Profile) NodeLabels() map[string]string {
+	spec := profileSpecs[p]
+	return map[string]string{
+		spec.labelKey: spec.labelValue,
+	}
+}
+
+// NodeTaints returns the taints of nodes of the profile, repelling workloads that did not select it.
+func (p Profile) NodeTaints() []label.Taint {
+	spec := profileSpecs[p]
+	if spec.taintKey == "" {
+		return nil
+	}
+	return []label.Taint{
+		{
+			Key:    spec.taintKey,
+			Value:  spec.labelValue,
+			Effect: label.TaintEffectNoSchedule,
+		},
+	}
+}
+
+// NodeSelector returns the node selector scheduling pods on nodes of the profile only.
+func (p Profile) NodeSelector() pulumi.StringMap {
+	return pulumi.ToStringMap(p.NodeLabels())
+}
+
+// Affinity returns the node affinity scheduling pods on nodes of the profile, only if required is true, preferably
+// otherwise, e.g. to fall back to other nodes when the pool is full. Tolerations are still needed for tainted profiles.
+func (p Profile) Affinity(required bool) *corev1.AffinityArgs {
+	spec := profileSpecs[p]
+	term := &corev1.NodeSelectorTermArgs{
+		MatchExpressions: corev1.NodeSelectorRequirementArray{
+			&corev1.NodeSelectorRequirementArgs{
+				Key:      pulumi.String(spec.labelKey),
+				Operator: pulumi.String("In"),
+				Values: pulumi.StringArray{
+					pulumi.String(spec.labelValue),
+				},
+			},
+		},
+	}
+	if required {
+		return &corev1.AffinityArgs{
+			NodeAffinity: &corev1.NodeAffinityArgs{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelectorArgs{
+					NodeSelectorTerms: corev1.NodeSelectorTermArray{term},
+				},
+			},
+		}
+	}
+	return &corev1.AffinityArgs{
+		NodeAffinity: &corev1.NodeAffinityArgs{
+			PreferredDuringSchedulingIgnoredDuringExecution: corev1.PreferredSchedulingTermArray{
+				&corev1.PreferredSchedulingTermArgs{
+					Weight:     pulumi.Int(100),
+					Preference: term,
+				},
+			},
+		},
+	}
+}
+
+// Tolerations returns the tolerations of pods allowed on nodes of the profile.
+func (p Profile) Tolerations() corev1.TolerationArray {
+	tolerations := corev1.TolerationArray{}
+	for _, t := range p.NodeTaints() {
+		tolerations = append(tolerations, t.ToToleration())
+	}
+	return tolerations
+}
+
+// WithTolerations returns the tolerations with the ones of the profile appended, e.g. to extend default tolerations.
+func (p Profile) WithTolerations(tolerations corev1.TolerationArrayInput) corev1.TolerationArrayOutput {
+	taints := p.NodeTaints()
+	return tolerations.ToTolerationArrayOutput().ApplyT(func(ts []corev1.Toleration) []corev1.Toleration {
+		res := slices.Clone(ts)
+		for _, t := range taints {
+			res = append(res, corev1.Toleration{
+				Key:      pulumi.StringRef(t.Key),
+				Operator: pulumi.StringRef("Equal"),
+				Value:    pulumi.StringRef(t.Value),
+				Effect:   pulumi.StringRef(t.Effect),
+			})
+		}
+		return res
+	}).(corev1.TolerationArrayOutput)
+}
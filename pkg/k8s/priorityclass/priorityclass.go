@@ -2,7 +2,9 @@ package priorityclass
 
 import (
 	"fmt"
+	"slices"
 
+	"github.com/kemadev/infrastructure-components/pkg/k8s/pulumilabel"
 	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
 	schedulingv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/scheduling/v1"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
@@ -23,116 +25,168 @@ const (
 	PriorityClassHigh = "high"
 )
 
-func CreateDefaultPriorityClasses(ctx *pulumi.Context) error {
-	_, err := schedulingv1.NewPriorityClass(
-		ctx,
-		PriorityClassEventual,
-		&schedulingv1.PriorityClassArgs{
-			Value: pulumi.Int(-1000000),
-			Description: pulumi.String(
-				"Very low priority class, lower than low, does not preempt other pods",
-			),
-			Metadata: &metav1.ObjectMetaArgs{
-				Name:   pulumi.String(PriorityClassEventual),
-				Labels: pulumi.StringMap{},
-			},
-			PreemptionPolicy: pulumi.String("Never"),
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create "+PriorityClassEventual+" priority class: %v", err)
-	}
+const (
+	// PreemptionPolicyPreemptLowerPriority lets pods preempt pods of lower priority classes.
+	PreemptionPolicyPreemptLowerPriority = "PreemptLowerPriority"
+	// PreemptionPolicyNever prevents pods from preempting other pods.
+	PreemptionPolicyNever = "Never"
+)
 
-	_, err = schedulingv1.NewPriorityClass(
-		ctx,
-		PriorityClassLow,
-		&schedulingv1.PriorityClassArgs{
-			Value: pulumi.Int(-1000),
-			Description: pulumi.String(
-				"Low priority class, lower than default, higher than eventual, preempts other pods",
-			),
-			Metadata: &metav1.ObjectMetaArgs{
-				Name:   pulumi.String(PriorityClassLow),
-				Labels: pulumi.StringMap{},
-			},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create "+PriorityClassLow+" priority class: %v", err)
-	}
+// maxUserValue is the highest priority value of user-defined classes, higher values being reserved to system classes.
+const maxUserValue = 1000000000
 
-	_, err = schedulingv1.NewPriorityClass(
-		ctx,
-		PriorityClassDefault,
-		&schedulingv1.PriorityClassArgs{
-			Value: pulumi.Int(0),
-			Description: pulumi.String(
-				"Default priority class, lower than normal, higher than low, preempts other pods, used by pods that do not specify a priority class, should be used explicitly",
-			),
-			GlobalDefault: pulumi.Bool(true),
-			Metadata: &metav1.ObjectMetaArgs{
-				Name:   pulumi.String(PriorityClassDefault),
-				Labels: pulumi.StringMap{},
-			},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create "+PriorityClassDefault+" priority class: %v", err)
-	}
+// A PriorityClass represents a priority class of the catalogue.
+type PriorityClass struct {
+	// Name is the name of the priority class.
+	Name string
+	// Value is the priority value, higher values being scheduled first.
+	Value int32
+	// Description is the description of the priority class, telling when it should be used.
+	Description string
+	// GlobalDefault is a boolean indicating if the priority class is used by pods that do not specify one. Exactly one
+	// class of the catalogue must be the global default.
+	GlobalDefault bool
+	// PreemptionPolicy is the preemption policy of pods using the priority class. Defaults to
+	// PreemptionPolicyPreemptLowerPriority.
+	PreemptionPolicy string
+	// MaxPodsPerNamespace is the default number of pods each namespace with a priority quota may run using the priority
+	// class, see NamespacePriorityQuota. Pods are not limited if zero.
+	MaxPodsPerNamespace int
+}
 
-	_, err = schedulingv1.NewPriorityClass(
-		ctx,
-		PriorityClassNormal,
-		&schedulingv1.PriorityClassArgs{
-			Value: pulumi.Int(1000),
-			Description: pulumi.String(
-				"Normal priority, lower than moderate, higher than default, preempts other pods, should be used as a default",
-			),
-			Metadata: &metav1.ObjectMetaArgs{
-				Name:   pulumi.String(PriorityClassNormal),
-				Labels: pulumi.StringMap{},
-			},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create "+PriorityClassNormal+" priority class: %v", err)
+// DefaultPriorityClasses is the default priority class catalogue, ordered by increasing value.
+var DefaultPriorityClasses = []PriorityClass{
+	{
+		Name:             PriorityClassEventual,
+		Value:            -1000000,
+		Description:      "Very low priority class, lower than low, does not preempt other pods",
+		PreemptionPolicy: PreemptionPolicyNever,
+	},
+	{
+		Name:        PriorityClassLow,
+		Value:       -1000,
+		Description: "Low priority class, lower than default, higher than eventual, preempts other pods",
+	},
+	{
+		Name:          PriorityClassDefault,
+		Value:         0,
+		Description:   "Default priority class, lower than normal, higher than low, preempts other pods, used by pods that do not specify a priority class, should be used explicitly",
+		GlobalDefault: true,
+	},
+	{
+		Name:        PriorityClassNormal,
+		Value:       1000,
+		Description: "Normal priority, lower than moderate, higher than default, preempts other pods, should be used as a default",
+	},
+	{
+		Name:        PriorityClassModerate,
+		Value:       500000,
+		Description: "Moderate priority, lower than high, higher than normal, preempts other pods",
+	},
+	{
+		Name:        PriorityClassHigh,
+		Value:       1000000,
+		Description: "High priority, higher than moderate, preempts other pods",
+	},
+}
+
+// ValidatePriorityClasses validates the priority class catalogue, returning an error if any class is invalid, if values
+// are not strictly increasing in declaration order, or if there is not exactly one global default.
+func ValidatePriorityClasses(classes []PriorityClass) error {
+	if len(classes) == 0 {
+		return fmt.Errorf("priority classes cannot be empty")
 	}
+	names := map[string]bool{}
+	defaults := []string{}
+	for i, c := range classes {
+		if c.Name == "" {
+			return fmt.Errorf("priority class name cannot be empty")
+		}
+		if names[c.Name] {
+			return fmt.Errorf("priority class %s is declared more than once", c.Name)
+		}
+		names[c.Name] = true
+		if c.Description == "" {
+			return fmt.Errorf("priority class %s Description cannot be empty", c.Name)
+		}
+		if c.Value > maxUserValue {
+			return fmt.Errorf("priority class %s Value %d exceeds %d, reserved to system classes", c.Name, c.Value, maxUserValue)
+		}
+		if i > 0 && c.Value <= classes[i-1].Value {
+			return fmt.Errorf(
+				"priority class %s Value %d must be greater than %s one %d",
+				c.Name,
+				c.Value,
+				classes[i-1].Name,
+				classes[i-1].Value,
+			)
+		}
+		if c.PreemptionPolicy != "" &&
+			!slices.Contains([]string{PreemptionPolicyPreemptLowerPriority, PreemptionPolicyNever}, c.PreemptionPolicy) {
+			return fmt.Errorf("priority class %s PreemptionPolicy %q is invalid", c.Name, c.PreemptionPolicy)
+		}
+		if c.MaxPodsPerNamespace < 0 {
+			return fmt.Errorf("priority class %s MaxPodsPerNamespace cannot be negative", c.Name)
+		}
+		if c.GlobalDefault {
+			defaults = append(defaults, c.Name)
+		}
+	}
+	if len(defaults) != 1 {
+		return fmt.Errorf("exactly one priority class must be the global default, got %v", defaults)
+	}
+	return nil
+}
 
-	_, err = schedulingv1.NewPriorityClass(
-		ctx,
-		PriorityClassModerate,
-		&schedulingv1.PriorityClassArgs{
-			Value: pulumi.Int(500000),
-			Description: pulumi.String(
-				"Moderate priority, lower than high, higher than normal, preempts other pods",
-			),
-			Metadata: &metav1.ObjectMetaArgs{
-				Name:   pulumi.String(PriorityClassModerate),
-				Labels: pulumi.StringMap{},
-			},
-		},
+// priorityClassLabels returns the labels of priority class resources.
+func priorityClassLabels() pulumi.StringMap {
+	return pulumilabel.DefaultLabels(
+		pulumi.String("priority-class"),
+		pulumi.String("priority-class"),
+		pulumi.String("1"),
+		pulumi.String("priority"),
+		pulumi.String("scheduling"),
 	)
+}
+
+// CreatePriorityClasses validates the priority class catalogue and creates its classes, applying opts to all of them,
+// and returns an error if any.
+func CreatePriorityClasses(ctx *pulumi.Context, classes []PriorityClass, opts ...pulumi.ResourceOption) error {
+	err := ValidatePriorityClasses(classes)
 	if err != nil {
-		return fmt.Errorf("failed to create "+PriorityClassModerate+" priority class: %v", err)
+		return fmt.Errorf("error validating priority classes: %w", err)
 	}
 
-	_, err = schedulingv1.NewPriorityClass(
-		ctx,
-		PriorityClassHigh,
-		&schedulingv1.PriorityClassArgs{
-			Value: pulumi.Int(1000000),
-			Description: pulumi.String(
-				"High priority, higher than moderate, preempts other pods",
-			),
-			Metadata: &metav1.ObjectMetaArgs{
-				Name:   pulumi.String(PriorityClassHigh),
-				Labels: pulumi.StringMap{},
+	labels := priorityClassLabels()
+	for _, c := range classes {
+		preemptionPolicy := c.PreemptionPolicy
+		if preemptionPolicy == "" {
+			preemptionPolicy = PreemptionPolicyPreemptLowerPriority
+		}
+		_, err := schedulingv1.NewPriorityClass(
+			ctx,
+			c.Name,
+			&schedulingv1.PriorityClassArgs{
+				Value:         pulumi.Int(int(c.Value)),
+				Description:   pulumi.String(c.Description),
+				GlobalDefault: pulumi.Bool(c.GlobalDefault),
+				Metadata: &metav1.ObjectMetaArgs{
+					Name:   pulumi.String(c.Name),
+					Labels: labels,
+				},
+				PreemptionPolicy: pulumi.String(preemptionPolicy),
 			},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create "+PriorityClassHigh+" priority class: %v", err)
+			opts...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create %s priority class: %w", c.Name, err)
+		}
 	}
 
 	return nil
 }
+
+// CreateDefaultPriorityClasses creates the default priority classes, applying opts to all of them, and returns an error if any.
+func CreateDefaultPriorityClasses(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
+	return CreatePriorityClasses(ctx, DefaultPriorityClasses, opts...)
+}
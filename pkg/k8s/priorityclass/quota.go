@@ -0,0 +1,111 @@
+package priorityclass
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// A NamespacePriorityQuota caps the number of pods a namespace may run at each priority, see
+// https://kubernetes.io/docs/concepts/policy/resource-quotas/#limit-priority-class-consumption-by-default. Classes
+// without a limit are not restricted in the namespace, unless the API server is configured to limit their consumption
+// by default.
+type NamespacePriorityQuota struct {
+	// Namespace is the namespace the quotas apply to.
+	Namespace string
+	// MaxPods is the number of pods the namespace may run using each priority class, keyed by class name, overriding
+	// PriorityClass.MaxPodsPerNamespace. Zero forbids the class in the namespace.
+	MaxPods map[string]int
+}
+
+// priorityQuotas returns the pods limit of the namespace for each limited priority class, keyed by class name, and an
+// error if the quota refers to unknown classes.
+func priorityQuotas(classes []PriorityClass, quota NamespacePriorityQuota) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, c := range classes {
+		if c.MaxPodsPerNamespace > 0 {
+			limits[c.Name] = c.MaxPodsPerNamespace
+		}
+	}
+	for name, max := range quota.MaxPods {
+		if !slices.ContainsFunc(classes, func(c PriorityClass) bool { return c.Name == name }) {
+			return nil, fmt.Errorf("namespace %s quota refers to unknown priority class %s", quota.Namespace, name)
+		}
+		if max < 0 {
+			return nil, fmt.Errorf("namespace %s quota of priority class %s cannot be negative", quota.Namespace, name)
+		}
+		limits[name] = max
+	}
+	return limits, nil
+}
+
+// CreatePriorityQuotas creates a ResourceQuota capping the number of pods each namespace may run at each priority of
+// the catalogue, applying opts to all created resources, and returns an error if any.
+func CreatePriorityQuotas(
+	ctx *pulumi.Context,
+	classes []PriorityClass,
+	quotas []NamespacePriorityQuota,
+	opts ...pulumi.ResourceOption,
+) error {
+	err := ValidatePriorityClasses(classes)
+	if err != nil {
+		return fmt.Errorf("error validating priority classes: %w", err)
+	}
+
+	labels := priorityClassLabels()
+	namespaces := map[string]bool{}
+	for _, q := range quotas {
+		if q.Namespace == "" {
+			return fmt.Errorf("priority quota namespace cannot be empty")
+		}
+		if namespaces[q.Namespace] {
+			return fmt.Errorf("priority quota of namespace %s is declared more than once", q.Namespace)
+		}
+		namespaces[q.Namespace] = true
+
+		limits, err := priorityQuotas(classes, q)
+		if err != nil {
+			return fmt.Errorf("error computing priority quotas: %w", err)
+		}
+		// Follow catalogue order for stable resource ordering
+		for _, c := range classes {
+			max, ok := limits[c.Name]
+			if !ok {
+				continue
+			}
+			name := "priority-" + c.Name
+			_, err := corev1.NewResourceQuota(ctx, q.Namespace+"-"+name, &corev1.ResourceQuotaArgs{
+				Metadata: &metav1.ObjectMetaArgs{
+					Name:      pulumi.String(name),
+					Namespace: pulumi.String(q.Namespace),
+					Labels:    labels,
+				},
+				Spec: &corev1.ResourceQuotaSpecArgs{
+					Hard: pulumi.StringMap{
+						"pods": pulumi.String(strconv.Itoa(max)),
+					},
+					ScopeSelector: &corev1.ScopeSelectorArgs{
+						MatchExpressions: corev1.ScopedResourceSelectorRequirementArray{
+							&corev1.ScopedResourceSelectorRequirementArgs{
+								ScopeName: pulumi.String("PriorityClass"),
+								Operator:  pulumi.String("In"),
+								Values: pulumi.StringArray{
+									pulumi.String(c.Name),
+								},
+							},
+						},
+					},
+				},
+			}, opts...)
+			if err != nil {
+				return fmt.Errorf("failed to create %s priority quota of namespace %s: %w", c.Name, q.Namespace, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,12 +1,41 @@
 package pulumilabel
 
 import (
+	"fmt"
+
 	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+// validatedValue returns the label value, failing when resolved if its syntax is invalid, so that invalid values are
+// reported on preview rather than when applying resources.
+func validatedValue(key string, value pulumi.StringInput) pulumi.StringOutput {
+	return value.ToStringOutput().ApplyT(func(v string) (string, error) {
+		err := label.ValidateValue(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid label %s: %w", key, err)
+		}
+		return v, nil
+	}).(pulumi.StringOutput)
+}
+
+// ValidatedLabels returns the labels with values failing when resolved if their syntax is invalid, and an error if any
+// key is invalid.
+func ValidatedLabels(labels pulumi.StringMap) (pulumi.StringMap, error) {
+	validated := pulumi.StringMap{}
+	for k, v := range labels {
+		err := label.Key(k).Validate()
+		if err != nil {
+			return nil, err
+		}
+		validated[k] = validatedValue(k, v)
+	}
+	return validated, nil
+}
+
 // DefaultLabels returns a set of default labels for the application instance as per Kubernetes convention,
-// see https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/#labels
+// see https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/#labels. Values are validated
+// when resolved.
 func DefaultLabels(
 	appName pulumi.StringInput,
 	appInstance pulumi.StringInput,
@@ -15,11 +44,11 @@ func DefaultLabels(
 	appNamespace pulumi.StringInput,
 ) pulumi.StringMap {
 	return pulumi.StringMap{
-		label.LabelAppNameKey:      appName,
-		label.LabelAppInstanceKey:  appInstance,
-		label.LabelAppVersionKey:   appVersion,
-		label.LabelAppComponentKey: appComponent,
-		label.LabelAppNamespaceKey: appNamespace,
+		label.LabelAppNameKey:      validatedValue(label.LabelAppNameKey, appName),
+		label.LabelAppInstanceKey:  validatedValue(label.LabelAppInstanceKey, appInstance),
+		label.LabelAppVersionKey:   validatedValue(label.LabelAppVersionKey, appVersion),
+		label.LabelAppComponentKey: validatedValue(label.LabelAppComponentKey, appComponent),
+		label.LabelAppNamespaceKey: validatedValue(label.LabelAppNamespaceKey, appNamespace),
 		label.LabelAppMangedByKey:  pulumi.String("pulumi"),
 	}
 }
@@ -0,0 +1,47 @@
+/*
+Package render provides a way to render Kubernetes components as plain manifests instead
+of deploying them to a live cluster.
+
+Rendering relies on the Kubernetes provider's renderYamlToDirectory setting: every resource
+created with the returned provider is written as YAML to the given directory, so that the
+result can be reviewed, diffed in pull requests, committed to GitOps repositories or linted
+offline with schema validation tools such as kubeconform.
+*/
+package render
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/kemadev/infrastructure-components/pkg/util"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// NewProvider creates a Kubernetes provider that renders manifests to dir instead of applying them
+// to a cluster, returning the provider and an error if any.
+func NewProvider(ctx *pulumi.Context, dir string) (*kubernetes.Provider, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("render directory cannot be empty")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve render directory %s: %w", dir, err)
+	}
+	provider, err := kubernetes.NewProvider(ctx, util.FormatResourceName(ctx, "Render provider"), &kubernetes.ProviderArgs{
+		RenderYamlToDirectory: pulumi.String(absDir),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create render provider: %w", err)
+	}
+	return provider, nil
+}
+
+// Options returns the resource options that components should be given so that they are rendered
+// using provider. Options only set the provider for the Kubernetes package, leaving other packages
+// (e.g. random) to their default providers.
+func Options(provider *kubernetes.Provider) []pulumi.ResourceOption {
+	return []pulumi.ResourceOption{
+		pulumi.Providers(provider),
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Package topologyspread provides named pod topology spread presets, built from topology labels, see
+https://kubernetes.io/docs/concepts/scheduling-eviction/topology-spread-constraints/.
+*/
+package topologyspread
+
+import (
+	"fmt"
+	"slices"
+
+	"dario.cat/mergo"
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// A Preset represents a named set of topology spread constraints.
+type Preset string
+
+const (
+	// PresetHAStrict requires pods to be spread across zones and nodes, leaving pods pending rather than co-locating
+	// them, and spreads them across other topology domains on a best effort basis.
+	PresetHAStrict Preset = "ha-strict"
+	// PresetHAZonal requires pods to be spread across zones, and spreads them across other topology domains on a best
+	// effort basis.
+	PresetHAZonal Preset = "ha-zonal"
+	// PresetBestEffort spreads pods across all topology domains on a best effort basis, never leaving pods pending.
+	PresetBestEffort Preset = "best-effort"
+	// PresetSingleNodeDev does not spread pods, e.g. for single node development clusters.
+	PresetSingleNodeDev Preset = "single-node-dev"
+)
+
+// Presets is the list of all presets.
+var Presets = []Preset{
+	PresetHAStrict,
+	PresetHAZonal,
+	PresetBestEffort,
+	PresetSingleNodeDev,
+}
+
+const (
+	// NodeTaintsPolicyHonor excludes nodes whose taints are not tolerated by pods when computing spread skew.
+	NodeTaintsPolicyHonor = "Honor"
+	// NodeTaintsPolicyIgnore includes all nodes when computing spread skew, regardless of their taints.
+	NodeTaintsPolicyIgnore = "Ignore"
+)
+
+const (
+	whenUnsatisfiableDoNotSchedule  = "DoNotSchedule"
+	whenUnsatisfiableScheduleAnyway = "ScheduleAnyway"
+)
+
+// A level is a topology domain pods are spread across.
+type level struct {
+	topologyKey string
+	// required is a boolean indicating if pods are left pending rather than breaking the spread.
+	required bool
+	// minDomains is a boolean indicating if Args.MinDomains applies to the level.
+	minDomains bool
+}
+
+// presetLevels are the topology levels of each preset, ordered from the widest to the narrowest domain.
+var presetLevels = map[Preset][]level{
+	PresetHAStrict: {
+		{topologyKey: label.LabelTopologyRegionKey},
+		{topologyKey: label.LabelTopologyZoneKey, required: true, minDomains: true},
+		{topologyKey: label.LabelTopologyDatacenterKey},
+		{topologyKey: label.LabelTopologyDatacenterZoneKey},
+		{topologyKey: label.LabelTopologyDatacenterAisleKey},
+		{topologyKey: label.LabelTopologyDatacenterRackKey},
+		{topologyKey: label.LabelTopologyHostnameKey, required: true},
+	},
+	PresetHAZonal: {
+		{topologyKey: label.LabelTopologyRegionKey},
+		{topologyKey: label.LabelTopologyZoneKey, required: true, minDomains: true},
+		{topologyKey: label.LabelTopologyDatacenterKey},
+		{topologyKey: label.LabelTopologyHostnameKey},
+	},
+	PresetBestEffort: {
+		{topologyKey: label.LabelTopologyRegionKey},
+		{topologyKey: label.LabelTopologyZoneKey},
+		{topologyKey: label.LabelTopologyDatacenterKey},
+		{topologyKey: label.LabelTopologyDatacenterZoneKey},
+		{topologyKey: label.LabelTopologyDatacenterAisleKey},
+		{topologyKey: label.LabelTopologyDatacenterRackKey},
+		{topologyKey: label.LabelTopologyHostnameKey},
+	},
+	PresetSingleNodeDev: {},
+}
+
+// presetDefaultMinDomains is the default minimum number of zones of presets requiring zone spreading.
+var presetDefaultMinDomains = map[Preset]int{
+	PresetHAStrict: 3,
+	PresetHAZonal:  2,
+}
+
+// An Args contains all the parameters needed to build topology spread constraints.
+type Args struct {
+	// Preset is the topology spread preset.
+	Preset Preset
+	// MaxSkew is the maximum difference of pods count between topology domains.
+	MaxSkew int
+	// MinDomains is the minimum number of zones pods are spread across, pods being left pending rather than running in
+	// fewer zones. Only valid for presets requiring zone spreading, defaulting to 3 for PresetHAStrict and 2 for
+	// PresetHAZonal.
+	MinDomains int
+	// NodeTaintsPolicy tells whether nodes whose taints are not tolerated are included in spread skew computation,
+	// either NodeTaintsPolicyHonor or NodeTaintsPolicyIgnore.
+	NodeTaintsPolicy string
+}
+
+// DefaultArgs are the default topology spread parameters.
+var DefaultArgs = Args{
+	Preset:           PresetBestEffort,
+	MaxSkew:          1,
+	NodeTaintsPolicy: NodeTaintsPolicyHonor,
+}
+
+// MergeArgs fills unset topology spread parameters with their preset and default values, and returns an error if any.
+func MergeArgs(args *Args) error {
+	err := mergo.Merge(args, DefaultArgs)
+	if err != nil {
+		return fmt.Errorf("error filling topology spread parameters: %w", err)
+	}
+	if args.MinDomains == 0 {
+		args.MinDomains = presetDefaultMinDomains[args.Preset]
+	}
+	return nil
+}
+
+// Validate validates merged topology spread parameters against the replica bounds of the workload, returning an
+// error if any of them is invalid, or if minReplicas cannot satisfy the preset.
+func Validate(args Args, minReplicas int, maxReplicas int) error {
+	levels, ok := presetLevels[args.Preset]
+	if !ok {
+		return fmt.Errorf("Preset %q is invalid, valid presets are %v", args.Preset, Presets)
+	}
+	if args.MaxSkew < 1 {
+		return fmt.Errorf("MaxSkew must be at least 1")
+	}
+	if !slices.Contains([]string{NodeTaintsPolicyHonor, NodeTaintsPolicyIgnore}, args.NodeTaintsPolicy) {
+		return fmt.Errorf("NodeTaintsPolicy %q is invalid", args.NodeTaintsPolicy)
+	}
+	if minReplicas > maxReplicas {
+		return fmt.Errorf("min replicas %d cannot be greater than max replicas %d", minReplicas, maxReplicas)
+	}
+	if !slices.ContainsFunc(levels, func(l level) bool { return l.minDomains }) {
+		if args.MinDomains != 0 {
+			return fmt.Errorf("MinDomains is not supported by preset %s", args.Preset)
+		}
+		return nil
+	}
+	if args.MinDomains < 1 {
+		return fmt.Errorf("MinDomains must be at least 1")
+	}
+	// Fewer replicas than domains would leave some domains without pods, defeating the preset purpose
+	if minReplicas < args.MinDomains {
+		return fmt.Errorf(
+			"preset %s requires at least %d replicas to spread across %d zones, got min replicas %d",
+			args.Preset,
+			args.MinDomains,
+			args.MinDomains,
+			minReplicas,
+		)
+	}
+	return nil
+}
+
+// Constraints returns the topology spread constraints of the merged parameters, spreading pods matching the selector.
+// Pods of different revisions are spread independently, so that rolling updates do not skew the spread.
+func Constraints(args Args, selector pulumi.StringMap) corev1.TopologySpreadConstraintArray {
+	constraints := corev1.TopologySpreadConstraintArray{}
+	for _, l := range presetLevels[args.Preset] {
+		constraint := corev1.TopologySpreadConstraintArgs{
+			MaxSkew: pulumi.Int(args.MaxSkew),
+			LabelSelector: &metav1.LabelSelectorArgs{
+				MatchLabels: selector,
+			},
+			MatchLabelKeys: pulumi.StringArray{
+				pulumi.String("pod-template-hash"),
+			},
+			TopologyKey:       pulumi.String(l.topologyKey),
+			WhenUnsatisfiable: pulumi.String(whenUnsatisfiableScheduleAnyway),
+			NodeTaintsPolicy:  pulumi.String(args.NodeTaintsPolicy),
+		}
+		if l.required {
+			constraint.WhenUnsatisfiable = pulumi.String(whenUnsatisfiableDoNotSchedule)
+		}
+		if l.minDomains {
+			constraint.MinDomains = pulumi.Int(args.MinDomains)
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
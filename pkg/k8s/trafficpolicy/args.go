@@ -0,0 +1,148 @@
+package trafficpolicy
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"dario.cat/mergo"
+)
+
+// minRateLimitPeriod is the lowest rate limit refill period Envoy supports.
+const minRateLimitPeriod = 50 * time.Millisecond
+
+// A RateLimit represents a local rate limit, applied by each Envoy instance to the requests matching the hostname and
+// path prefix.
+type RateLimit struct {
+	// Hostname is the hostname the limit applies to, e.g. api.kema.dev. It applies to all hostnames if empty, while
+	// hostname-specific limits take precedence.
+	Hostname string
+	// PathPrefix is the path prefix the limit applies to, e.g. /login. It applies to all paths if empty, while longer
+	// prefixes take precedence.
+	PathPrefix string
+	// Requests is the number of requests allowed per Period, rejected requests getting a 429 response.
+	Requests uint32
+	// Period is the period Requests are allowed in.
+	Period time.Duration
+}
+
+// A WAFArgs contains all the parameters needed to filter requests using the Coraza web application firewall, running
+// as an Envoy Wasm filter, see https://github.com/corazawaf/coraza-proxy-wasm. It requires an Envoy build with Wasm
+// support.
+type WAFArgs struct {
+	// ModuleURL is the HTTPS URL the Coraza Wasm module is fetched from.
+	ModuleURL url.URL
+	// ModuleSHA256 is the SHA-256 checksum of the Coraza Wasm module.
+	ModuleSHA256 string
+	// Directives are the SecLang directives configuring the WAF. Defaults to the OWASP core rule set, see
+	// WAFDefaultDirectives.
+	Directives []string
+	// DetectionOnly is a boolean indicating if matching requests should only be logged, not blocked.
+	DetectionOnly bool
+}
+
+// WAFDefaultDirectives are the default WAF directives, enabling the OWASP core rule set bundled with Coraza.
+var WAFDefaultDirectives = []string{
+	"Include @recommended-conf",
+	"Include @crs-setup-conf",
+	"Include @owasp_crs/*.conf",
+}
+
+// A TrafficPolicyArgs contains all the parameters needed to protect a service from excessive or malicious traffic.
+type TrafficPolicyArgs struct {
+	// RateLimits are the local rate limits applied to requests. Requests are not rate limited if empty.
+	RateLimits []RateLimit
+	// MaxRequestBodyBytes is the maximum size of request bodies, larger requests getting a 413 response. Request
+	// bodies size is not limited if zero.
+	MaxRequestBodyBytes uint32
+	// RequestTimeout is the time allowed to receive a whole request, e.g. the application HTTP read timeout.
+	RequestTimeout time.Duration
+	// ResponseTimeout is the time allowed to the service to respond, e.g. the application HTTP write timeout.
+	ResponseTimeout time.Duration
+	// IdleTimeout is the time a connection without active requests is kept open, e.g. the application HTTP idle
+	// timeout.
+	IdleTimeout time.Duration
+	// WAF contains the web application firewall parameters. Requests are not filtered if nil.
+	WAF *WAFArgs
+	// EnvoyVersion is the version of the Envoy proxy enforcing the policy, see
+	// https://hub.docker.com/r/envoyproxy/envoy/tags.
+	EnvoyVersion string
+	// Replicas is the number of Envoy proxy replicas enforcing the policy.
+	Replicas int
+	// CPURequestMiliCPU is the CPU request of each Envoy proxy replica, in mili vCPU.
+	CPURequestMiliCPU int
+	// CPULimitMiliCPU is the CPU limit of each Envoy proxy replica, in mili vCPU.
+	CPULimitMiliCPU int
+	// MemoryRequestMiB is the memory request of each Envoy proxy replica, in MiB.
+	MemoryRequestMiB int
+	// MemoryLimitMiB is the memory limit of each Envoy proxy replica, in MiB.
+	MemoryLimitMiB int
+}
+
+// TrafficPolicyDefaultArgs is the default traffic policy parameters, protecting nothing until limits are set.
+var TrafficPolicyDefaultArgs = TrafficPolicyArgs{
+	EnvoyVersion:      "v1.34.1",
+	Replicas:          2,
+	CPURequestMiliCPU: 100,
+	CPULimitMiliCPU:   500,
+	MemoryRequestMiB:  64,
+	MemoryLimitMiB:    256,
+}
+
+// mergeArgs fills unset traffic policy parameters with defaults, returning an error if any.
+func mergeArgs(args *TrafficPolicyArgs) error {
+	err := mergo.Merge(args, TrafficPolicyDefaultArgs)
+	if err != nil {
+		return fmt.Errorf("error filling traffic policy parameters: %w", err)
+	}
+	return nil
+}
+
+// validateArgs validates the traffic policy parameters, returning an error if any of them is invalid.
+func validateArgs(args TrafficPolicyArgs) error {
+	type rateLimitKey struct {
+		hostname   string
+		pathPrefix string
+	}
+	seen := map[rateLimitKey]bool{}
+	for _, rl := range args.RateLimits {
+		if rl.Requests == 0 {
+			return fmt.Errorf("rate limit %s%s Requests cannot be zero", rl.Hostname, rl.PathPrefix)
+		}
+		if rl.Period < minRateLimitPeriod {
+			return fmt.Errorf("rate limit %s%s Period must be at least %s", rl.Hostname, rl.PathPrefix, minRateLimitPeriod)
+		}
+		if rl.PathPrefix != "" && rl.PathPrefix[0] != '/' {
+			return fmt.Errorf("rate limit %s%s PathPrefix must start with /", rl.Hostname, rl.PathPrefix)
+		}
+		key := rateLimitKey{rl.Hostname, rl.PathPrefix}
+		if seen[key] {
+			return fmt.Errorf("rate limit %s%s is declared more than once", rl.Hostname, rl.PathPrefix)
+		}
+		seen[key] = true
+	}
+	if args.Replicas < 0 {
+		return fmt.Errorf("Replicas cannot be negative")
+	}
+	if args.CPURequestMiliCPU <= 0 || args.MemoryRequestMiB <= 0 {
+		return fmt.Errorf("CPURequestMiliCPU and MemoryRequestMiB must be positive")
+	}
+	if args.CPULimitMiliCPU < args.CPURequestMiliCPU {
+		return fmt.Errorf("CPULimitMiliCPU cannot be lower than CPURequestMiliCPU")
+	}
+	if args.MemoryLimitMiB < args.MemoryRequestMiB {
+		return fmt.Errorf("MemoryLimitMiB cannot be lower than MemoryRequestMiB")
+	}
+	if args.RequestTimeout < 0 || args.ResponseTimeout < 0 || args.IdleTimeout < 0 {
+		return fmt.Errorf("timeouts cannot be negative")
+	}
+	if args.WAF != nil {
+		if args.WAF.ModuleURL.Scheme != "https" {
+			return fmt.Errorf("WAF ModuleURL must be an HTTPS URL")
+		}
+		if len(args.WAF.ModuleSHA256) != 64 {
+			return fmt.Errorf("WAF ModuleSHA256 must be a hex-encoded SHA-256 checksum")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,509 @@
+/*
+Package trafficpolicy protects services from excessive or malicious traffic.
+
+The policy is enforced by an Envoy proxy deployed next to the service, which gateway routes target instead of the
+service itself. Gateways routing straight to endpoints, this places the policy on the gateway route path, while
+in-cluster traffic still reaches the service directly. The proxy applies local rate limits, request body size limits,
+timeouts and an optional web application firewall before proxying requests to the service.
+*/
+package trafficpolicy
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kemadev/infrastructure-components/pkg/k8s/label"
+	"github.com/kemadev/infrastructure-components/pkg/util"
+	appsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apps/v1"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// listenerPort is the port the proxy listens on.
+	listenerPort = 8080
+	// serviceClusterName is the name of the cluster proxying to the service.
+	serviceClusterName = "service"
+	// wafClusterName is the name of the cluster the WAF module is fetched from.
+	wafClusterName = "waf_module"
+
+	localRateLimitFilterName = "envoy.filters.http.local_ratelimit"
+	localRateLimitType       = "type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit"
+)
+
+// envoyDuration returns the Envoy representation of the duration.
+func envoyDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// rateLimitConfig returns the per-route configuration of the local rate limit filter enforcing the rate limit.
+func rateLimitConfig(rl RateLimit) map[string]any {
+	return map[string]any{
+		"@type":       localRateLimitType,
+		"stat_prefix": "http_local_rate_limiter",
+		"token_bucket": map[string]any{
+			"max_tokens":      int(rl.Requests),
+			"tokens_per_fill": int(rl.Requests),
+			"fill_interval":   envoyDuration(rl.Period),
+		},
+		"filter_enabled": map[string]any{
+			"runtime_key": "local_rate_limit_enabled",
+			"default_value": map[string]any{
+				"numerator":   100,
+				"denominator": "HUNDRED",
+			},
+		},
+		"filter_enforced": map[string]any{
+			"runtime_key": "local_rate_limit_enforced",
+			"default_value": map[string]any{
+				"numerator":   100,
+				"denominator": "HUNDRED",
+			},
+		},
+	}
+}
+
+// virtualHosts returns the virtual hosts routing requests to cluster, one per rate limited hostname along with a
+// catch-all one, applying the most specific rate limit to each route.
+func virtualHosts(args TrafficPolicyArgs, cluster string) []any {
+	hostnames := []string{}
+	for _, rl := range args.RateLimits {
+		if rl.Hostname != "" && !slices.Contains(hostnames, rl.Hostname) {
+			hostnames = append(hostnames, rl.Hostname)
+		}
+	}
+	slices.Sort(hostnames)
+	// Catch-all virtual host comes last
+	hostnames = append(hostnames, "")
+
+	action := map[string]any{
+		"cluster": cluster,
+	}
+	if args.ResponseTimeout > 0 {
+		action["timeout"] = envoyDuration(args.ResponseTimeout)
+	}
+
+	vhosts := []any{}
+	for _, h := range hostnames {
+		limits := map[string]RateLimit{}
+		for _, rl := range args.RateLimits {
+			if rl.Hostname == "" {
+				limits[rl.PathPrefix] = rl
+			}
+		}
+		for _, rl := range args.RateLimits {
+			if h != "" && rl.Hostname == h {
+				limits[rl.PathPrefix] = rl
+			}
+		}
+		// Match longest prefixes first
+		prefixes := slices.SortedFunc(maps.Keys(limits), func(a, b string) int {
+			return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a, b))
+		})
+		routes := []any{}
+		for _, p := range prefixes {
+			if p == "" {
+				continue
+			}
+			routes = append(routes, map[string]any{
+				"match": map[string]any{
+					"prefix": p,
+				},
+				"route": action,
+				"typed_per_filter_config": map[string]any{
+					localRateLimitFilterName: rateLimitConfig(limits[p]),
+				},
+			})
+		}
+		catchAll := map[string]any{
+			"match": map[string]any{
+				"prefix": "/",
+			},
+			"route": action,
+		}
+		if rl, ok := limits[""]; ok {
+			catchAll["typed_per_filter_config"] = map[string]any{
+				localRateLimitFilterName: rateLimitConfig(rl),
+			}
+		}
+		routes = append(routes, catchAll)
+
+		name := h
+		domains := []string{h}
+		if h == "" {
+			name = "default"
+			domains = []string{"*"}
+		}
+		vhosts = append(vhosts, map[string]any{
+			"name":    name,
+			"domains": domains,
+			"routes":  routes,
+		})
+	}
+	return vhosts
+}
+
+// wafFilter returns the Coraza Wasm HTTP filter, fetching its module using cluster, and an error if any.
+func wafFilter(args WAFArgs, cluster string) (map[string]any, error) {
+	engine := "On"
+	if args.DetectionOnly {
+		engine = "DetectionOnly"
+	}
+	directives := args.Directives
+	if len(directives) == 0 {
+		directives = WAFDefaultDirectives
+	}
+	// See https://github.com/corazawaf/coraza-proxy-wasm#configuration
+	conf, err := json.Marshal(map[string]any{
+		"directives_map": map[string][]string{
+			"default": append([]string{"SecRuleEngine " + engine}, directives...),
+		},
+		"default_directives": "default",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal waf configuration: %w", err)
+	}
+	return map[string]any{
+		"name": "envoy.filters.http.wasm",
+		"typed_config": map[string]any{
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm",
+			"config": map[string]any{
+				"name": "coraza",
+				"configuration": map[string]any{
+					"@type": "type.googleapis.com/google.protobuf.StringValue",
+					"value": string(conf),
+				},
+				"vm_config": map[string]any{
+					"vm_id":   "coraza",
+					"runtime": "envoy.wasm.runtime.v8",
+					"code": map[string]any{
+						"remote": map[string]any{
+							"http_uri": map[string]any{
+								"uri":     args.ModuleURL.String(),
+								"cluster": cluster,
+								"timeout": "30s",
+							},
+							"sha256": args.ModuleSHA256,
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// dnsCluster returns the cluster named name, proxying to the host resolved using DNS.
+func dnsCluster(name string, host string, port int) map[string]any {
+	return map[string]any{
+		"name":            name,
+		"connect_timeout": "5s",
+		"type":            "STRICT_DNS",
+		"lb_policy":       "ROUND_ROBIN",
+		"load_assignment": map[string]any{
+			"cluster_name": name,
+			"endpoints": []any{
+				map[string]any{
+					"lb_endpoints": []any{
+						map[string]any{
+							"endpoint": map[string]any{
+								"address": map[string]any{
+									"socket_address": map[string]any{
+										"address":    host,
+										"port_value": port,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// wafModuleCluster returns the cluster the Coraza Wasm module is fetched from.
+func wafModuleCluster(args WAFArgs, cluster string) map[string]any {
+	port := 443
+	if p, err := strconv.Atoi(args.ModuleURL.Port()); err == nil {
+		port = p
+	}
+	c := dnsCluster(cluster, args.ModuleURL.Hostname(), port)
+	c["transport_socket"] = map[string]any{
+		"name": "envoy.transport_sockets.tls",
+		"typed_config": map[string]any{
+			"@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext",
+			"sni":   args.ModuleURL.Hostname(),
+		},
+	}
+	return c
+}
+
+// envoyConfig returns the Envoy bootstrap configuration enforcing the policy in front of the service, proxying requests
+// to it at serviceHost:servicePort, and an error if any.
+func envoyConfig(args TrafficPolicyArgs, serviceHost string, servicePort int) (string, error) {
+	httpFilters := []any{}
+	if len(args.RateLimits) > 0 {
+		// Limits are set per route
+		httpFilters = append(httpFilters, map[string]any{
+			"name": localRateLimitFilterName,
+			"typed_config": map[string]any{
+				"@type":       localRateLimitType,
+				"stat_prefix": "http_local_rate_limiter",
+			},
+		})
+	}
+	if args.MaxRequestBodyBytes > 0 {
+		httpFilters = append(httpFilters, map[string]any{
+			"name": "envoy.filters.http.buffer",
+			"typed_config": map[string]any{
+				"@type":             "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.Buffer",
+				"max_request_bytes": int(args.MaxRequestBodyBytes),
+			},
+		})
+	}
+	clusters := []any{
+		dnsCluster(serviceClusterName, serviceHost, servicePort),
+	}
+	if args.WAF != nil {
+		f, err := wafFilter(*args.WAF, wafClusterName)
+		if err != nil {
+			return "", err
+		}
+		httpFilters = append(httpFilters, f)
+		clusters = append(clusters, wafModuleCluster(*args.WAF, wafClusterName))
+	}
+	httpFilters = append(httpFilters, map[string]any{
+		"name": "envoy.filters.http.router",
+		"typed_config": map[string]any{
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
+		},
+	})
+
+	hcm := map[string]any{
+		"@type":       "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+		"stat_prefix": "traffic_policy",
+		"route_config": map[string]any{
+			"name":          "traffic_policy",
+			"virtual_hosts": virtualHosts(args, serviceClusterName),
+		},
+		// Requests are forwarded by the gateway, which appends the client address to X-Forwarded-For, so the client
+		// address is read from it rather than from the gateway connection
+		"use_remote_address":  false,
+		"strip_any_host_port": true,
+		"http_filters":        httpFilters,
+	}
+	if args.RequestTimeout > 0 {
+		hcm["request_timeout"] = envoyDuration(args.RequestTimeout)
+	}
+	if args.IdleTimeout > 0 {
+		hcm["common_http_protocol_options"] = map[string]any{
+			"idle_timeout": envoyDuration(args.IdleTimeout),
+		}
+	}
+
+	config := map[string]any{
+		"static_resources": map[string]any{
+			"listeners": []any{
+				map[string]any{
+					"name": "traffic_policy",
+					"address": map[string]any{
+						"socket_address": map[string]any{
+							"address":    "0.0.0.0",
+							"port_value": listenerPort,
+						},
+					},
+					"filter_chains": []any{
+						map[string]any{
+							"filters": []any{
+								map[string]any{
+									"name":         "envoy.filters.network.http_connection_manager",
+									"typed_config": hcm,
+								},
+							},
+						},
+					},
+				},
+			},
+			"clusters": clusters,
+		},
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling envoy configuration: %w", err)
+	}
+	return string(b), nil
+}
+
+// DeployTrafficPolicy deploys the Envoy proxy enforcing the traffic policy of the service listening on servicePort,
+// named name, applying labels and opts to all created resources. It returns the name of the Service gateway routes
+// must target instead of the service so that the policy is enforced, and an error if any.
+func DeployTrafficPolicy(
+	ctx *pulumi.Context,
+	name string,
+	namespace string,
+	serviceName string,
+	servicePort int,
+	args TrafficPolicyArgs,
+	labels pulumi.StringMap,
+	opts ...pulumi.ResourceOption,
+) (string, error) {
+	err := mergeArgs(&args)
+	if err != nil {
+		return "", err
+	}
+	err = validateArgs(args)
+	if err != nil {
+		return "", fmt.Errorf("error validating traffic policy parameters: %w", err)
+	}
+
+	config, err := envoyConfig(args, serviceName+"."+namespace+".svc.cluster.local", servicePort)
+	if err != nil {
+		return "", err
+	}
+
+	proxyName := util.NameTargetDNSLabel.Truncate(serviceName + "-" + name)
+	proxyLabels := maps.Clone(labels)
+	proxyLabels[label.LabelAppInstanceKey] = pulumi.String(proxyName)
+	proxyLabels[label.LabelAppComponentKey] = pulumi.String(name)
+	selector := pulumi.StringMap{
+		label.LabelAppInstanceKey: pulumi.String(proxyName),
+	}
+
+	cm, err := corev1.NewConfigMap(ctx, name, &corev1.ConfigMapArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String(proxyName),
+			Namespace: pulumi.String(namespace),
+			Labels:    proxyLabels,
+		},
+		Data: pulumi.StringMap{
+			"envoy.json": pulumi.String(config),
+		},
+	}, opts...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create traffic policy %s configmap: %w", name, err)
+	}
+
+	_, err = appsv1.NewDeployment(ctx, name, &appsv1.DeploymentArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String(proxyName),
+			Namespace: pulumi.String(namespace),
+			Labels:    proxyLabels,
+		},
+		Spec: &appsv1.DeploymentSpecArgs{
+			Replicas: pulumi.Int(args.Replicas),
+			Selector: &metav1.LabelSelectorArgs{
+				MatchLabels: selector,
+			},
+			Template: &corev1.PodTemplateSpecArgs{
+				Metadata: &metav1.ObjectMetaArgs{
+					Labels: proxyLabels,
+					Annotations: pulumi.StringMap{
+						// Rollout pods on ConfigMap change, as Envoy does not reload its bootstrap configuration
+						"checksum/config": pulumi.String(fmt.Sprintf("%x", sha256.Sum256([]byte(config)))),
+					},
+				},
+				Spec: &corev1.PodSpecArgs{
+					SecurityContext: &corev1.PodSecurityContextArgs{
+						RunAsNonRoot: pulumi.Bool(true),
+						// Envoy image user
+						RunAsUser:  pulumi.Int(101),
+						RunAsGroup: pulumi.Int(101),
+						SeccompProfile: corev1.SeccompProfileArgs{
+							Type: pulumi.String("RuntimeDefault"),
+						},
+					},
+					Containers: corev1.ContainerArray{
+						&corev1.ContainerArgs{
+							Name:  pulumi.String("envoy"),
+							Image: pulumi.String("envoyproxy/envoy:" + args.EnvoyVersion),
+							Args: pulumi.StringArray{
+								pulumi.String("--config-path"),
+								pulumi.String("/etc/traffic-policy/envoy.json"),
+							},
+							Ports: corev1.ContainerPortArray{
+								corev1.ContainerPortArgs{
+									Name:          pulumi.String("http"),
+									ContainerPort: pulumi.Int(listenerPort),
+								},
+							},
+							// Explicit resources, not to inherit the application ones from the namespace LimitRange
+							Resources: corev1.ResourceRequirementsArgs{
+								Requests: pulumi.StringMap{
+									"cpu":    pulumi.String(strconv.Itoa(args.CPURequestMiliCPU) + "m"),
+									"memory": pulumi.String(strconv.Itoa(args.MemoryRequestMiB) + "Mi"),
+								},
+								Limits: pulumi.StringMap{
+									"cpu":    pulumi.String(strconv.Itoa(args.CPULimitMiliCPU) + "m"),
+									"memory": pulumi.String(strconv.Itoa(args.MemoryLimitMiB) + "Mi"),
+								},
+							},
+							ReadinessProbe: corev1.ProbeArgs{
+								TcpSocket: corev1.TCPSocketActionArgs{
+									Port: pulumi.Int(listenerPort),
+								},
+							},
+							SecurityContext: corev1.SecurityContextArgs{
+								ReadOnlyRootFilesystem:   pulumi.Bool(true),
+								AllowPrivilegeEscalation: pulumi.Bool(false),
+								Capabilities: corev1.CapabilitiesArgs{
+									Drop: pulumi.StringArray{
+										pulumi.String("ALL"),
+									},
+								},
+							},
+							VolumeMounts: corev1.VolumeMountArray{
+								corev1.VolumeMountArgs{
+									Name:      pulumi.String("config"),
+									MountPath: pulumi.String("/etc/traffic-policy"),
+									ReadOnly:  pulumi.Bool(true),
+								},
+							},
+						},
+					},
+					Volumes: corev1.VolumeArray{
+						corev1.VolumeArgs{
+							Name: pulumi.String("config"),
+							ConfigMap: corev1.ConfigMapVolumeSourceArgs{
+								Name: cm.Metadata.Name(),
+							},
+						},
+					},
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create traffic policy %s deployment: %w", name, err)
+	}
+
+	_, err = corev1.NewService(ctx, name, &corev1.ServiceArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name:      pulumi.String(proxyName),
+			Namespace: pulumi.String(namespace),
+			Labels:    proxyLabels,
+		},
+		Spec: &corev1.ServiceSpecArgs{
+			Ports: corev1.ServicePortArray{
+				&corev1.ServicePortArgs{
+					Name:       pulumi.String("http"),
+					Port:       pulumi.Int(servicePort),
+					TargetPort: pulumi.Int(listenerPort),
+				},
+			},
+			Selector: selector,
+		},
+	}, opts...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create traffic policy %s service: %w", name, err)
+	}
+
+	return proxyName, nil
+}
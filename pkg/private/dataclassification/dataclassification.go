@@ -16,3 +16,9 @@ const (
 func (dc DataClassification) String() string {
 	return strings.ToLower(string(dc))
 }
+
+// IsSensitive returns whether the DataClassification denotes sensitive data, i.e. any data classification other than
+// DataClassificationNone, requiring e.g. access logs redaction.
+func (dc DataClassification) IsSensitive() bool {
+	return dc.String() != DataClassificationNone.String()
+}
@@ -0,0 +1,195 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// nameHashLength is the length of the hash suffix of truncated names.
+const nameHashLength = 8
+
+// A NameTarget represents the naming rules of a kind of resource names. Targets are created using NewNameTarget, the
+// zero value rejecting all names.
+type NameTarget struct {
+	// name is the name of the target, used in errors.
+	name string
+	// minLength is the minimum length of names.
+	minLength int
+	// maxLength is the maximum length of names, longer names being truncated with a hash suffix.
+	maxLength int
+	// pattern is the pattern names must match.
+	pattern *regexp.Regexp
+	// check is an optional extra rule of the target.
+	check func(name string) error
+}
+
+// NewNameTarget returns the naming rules of names between minLength and maxLength characters matching pattern, and
+// following check if not nil, and an error if any. maxLength must leave room for the hash suffix of truncated names.
+func NewNameTarget(
+	name string,
+	minLength int,
+	maxLength int,
+	pattern string,
+	check func(name string) error,
+) (NameTarget, error) {
+	if name == "" {
+		return NameTarget{}, fmt.Errorf("name target name cannot be empty")
+	}
+	if minLength < 1 || maxLength < minLength {
+		return NameTarget{}, fmt.Errorf(
+			"%s name target lengths %d and %d are invalid, must be positive and ordered",
+			name,
+			minLength,
+			maxLength,
+		)
+	}
+	if maxLength < nameHashLength+2 {
+		return NameTarget{}, fmt.Errorf(
+			"%s name target maximum length %d must be at least %d to fit truncated names",
+			name,
+			maxLength,
+			nameHashLength+2,
+		)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return NameTarget{}, fmt.Errorf("failed to compile %s name target pattern: %w", name, err)
+	}
+	return NameTarget{
+		name:      name,
+		minLength: minLength,
+		maxLength: maxLength,
+		pattern:   re,
+		check:     check,
+	}, nil
+}
+
+// mustNameTarget returns the naming rules created by NewNameTarget, panicking on error.
+func mustNameTarget(
+	name string,
+	minLength int,
+	maxLength int,
+	pattern string,
+	check func(name string) error,
+) NameTarget {
+	t, err := NewNameTarget(name, minLength, maxLength, pattern, check)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Name returns the name of the target.
+func (t NameTarget) Name() string {
+	return t.name
+}
+
+// MinLength returns the minimum length of names.
+func (t NameTarget) MinLength() int {
+	return t.minLength
+}
+
+// MaxLength returns the maximum length of names.
+func (t NameTarget) MaxLength() int {
+	return t.maxLength
+}
+
+var (
+	// NameTargetPulumiResource is the naming rules of Pulumi resource names.
+	NameTargetPulumiResource = mustNameTarget("pulumi resource", 1, 140, `^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`, nil)
+	// NameTargetDNSLabel is the naming rules of DNS-1123 labels, e.g. most Kubernetes object names, see
+	// https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#dns-label-names.
+	NameTargetDNSLabel = mustNameTarget("dns label", 1, 63, `^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`, nil)
+	// NameTargetDNSSubdomain is the naming rules of DNS-1123 subdomains, see
+	// https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#dns-subdomain-names.
+	NameTargetDNSSubdomain = mustNameTarget(
+		"dns subdomain",
+		1,
+		253,
+		`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`,
+		nil,
+	)
+	// NameTargetGitHubResource is the naming rules of GitHub resources such as repositories.
+	NameTargetGitHubResource = mustNameTarget("github resource", 1, 100, `^[A-Za-z0-9._-]+$`, checkGitHubResourceName)
+	// NameTargetS3Bucket is the naming rules of S3 buckets, see
+	// https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucketnamingrules.html.
+	NameTargetS3Bucket = mustNameTarget("s3 bucket", 3, 63, `^[a-z0-9][a-z0-9.-]*[a-z0-9]$`, checkS3BucketName)
+)
+
+// checkGitHubResourceName returns an error if the name is reserved by GitHub.
+func checkGitHubResourceName(name string) error {
+	if name == "." || name == ".." {
+		return fmt.Errorf("name %q is reserved", name)
+	}
+	return nil
+}
+
+// checkS3BucketName returns an error if the name breaks S3 bucket rules that patterns cannot express.
+func checkS3BucketName(name string) error {
+	if strings.Contains(name, "..") {
+		return fmt.Errorf("name %q cannot contain adjacent periods", name)
+	}
+	if net.ParseIP(name) != nil {
+		return fmt.Errorf("name %q cannot be formatted as an IP address", name)
+	}
+	for _, prefix := range []string{"xn--", "sthree-", "amzn-s3-demo-"} {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("name %q cannot start with %s", name, prefix)
+		}
+	}
+	for _, suffix := range []string{"-s3alias", "--ol-s3", ".mrap", "--x-s3", "--table-s3"} {
+		if strings.HasSuffix(name, suffix) {
+			return fmt.Errorf("name %q cannot end with %s", name, suffix)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the name does not follow the target rules.
+func (t NameTarget) Validate(name string) error {
+	if t.pattern == nil {
+		return fmt.Errorf("name target is not initialized, use NewNameTarget")
+	}
+	if len(name) < t.minLength || len(name) > t.maxLength {
+		return fmt.Errorf("%s name %q must be between %d and %d characters", t.name, name, t.minLength, t.maxLength)
+	}
+	if !t.pattern.MatchString(name) {
+		return fmt.Errorf("%s name %q must match %s", t.name, name, t.pattern)
+	}
+	if t.check != nil {
+		err := t.check(name)
+		if err != nil {
+			return fmt.Errorf("invalid %s name: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// Truncate returns the name if it fits the target, otherwise its longest prefix that fits followed by a hyphen and a
+// short stable hash of the whole name, so that long names sharing a prefix do not collide. Trailing hyphens and
+// periods of the prefix are trimmed, so that the result stays a valid name. Names are returned as is by the zero value
+// target, which Validate rejects.
+func (t NameTarget) Truncate(name string) string {
+	if len(name) <= t.maxLength || t.maxLength < nameHashLength+2 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:nameHashLength]
+	prefix := strings.TrimRight(name[:t.maxLength-nameHashLength-1], "-.")
+	return prefix + "-" + hash
+}
+
+// FormatName returns the name in kebab-case, truncated to fit the target, and an error if it does not follow the
+// target rules.
+func FormatName(name string, target NameTarget) (string, error) {
+	formatted := target.Truncate(KebabCase(name))
+	err := target.Validate(formatted)
+	if err != nil {
+		return "", err
+	}
+	return formatted, nil
+}
@@ -0,0 +1,114 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameTargetTruncate(t *testing.T) {
+	long := strings.Repeat("a", 200)
+	tests := []struct {
+		name   string
+		target NameTarget
+		in     string
+	}{
+		{name: "fits", target: NameTargetDNSLabel, in: "short-name"},
+		{name: "exact length", target: NameTargetDNSLabel, in: strings.Repeat("a", 63)},
+		{name: "one over", target: NameTargetDNSLabel, in: strings.Repeat("a", 64)},
+		{name: "long", target: NameTargetPulumiResource, in: long},
+		{name: "hyphen at cut", target: NameTargetDNSLabel, in: strings.Repeat("a", 53) + "-" + strings.Repeat("b", 20)},
+		{name: "hyphens at cut", target: NameTargetDNSLabel, in: strings.Repeat("a", 50) + "----" + strings.Repeat("b", 20)},
+		{name: "period at cut", target: NameTargetDNSSubdomain, in: strings.Repeat("a.", 150)},
+		{name: "s3 bucket", target: NameTargetS3Bucket, in: strings.Repeat("bucket-", 20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.target.Truncate(tt.in)
+			if len(got) > tt.target.MaxLength() {
+				t.Errorf("Truncate() length = %d, want at most %d", len(got), tt.target.MaxLength())
+			}
+			if len(tt.in) <= tt.target.MaxLength() && got != tt.in {
+				t.Errorf("Truncate(%q) = %q, want it unchanged", tt.in, got)
+			}
+			if strings.HasSuffix(got, "-") || strings.Contains(got, "--") || strings.Contains(got, ".-") {
+				t.Errorf("Truncate(%q) = %q, has a dangling separator", tt.in, got)
+			}
+			err := tt.target.Validate(got)
+			if err != nil {
+				t.Errorf("Truncate(%q) = %q, is invalid: %v", tt.in, got, err)
+			}
+			if again := tt.target.Truncate(tt.in); again != got {
+				t.Errorf("Truncate(%q) is not stable, got %q then %q", tt.in, got, again)
+			}
+		})
+	}
+}
+
+func TestNameTargetTruncateDistinct(t *testing.T) {
+	prefix := strings.Repeat("shared-prefix-", 10)
+	names := []string{prefix + "one", prefix + "two", prefix + "three", prefix + "on", prefix + "one-"}
+	seen := map[string]string{}
+	for _, n := range names {
+		got := NameTargetDNSLabel.Truncate(n)
+		if other, ok := seen[got]; ok {
+			t.Errorf("Truncate(%q) and Truncate(%q) both return %q", n, other, got)
+		}
+		seen[got] = n
+	}
+}
+
+func TestNameTargetTruncateHash(t *testing.T) {
+	got := NameTargetDNSLabel.Truncate(strings.Repeat("a", 100))
+	// Hash of the whole name is known, so that it never changes across releases
+	want := strings.Repeat("a", 54) + "-28165978"
+	if got != want {
+		t.Errorf("Truncate() = %q, want %q", got, want)
+	}
+}
+
+func TestNameTargetZeroValue(t *testing.T) {
+	target := NameTarget{}
+	if got := target.Truncate("name"); got != "name" {
+		t.Errorf("Truncate() = %q, want name unchanged", got)
+	}
+	if err := target.Validate("name"); err == nil {
+		t.Error("Validate() error = nil, want an error")
+	}
+	if _, err := FormatName("name", target); err == nil {
+		t.Error("FormatName() error = nil, want an error")
+	}
+}
+
+func TestNewNameTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		minLength int
+		maxLength int
+		pattern   string
+		wantErr   bool
+	}{
+		{name: "valid", target: "test", minLength: 1, maxLength: 20, pattern: `^[a-z]+$`},
+		{name: "smallest maximum length", target: "test", minLength: 1, maxLength: nameHashLength + 2, pattern: `^.+$`},
+		{name: "empty name", target: "", minLength: 1, maxLength: 20, pattern: `^.+$`, wantErr: true},
+		{name: "zero minimum length", target: "test", minLength: 0, maxLength: 20, pattern: `^.+$`, wantErr: true},
+		{name: "unordered lengths", target: "test", minLength: 30, maxLength: 20, pattern: `^.+$`, wantErr: true},
+		{name: "no room for hash", target: "test", minLength: 1, maxLength: nameHashLength + 1, pattern: `^.+$`, wantErr: true},
+		{name: "invalid pattern", target: "test", minLength: 1, maxLength: 20, pattern: `^[`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := NewNameTarget(tt.target, tt.minLength, tt.maxLength, tt.pattern, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewNameTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := target.Truncate(strings.Repeat("a", 100))
+			if len(got) > tt.maxLength {
+				t.Errorf("Truncate() length = %d, want at most %d", len(got), tt.maxLength)
+			}
+		})
+	}
+}
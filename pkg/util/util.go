@@ -53,21 +53,20 @@ func CamelCase(str string) string {
 }
 
 // Output a formatted resource name, kebab-case, 140 characters or less, prefixed with project's name
-// Should be used for most resources
+// Should be used for most resources. Longer names are truncated with a stable hash suffix, see NameTarget.Truncate
 func FormatResourceName(ctx *pulumi.Context, name string) string {
-	resourceName := KebabCase(ctx.Project() + "-" + name)
-	if len(resourceName) > 140 {
-		resourceName = resourceName[:140]
-	}
-	return resourceName
+	return NameTargetPulumiResource.Truncate(KebabCase(ctx.Project() + "-" + name))
 }
 
 // Output a formatted resource name, kebab-case, 63 characters or less, prefixed with project's name
 // Should be used resources with fewwer allowed characters in their names such as S3, RDS, ...
+// Longer names are truncated with a stable hash suffix, see NameTarget.Truncate
 func FormatResourceNameShort(ctx *pulumi.Context, name string) string {
-	resourceNameLong := FormatResourceName(ctx, name)
-	if len(resourceNameLong) > 63 {
-		return resourceNameLong[:63]
-	}
-	return resourceNameLong
+	return NameTargetDNSLabel.Truncate(KebabCase(ctx.Project() + "-" + name))
+}
+
+// Output a formatted resource name, kebab-case, prefixed with project's name, truncated to fit the target, and an
+// error if it does not follow the target rules
+func FormatResourceNameFor(ctx *pulumi.Context, name string, target NameTarget) (string, error) {
+	return FormatName(ctx.Project()+"-"+name, target)
 }
@@ -0,0 +1,71 @@
+package util
+
+import "testing"
+
+func TestKebabCase(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "empty", in: "", want: ""},
+		{name: "single character", in: "x", want: "x"},
+		{name: "lowercase word", in: "hello", want: "hello"},
+		{name: "pascal case", in: "HelloWorld", want: "hello-world"},
+		{name: "camel case", in: "helloWorld", want: "hello-world"},
+		{name: "spaces", in: "hello world", want: "hello-world"},
+		{name: "leading and trailing spaces", in: "  leading and trailing  ", want: "leading-and-trailing"},
+		{name: "tabs", in: "tab\tseparated", want: "tab-separated"},
+		{name: "snake case", in: "snake_case_name", want: "snake-case-name"},
+		{name: "already kebab case", in: "kebab-case-name", want: "kebab-case-name"},
+		{name: "repeated hyphens", in: "--multiple---hyphens--", want: "multiple-hyphens"},
+		{name: "uppercase word", in: "ABC", want: "abc"},
+		{name: "acronym", in: "myHTTPServer", want: "my-httpserver"},
+		{name: "periods", in: "version 1.2.3", want: "version-1-2-3"},
+		{name: "digits before uppercase", in: "a1B2", want: "a1b2"},
+		{name: "non ascii letters", in: "Ünïcode", want: "n-code"},
+		{name: "mixed", in: "CamelCase With Spaces", want: "camel-case-with-spaces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := KebabCase(tt.in)
+			if got != tt.want {
+				t.Errorf("KebabCase(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "empty", in: "", want: ""},
+		{name: "single character", in: "x", want: "x"},
+		{name: "lowercase word", in: "hello", want: "hello"},
+		{name: "spaces", in: "hello world", want: "helloWorld"},
+		{name: "leading and trailing spaces", in: "  leading and trailing  ", want: "leadingAndTrailing"},
+		{name: "tabs", in: "tab\tseparated", want: "tabSeparated"},
+		{name: "snake case", in: "snake_case_name", want: "snakeCaseName"},
+		{name: "kebab case", in: "kebab-case-name", want: "kebabCaseName"},
+		{name: "repeated separators", in: "--multiple---hyphens--", want: "multipleHyphens"},
+		{name: "pascal case is lowered", in: "HelloWorld", want: "helloworld"},
+		{name: "camel case is lowered", in: "helloWorld", want: "helloworld"},
+		{name: "uppercase word", in: "ABC", want: "abc"},
+		{name: "acronym", in: "myHTTPServer", want: "myhttpserver"},
+		{name: "periods", in: "version 1.2.3", want: "version123"},
+		{name: "digits", in: "a1B2", want: "a1b2"},
+		{name: "non ascii letters", in: "Ünïcode", want: "nCode"},
+		{name: "mixed", in: "CamelCase With Spaces", want: "camelcaseWithSpaces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CamelCase(tt.in)
+			if got != tt.want {
+				t.Errorf("CamelCase(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
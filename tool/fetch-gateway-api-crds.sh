@@ -0,0 +1,18 @@
+#!/usr/bin/env sh
+# Fetch Gateway API CRD manifests of the given versions, for both release channels, to the current directory
+# `manifests` directory, so that they can be embedded. Run using `go generate ./pkg/k8s/gwapicrds`.
+set -eu
+
+if [ "$#" -eq 0 ]; then
+	echo "usage: $0 <version>..." >&2
+	exit 2
+fi
+
+for version in "$@"; do
+	mkdir -p "manifests/${version}"
+	for channel in standard experimental; do
+		curl --fail --silent --show-error --location \
+			--output "manifests/${version}/${channel}-install.yaml" \
+			"https://github.com/kubernetes-sigs/gateway-api/releases/download/${version}/${channel}-install.yaml"
+	done
+done